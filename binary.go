@@ -27,11 +27,53 @@ func getInstance() *instance {
 	return global
 }
 
+// Codec is an encoder/decoder with its own schema cache and options.
+// The package-level functions use a shared default Codec.
+type Codec struct {
+	tb *instance
+}
+
+// New creates an isolated Codec. Accepted args are Option values and an
+// optional func(msg ...any) logger.
+func New(args ...any) *Codec {
+	return &Codec{tb: newInstance(args...)}
+}
+
+func defaultCodec() *Codec {
+	return &Codec{tb: getInstance()}
+}
+
 // Encode encodes input to output.
 // input: struct or pointer to struct
 // output: *[]byte or io.Writer
 func Encode(input, output any) error {
-	inst := getInstance()
+	return defaultCodec().Encode(input, output)
+}
+
+// Decode decodes input to output.
+// input: []byte or io.Reader
+// output: pointer to struct
+func Decode(input, output any) error {
+	return defaultCodec().Decode(input, output)
+}
+
+// EncodedSize returns the number of bytes Encode writes for input, without
+// keeping them.
+func EncodedSize(input any) (int, error) {
+	return defaultCodec().EncodedSize(input)
+}
+
+// SetLog sets a custom logging function for debug/testing.
+// Pass nil to disable logging.
+func SetLog(fn func(msg ...any)) {
+	defaultCodec().SetLog(fn)
+}
+
+// Encode encodes input to output using this codec.
+// input: struct or pointer to struct
+// output: *[]byte or io.Writer
+func (c *Codec) Encode(input, output any) error {
+	inst := c.tb
 
 	switch out := output.(type) {
 	case *[]byte:
@@ -50,11 +92,11 @@ func Encode(input, output any) error {
 	}
 }
 
-// Decode decodes input to output.
+// Decode decodes input to output using this codec.
 // input: []byte or io.Reader
 // output: pointer to struct
-func Decode(input, output any) error {
-	inst := getInstance()
+func (c *Codec) Decode(input, output any) error {
+	inst := c.tb
 
 	switch in := input.(type) {
 	case []byte:
@@ -66,10 +108,32 @@ func Decode(input, output any) error {
 	}
 }
 
-// SetLog sets a custom logging function for debug/testing.
+// EncodedSize returns the number of bytes Encode writes for input with this
+// codec's options, without keeping them.
+func (c *Codec) EncodedSize(input any) (int, error) {
+	var n countWriter
+	err := c.tb.encodeTo(input, &n)
+	return int(n), err
+}
+
+// countWriter counts the bytes written to it.
+type countWriter int
+
+func (w *countWriter) Write(p []byte) (int, error) {
+	*w += countWriter(len(p))
+	return len(p), nil
+}
+
+// SetLog sets a custom logging function for this codec.
 // Pass nil to disable logging.
-func SetLog(fn func(msg ...any)) {
-	getInstance().log = fn
+func (c *Codec) SetLog(fn func(msg ...any)) {
+	c.tb.log = fn
+}
+
+// Register scans, validates and caches the given types in this codec.
+// See the package-level Register.
+func (c *Codec) Register(types ...any) error {
+	return c.tb.register(types...)
 }
 
 // instance represents a binary encoder/decoder with isolated state.
@@ -88,26 +152,65 @@ type instance struct {
 
 	// Mutex to protect schemas slice
 	mu sync.RWMutex
+
+	// fingerprint enables the schema fingerprint header (see WithFingerprint)
+	fingerprint bool
+
+	// fingerprintNames includes field names in the fingerprint
+	fingerprintNames bool
+
+	// compress enables the compression flag byte (see WithCompression)
+	compress bool
+
+	// compressAt is the body size from which bodies are deflated
+	compressAt int
+
+	// maxSize bounds the size of a decoded body, 0 for the default
+	maxSize int
+
+	// canonical sorts map entries when encoding (see WithCanonical)
+	canonical bool
+
+	// checksum adds a CRC32C to frames (see WithChecksum)
+	checksum bool
+
+	// format selects a non-native wire format (see WithFormat)
+	format Format
+
+	// protoMessages caches the protobuf layout of struct types
+	protoMessages []protoEntry
+
+	// layout selects a fixed binary layout (see WithLayout)
+	layout Layout
+
+	// layouts caches the fixed layout codecs of types
+	layouts []layoutEntry
 }
 
 // schemaEntry represents a cached schema with its type and codec
 type schemaEntry struct {
 	Type  reflect.Type
 	codec codec
-	Name  string // Optional handler name
+	Name  string  // Optional handler name
+	fp    uint64  // Lazily computed schema fingerprint, 0 if not yet known
+	desc  *Schema // Lazily computed schema descriptor, nil if not yet known
+
+	version   uint // BinaryVersion of the type, see typeVersion
+	versioned bool // values carry a version header
 }
 
 func newInstance(args ...any) *instance {
-	var logFunc func(msg ...any) // Default: no logging
+	tb := &instance{} // Default: no logging
 
 	for _, arg := range args {
-		if log, ok := arg.(func(msg ...any)); ok {
-			logFunc = log
+		switch a := arg.(type) {
+		case func(msg ...any):
+			tb.log = a
+		case Option:
+			a(tb)
 		}
 	}
 
-	tb := &instance{log: logFunc}
-
 	tb.schemas = make([]schemaEntry, 0, 100) // Pre-allocate reasonable size
 	tb.encoders = &sync.Pool{
 		New: func() any {
@@ -129,6 +232,21 @@ func newInstance(args ...any) *instance {
 
 // EncodeTo encodes the payload into a specific destination using this instance.
 func (tb *instance) encodeTo(data any, dst io.Writer) error {
+	if tb.compress {
+		return tb.encodeCompressed(data, dst)
+	}
+	return tb.encodeBody(data, dst)
+}
+
+// encodeBody encodes the payload, without the compression envelope.
+func (tb *instance) encodeBody(data any, dst io.Writer) error {
+	if l := tb.layoutOf(data); l != LayoutNone {
+		return tb.encodeLayout(data, l, dst)
+	}
+	if tb.format != FormatBinary {
+		return tb.encodeFormat(data, dst)
+	}
+
 	// Get the encoder from the pool, reset it
 	e := tb.encoders.Get().(*encoder)
 	e.reset(dst, tb)
@@ -143,17 +261,51 @@ func (tb *instance) encodeTo(data any, dst io.Writer) error {
 
 // Decode decodes the payload from the binary format using this instance.
 func (tb *instance) decode(data []byte, target any) error {
+	if tb.compress {
+		return tb.decodeCompressed(data, target)
+	}
+	if tb.maxSize > 0 && len(data) > tb.maxSize {
+		return ErrTooLarge
+	}
+	return tb.decodeBody(data, target)
+}
+
+// decodeBody decodes the payload, without the compression envelope.
+func (tb *instance) decodeBody(data []byte, target any) error {
+	l := tb.layoutOf(target)
+	if l == LayoutNone && tb.format != FormatBinary {
+		return tb.decodeFormat(data, target)
+	}
+
 	// Get the decoder from the pool, reset it
 	d := tb.decoders.Get().(*decoder)
 	d.reset(data, tb)
 
 	// Decode and free the decoder
-	err := d.decode(target)
+	var err error
+	if l != LayoutNone {
+		err = tb.decodeLayout(d, target, l)
+	} else {
+		err = d.decode(target)
+	}
 	tb.decoders.Put(d)
 	return err
 }
 
 func (tb *instance) decodeFrom(r io.Reader, target any) error {
+	if tb.compress {
+		return tb.decodeCompressedFrom(r, target)
+	}
+	return tb.decodeBodyFrom(r, target)
+}
+
+// decodeBodyFrom decodes the payload from r, without the compression envelope.
+func (tb *instance) decodeBodyFrom(r io.Reader, target any) error {
+	l := tb.layoutOf(target)
+	if l == LayoutNone && tb.format != FormatBinary {
+		return tb.decodeFormatFrom(r, target)
+	}
+
 	// Get the decoder from the pool, reset it
 	d := tb.decoders.Get().(*decoder)
 	if d.reader == nil {
@@ -172,7 +324,12 @@ func (tb *instance) decodeFrom(r io.Reader, target any) error {
 	d.tb = tb
 
 	// Decode and free the decoder
-	err := d.decode(target)
+	var err error
+	if l != LayoutNone {
+		err = tb.decodeLayout(d, target, l)
+	} else {
+		err = d.decode(target)
+	}
 	tb.decoders.Put(d)
 	return err
 }
@@ -201,21 +358,81 @@ func (tb *instance) findSchemaByName(name string) (codec, reflect.Type, bool) {
 	return nil, nil, false
 }
 
-// addSchema adds a new schema to the slice-based cache
-func (tb *instance) addSchema(t reflect.Type, codec codec, name string) {
+// addSchema adds a new schema to the slice-based cache. A non-empty name is
+// bound one-to-one to t; if it already belongs to another type the schema is
+// not cached and the collision is returned.
+func (tb *instance) addSchema(t reflect.Type, codec codec, name string) error {
 	tb.mu.Lock()
 	defer tb.mu.Unlock()
+	if err := tb.checkName(t, name); err != nil {
+		return err
+	}
+
 	// Simple cache size limit (optional, for memory control)
 	if len(tb.schemas) >= 1000 { // Reasonable default limit
 		// Simple eviction: remove oldest (first) entry
 		tb.schemas = tb.schemas[1:]
 	}
 
+	version, versioned := typeVersion(t)
 	tb.schemas = append(tb.schemas, schemaEntry{
-		Type:  t,
-		codec: codec,
-		Name:  name,
+		Type:      t,
+		codec:     codec,
+		Name:      name,
+		version:   version,
+		versioned: versioned,
 	})
+	return nil
+}
+
+// versionOf returns the cached BinaryVersion of t and whether t is versioned.
+func (tb *instance) versionOf(t reflect.Type) (uint, bool) {
+	tb.mu.RLock()
+	for _, entry := range tb.schemas {
+		if entry.Type == t {
+			tb.mu.RUnlock()
+			return entry.version, entry.versioned
+		}
+	}
+	tb.mu.RUnlock()
+	return typeVersion(t)
+}
+
+// bindName attaches name to the cached entry of t, e.g. when t was first
+// cached through a value that did not expose HandlerName.
+func (tb *instance) bindName(t reflect.Type, name string) error {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+	if err := tb.checkName(t, name); err != nil {
+		return err
+	}
+	for i := range tb.schemas {
+		if tb.schemas[i].Type == t {
+			if tb.schemas[i].Name == "" {
+				tb.schemas[i].Name = name
+			}
+			break
+		}
+	}
+	return nil
+}
+
+// checkName reports a HandlerName already bound to a type other than t.
+// Callers must hold the write lock.
+func (tb *instance) checkName(t reflect.Type, name string) error {
+	if name == "" {
+		return nil
+	}
+	for _, entry := range tb.schemas {
+		if entry.Name == name && entry.Type != t {
+			err := Err(t.String()+":", "HandlerName", `"`+name+`"`, "already used by", entry.Type.String())
+			if tb.log != nil {
+				tb.log(err.Error())
+			}
+			return err
+		}
+	}
+	return nil
 }
 
 // scanToCache scans the type and caches it in the instance using slice-based cache
@@ -227,6 +444,11 @@ func (tb *instance) scanToCache(t reflect.Type, name string) (codec, error) {
 	// Double check if we already have this schema cached by type
 	// (Though callers usually check first, it's safer here)
 	if c, found := tb.findSchema(t); found {
+		if name != "" {
+			if err := tb.bindName(t, name); err != nil {
+				return nil, err
+			}
+		}
 		return c, nil
 	}
 
@@ -237,7 +459,9 @@ func (tb *instance) scanToCache(t reflect.Type, name string) (codec, error) {
 	}
 
 	// Cache the schema
-	tb.addSchema(t, c, name)
+	if err := tb.addSchema(t, c, name); err != nil {
+		return nil, err
+	}
 
 	return c, nil
 }
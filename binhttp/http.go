@@ -0,0 +1,161 @@
+// Package binhttp decodes HTTP request bodies and writes responses in the
+// binary format, negotiating JSON for clients that ask for it. It lives apart
+// from the core package so TinyGo and WebAssembly builds don't link net/http.
+package binhttp
+
+import (
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/tinywasm/binary"
+	. "github.com/tinywasm/fmt"
+)
+
+// ContentType is the media type of binary bodies.
+const ContentType = "application/vnd.tinywasm.binary"
+
+const jsonType = "application/json"
+
+// MaxBodySize bounds the request bodies DecodeRequest reads.
+var MaxBodySize int64 = 4 << 20
+
+// ErrUnsupportedMediaType is returned by DecodeRequest for bodies that are
+// neither ContentType nor JSON.
+var ErrUnsupportedMediaType error = Err("binhttp:", "unsupported content type")
+
+// DecodeRequest decodes the body of r into v. The body must be ContentType,
+// or JSON as produced by binary.ToJSON, and at most MaxBodySize bytes;
+// larger bodies fail with binary.ErrTooLarge.
+func DecodeRequest(r *http.Request, v any) error {
+	media, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || (media != ContentType && media != jsonType) {
+		return ErrUnsupportedMediaType
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, MaxBodySize+1))
+	if err != nil {
+		return err
+	}
+	if int64(len(body)) > MaxBodySize {
+		return binary.ErrTooLarge
+	}
+
+	if media == jsonType {
+		if body, err = binary.FromJSON(body, v); err != nil {
+			return err
+		}
+	}
+	return binary.Decode(body, v)
+}
+
+// WriteResponse encodes v and writes it with the given status. Responses go
+// out as ContentType, or as JSON when Negotiate picked it for the request,
+// also when other middleware wrap w with an Unwrap method.
+// Nothing is written when v fails to encode, so the caller can still reply
+// with an error.
+func WriteResponse(w http.ResponseWriter, status int, v any) error {
+	var body []byte
+	if err := binary.Encode(v, &body); err != nil {
+		return err
+	}
+
+	contentType := ContentType
+	if negotiatedJSON(w) {
+		var err error
+		if body, err = binary.ToJSON(body, v); err != nil {
+			return err
+		}
+		contentType = jsonType
+	}
+
+	h := w.Header()
+	h.Set("Content-Type", contentType)
+	h.Set("Content-Length", strconv.Itoa(len(body)))
+	w.WriteHeader(status)
+	_, err := w.Write(body)
+	return err
+}
+
+// Negotiate chooses the response format of WriteResponse from the Accept
+// header of each request: JSON when the client prefers application/json,
+// ContentType otherwise. Requests that accept neither get 406 Not Acceptable.
+func Negotiate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		useJSON, ok := negotiate(r.Header.Values("Accept"))
+		if !ok {
+			http.Error(w, "not acceptable: use "+ContentType+" or "+jsonType, http.StatusNotAcceptable)
+			return
+		}
+		w.Header().Add("Vary", "Accept")
+		next.ServeHTTP(&negotiatedWriter{ResponseWriter: w, json: useJSON}, r)
+	})
+}
+
+// negotiatedWriter carries the format chosen by Negotiate to WriteResponse.
+type negotiatedWriter struct {
+	http.ResponseWriter
+	json bool
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (w *negotiatedWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// negotiatedJSON reports whether Negotiate picked JSON for w, following the
+// Unwrap chain of middleware that wrap the writer after Negotiate.
+func negotiatedJSON(w http.ResponseWriter) bool {
+	for {
+		if nw, ok := w.(*negotiatedWriter); ok {
+			return nw.json
+		}
+		u, ok := w.(interface{ Unwrap() http.ResponseWriter })
+		if !ok {
+			return false
+		}
+		w = u.Unwrap()
+	}
+}
+
+// negotiate returns whether JSON is preferred over ContentType by the Accept
+// header values, and whether either is acceptable at all. Binary wins ties.
+func negotiate(accept []string) (useJSON, ok bool) {
+	if len(accept) == 0 {
+		return false, true
+	}
+	// Explicit entries win over wildcards, even with q=0.
+	var binQ, jsonQ, anyQ float64
+	var binSet, jsonSet bool
+	for _, value := range accept {
+		for _, part := range strings.Split(value, ",") {
+			media, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+			if err != nil {
+				continue
+			}
+			q := 1.0
+			if s, found := params["q"]; found {
+				if q, err = strconv.ParseFloat(s, 64); err != nil {
+					continue
+				}
+			}
+			switch media {
+			case ContentType:
+				binQ, binSet = max(binQ, q), true
+			case jsonType:
+				jsonQ, jsonSet = max(jsonQ, q), true
+			case "application/*", "*/*":
+				anyQ = max(anyQ, q)
+			}
+		}
+	}
+	if !binSet {
+		binQ = anyQ
+	}
+	if !jsonSet {
+		jsonQ = anyQ
+	}
+	return jsonQ > binQ, binQ > 0 || jsonQ > 0
+}
@@ -0,0 +1,176 @@
+package binhttp
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/tinywasm/binary"
+)
+
+type item struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+func encode(t *testing.T, v any) []byte {
+	t.Helper()
+	var b []byte
+	if err := binary.Encode(v, &b); err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestDecodeRequest(t *testing.T) {
+	want := item{ID: 1, Name: "pen"}
+
+	t.Run("Binary", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(encode(t, &want)))
+		r.Header.Set("Content-Type", ContentType)
+		var got item
+		if err := DecodeRequest(r, &got); err != nil || got != want {
+			t.Fatalf("got %+v, %v", got, err)
+		}
+	})
+
+	t.Run("JSON", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"id":1,"name":"pen"}`))
+		r.Header.Set("Content-Type", "application/json; charset=utf-8")
+		var got item
+		if err := DecodeRequest(r, &got); err != nil || got != want {
+			t.Fatalf("got %+v, %v", got, err)
+		}
+	})
+
+	t.Run("WrongContentType", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader("x"))
+		r.Header.Set("Content-Type", "text/plain")
+		if err := DecodeRequest(r, &item{}); !errors.Is(err, ErrUnsupportedMediaType) {
+			t.Fatalf("expected ErrUnsupportedMediaType, got %v", err)
+		}
+	})
+
+	t.Run("TooLarge", func(t *testing.T) {
+		defer func(n int64) { MaxBodySize = n }(MaxBodySize)
+		MaxBodySize = 4
+		r := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(encode(t, &want)))
+		r.Header.Set("Content-Type", ContentType)
+		if err := DecodeRequest(r, &item{}); !errors.Is(err, binary.ErrTooLarge) {
+			t.Fatalf("expected ErrTooLarge, got %v", err)
+		}
+	})
+}
+
+func TestWriteResponse(t *testing.T) {
+	rec := httptest.NewRecorder()
+	if err := WriteResponse(rec, http.StatusCreated, &item{ID: 2, Name: "ink"}); err != nil {
+		t.Fatal(err)
+	}
+	if rec.Code != http.StatusCreated || rec.Header().Get("Content-Type") != ContentType {
+		t.Fatalf("status %d, content type %q", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	var got item
+	if err := binary.Decode(rec.Body.Bytes(), &got); err != nil || got != (item{2, "ink"}) {
+		t.Fatalf("got %+v, %v", got, err)
+	}
+
+	rec = httptest.NewRecorder()
+	if err := WriteResponse(rec, http.StatusOK, make(chan int)); err == nil {
+		t.Fatal("expected encode error")
+	}
+	if rec.Body.Len() != 0 {
+		t.Fatal("nothing should be written when encoding fails")
+	}
+}
+
+func TestNegotiate(t *testing.T) {
+	handler := Negotiate(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		WriteResponse(w, http.StatusOK, &item{ID: 3, Name: "cap"})
+	}))
+	srv := httptest.NewServer(handler)
+	defer srv.Close()
+
+	for _, tc := range []struct {
+		accept, contentType string
+		status              int
+	}{
+		{"", ContentType, http.StatusOK},
+		{"*/*", ContentType, http.StatusOK},
+		{"application/json", "application/json", http.StatusOK},
+		{ContentType + ";q=0.5, application/json", "application/json", http.StatusOK},
+		{ContentType + ", application/json;q=0.9", ContentType, http.StatusOK},
+		{"application/json;q=0.5, */*", ContentType, http.StatusOK},
+		{"application/json;q=0, */*", ContentType, http.StatusOK},
+		{ContentType + ";q=0, */*", "application/json", http.StatusOK},
+		{ContentType + ";q=0, application/json;q=0, */*", "", http.StatusNotAcceptable},
+		{"text/html", "", http.StatusNotAcceptable},
+	} {
+		req, _ := http.NewRequest(http.MethodGet, srv.URL, nil)
+		if tc.accept != "" {
+			req.Header.Set("Accept", tc.accept)
+		}
+		res, err := srv.Client().Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var body bytes.Buffer
+		body.ReadFrom(res.Body)
+		res.Body.Close()
+
+		if res.StatusCode != tc.status {
+			t.Errorf("Accept %q: status %d, want %d", tc.accept, res.StatusCode, tc.status)
+			continue
+		}
+		if tc.status != http.StatusOK {
+			continue
+		}
+		if ct := res.Header.Get("Content-Type"); ct != tc.contentType {
+			t.Errorf("Accept %q: content type %q, want %q", tc.accept, ct, tc.contentType)
+		}
+		if tc.contentType == "application/json" && body.String() != `{"id":3,"name":"cap"}` {
+			t.Errorf("Accept %q: body %s", tc.accept, body.String())
+		}
+	}
+}
+
+// loggingWriter stands for middleware that wraps the writer after Negotiate.
+type loggingWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *loggingWriter) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *loggingWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func TestNegotiateWrappedWriter(t *testing.T) {
+	var logged *loggingWriter
+	handler := Negotiate(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		logged = &loggingWriter{ResponseWriter: w}
+		WriteResponse(logged, http.StatusCreated, &item{ID: 4, Name: "ink"})
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Accept", "application/json")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("content type %q, want application/json", ct)
+	}
+	if rec.Body.String() != `{"id":4,"name":"ink"}` {
+		t.Errorf("body %s", rec.Body.String())
+	}
+	if logged.status != http.StatusCreated {
+		t.Errorf("status %d went around the wrapper", logged.status)
+	}
+}
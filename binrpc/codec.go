@@ -0,0 +1,121 @@
+// Package binrpc implements net/rpc codecs that carry requests, responses and
+// their bodies as binary frames instead of gob. It lives apart from the core
+// package so TinyGo and WebAssembly builds don't link net/rpc.
+package binrpc
+
+import (
+	"bufio"
+	"io"
+	"net/rpc"
+
+	"github.com/tinywasm/binary"
+)
+
+// header is the wire form of rpc.Request and rpc.Response.
+type header struct {
+	ServiceMethod string
+	Seq           uint64
+	Error         string
+}
+
+// NewServerCodec returns an rpc.ServerCodec over conn with default options.
+func NewServerCodec(conn io.ReadWriteCloser) rpc.ServerCodec {
+	return NewServerCodecWith(binary.New(), conn)
+}
+
+// NewClientCodec returns an rpc.ClientCodec over conn with default options.
+func NewClientCodec(conn io.ReadWriteCloser) rpc.ClientCodec {
+	return NewClientCodecWith(binary.New(), conn)
+}
+
+// NewServerCodecWith is NewServerCodec with a codec configured by the caller,
+// e.g. binary.New(binary.WithChecksum()). Both ends must use the same options.
+func NewServerCodecWith(c *binary.Codec, conn io.ReadWriteCloser) rpc.ServerCodec {
+	return &serverCodec{stream: newStream(c, conn)}
+}
+
+// NewClientCodecWith is NewClientCodec with a codec configured by the caller.
+func NewClientCodecWith(c *binary.Codec, conn io.ReadWriteCloser) rpc.ClientCodec {
+	return &clientCodec{stream: newStream(c, conn)}
+}
+
+// stream writes and reads frames on a connection. net/rpc serializes calls to
+// the write methods and to the read methods, so no locking is needed here.
+type stream struct {
+	codec *binary.Codec
+	conn  io.ReadWriteCloser
+	r     *bufio.Reader
+	w     *bufio.Writer
+}
+
+func newStream(c *binary.Codec, conn io.ReadWriteCloser) stream {
+	return stream{codec: c, conn: conn, r: bufio.NewReader(conn), w: bufio.NewWriter(conn)}
+}
+
+// write sends a header and body pair. A body that fails to encode leaves the
+// stream without a frame boundary, so the connection is closed.
+func (s *stream) write(h *header, body any) error {
+	if err := s.codec.WriteFrame(s.w, h); err != nil {
+		return err
+	}
+	if err := s.codec.WriteFrame(s.w, body); err != nil {
+		s.w.Flush()
+		s.conn.Close()
+		return err
+	}
+	return s.w.Flush()
+}
+
+// readBody decodes the next frame into body, or skips it when body is nil.
+func (s *stream) readBody(body any) error {
+	if body == nil {
+		return s.codec.SkipFrame(s.r)
+	}
+	return s.codec.ReadFrame(s.r, body)
+}
+
+func (s *stream) Close() error {
+	return s.conn.Close()
+}
+
+type serverCodec struct {
+	stream
+}
+
+func (c *serverCodec) ReadRequestHeader(r *rpc.Request) error {
+	var h header
+	if err := c.codec.ReadFrame(c.r, &h); err != nil {
+		return err
+	}
+	r.ServiceMethod, r.Seq = h.ServiceMethod, h.Seq
+	return nil
+}
+
+func (c *serverCodec) ReadRequestBody(body any) error {
+	return c.readBody(body)
+}
+
+func (c *serverCodec) WriteResponse(r *rpc.Response, body any) error {
+	return c.write(&header{ServiceMethod: r.ServiceMethod, Seq: r.Seq, Error: r.Error}, body)
+}
+
+type clientCodec struct {
+	stream
+}
+
+func (c *clientCodec) WriteRequest(r *rpc.Request, body any) error {
+	return c.write(&header{ServiceMethod: r.ServiceMethod, Seq: r.Seq}, body)
+}
+
+func (c *clientCodec) ReadResponseHeader(r *rpc.Response) error {
+	var h header
+	if err := c.codec.ReadFrame(c.r, &h); err != nil {
+		return err
+	}
+	r.ServiceMethod, r.Seq, r.Error = h.ServiceMethod, h.Seq, h.Error
+	return nil
+}
+
+func (c *clientCodec) ReadResponseBody(body any) error {
+	return c.readBody(body)
+}
@@ -0,0 +1,106 @@
+package binrpc
+
+import (
+	"errors"
+	"net"
+	"net/rpc"
+	"testing"
+
+	"github.com/tinywasm/binary"
+)
+
+type Args struct {
+	A, B int
+}
+
+type Quotient struct {
+	Quo, Rem int
+}
+
+type Arith int
+
+func (*Arith) Multiply(args *Args, reply *int) error {
+	*reply = args.A * args.B
+	return nil
+}
+
+func (*Arith) Divide(args *Args, q *Quotient) error {
+	if args.B == 0 {
+		return errors.New("divide by zero")
+	}
+	q.Quo, q.Rem = args.A/args.B, args.A%args.B
+	return nil
+}
+
+func newPipeClient(t *testing.T, c *binary.Codec) *rpc.Client {
+	t.Helper()
+	srv := rpc.NewServer()
+	if err := srv.Register(new(Arith)); err != nil {
+		t.Fatal(err)
+	}
+	srvConn, cliConn := net.Pipe()
+	go srv.ServeCodec(NewServerCodecWith(c, srvConn))
+	client := rpc.NewClientWithCodec(NewClientCodecWith(c, cliConn))
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+func TestCodecOverPipe(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		codec *binary.Codec
+	}{
+		{"Default", binary.New()},
+		{"Checksum", binary.New(binary.WithChecksum())},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			client := newPipeClient(t, tc.codec)
+
+			var product int
+			if err := client.Call("Arith.Multiply", &Args{7, 8}, &product); err != nil || product != 56 {
+				t.Fatalf("Multiply: %d, %v", product, err)
+			}
+
+			var q Quotient
+			if err := client.Call("Arith.Divide", &Args{17, 5}, &q); err != nil || q != (Quotient{3, 2}) {
+				t.Fatalf("Divide: %+v, %v", q, err)
+			}
+
+			err := client.Call("Arith.Divide", &Args{1, 0}, &q)
+			if err == nil || err.Error() != "divide by zero" {
+				t.Fatalf("expected server error, got %v", err)
+			}
+
+			// Unknown methods are answered with an error and an empty body the
+			// client must skip; the connection stays usable.
+			if err := client.Call("Arith.Missing", &Args{}, &product); err == nil {
+				t.Fatal("expected error for unknown method")
+			}
+
+			calls := make([]*rpc.Call, 10)
+			for i := range calls {
+				calls[i] = client.Go("Arith.Multiply", &Args{i, i}, new(int), nil)
+			}
+			for i, call := range calls {
+				<-call.Done
+				if call.Error != nil || *call.Reply.(*int) != i*i {
+					t.Fatalf("concurrent call %d: %v %v", i, *call.Reply.(*int), call.Error)
+				}
+			}
+		})
+	}
+}
+
+func TestDefaultCodecs(t *testing.T) {
+	srv := rpc.NewServer()
+	srv.Register(new(Arith))
+	srvConn, cliConn := net.Pipe()
+	go srv.ServeCodec(NewServerCodec(srvConn))
+	client := rpc.NewClientWithCodec(NewClientCodec(cliConn))
+	defer client.Close()
+
+	var product int
+	if err := client.Call("Arith.Multiply", &Args{3, 4}, &product); err != nil || product != 12 {
+		t.Fatalf("Multiply: %d, %v", product, err)
+	}
+}
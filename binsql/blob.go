@@ -0,0 +1,60 @@
+// Package binsql stores values encoded in the binary format in database
+// columns. It lives apart from the core package so TinyGo and WebAssembly
+// builds don't link database/sql/driver.
+package binsql
+
+import (
+	"database/sql/driver"
+
+	"github.com/tinywasm/binary"
+	. "github.com/tinywasm/fmt"
+)
+
+// Blob stores a value of type T in a database BLOB column. It implements
+// driver.Valuer by encoding V and sql.Scanner by decoding it:
+//
+//	var b binsql.Blob[User]
+//	db.Exec("INSERT INTO users (data) VALUES (?)", binsql.Blob[User]{V: u})
+//	db.QueryRow("SELECT data FROM users").Scan(&b)
+type Blob[T any] struct {
+	V T
+}
+
+// Value encodes V for the driver.
+func (b Blob[T]) Value() (driver.Value, error) {
+	var out []byte
+	if err := binary.Encode(&b.V, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// Scan decodes a []byte or string column into V. The driver may reuse src
+// after Scan returns, and decoded []byte fields share the input's memory, so
+// src is copied first. A NULL column sets V to its zero value; columns larger
+// than DefaultMaxSize fail with ErrTooLarge.
+func (b *Blob[T]) Scan(src any) error {
+	var data []byte
+	switch s := src.(type) {
+	case nil:
+		var zero T
+		b.V = zero
+		return nil
+	case []byte:
+		data = s
+	case string:
+		data = []byte(s)
+	default:
+		return Err("Blob", "Scan", D.Type, D.Not, D.Supported)
+	}
+	if len(data) > binary.DefaultMaxSize {
+		return binary.ErrTooLarge
+	}
+
+	var v T
+	if err := binary.Decode(append([]byte(nil), data...), &v); err != nil {
+		return err
+	}
+	b.V = v
+	return nil
+}
@@ -0,0 +1,126 @@
+package binsql
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+// fakeBlobDriver is a database/sql driver with a single table of one column.
+// "INSERT" appends its argument and "SELECT" returns every row, handing out
+// the same buffer for each []byte value like real drivers are allowed to.
+type fakeBlobDriver struct {
+	mu   sync.Mutex
+	rows []driver.Value
+}
+
+func (d *fakeBlobDriver) Open(string) (driver.Conn, error) { return &fakeBlobConn{d}, nil }
+
+type fakeBlobConn struct{ d *fakeBlobDriver }
+
+func (c *fakeBlobConn) Prepare(query string) (driver.Stmt, error) {
+	return &fakeBlobStmt{c.d, query}, nil
+}
+func (c *fakeBlobConn) Close() error              { return nil }
+func (c *fakeBlobConn) Begin() (driver.Tx, error) { return nil, driver.ErrSkip }
+
+type fakeBlobStmt struct {
+	d     *fakeBlobDriver
+	query string
+}
+
+func (s *fakeBlobStmt) Close() error { return nil }
+func (s *fakeBlobStmt) NumInput() int {
+	if s.query == "INSERT" {
+		return 1
+	}
+	return 0
+}
+
+func (s *fakeBlobStmt) Exec(args []driver.Value) (driver.Result, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+	s.d.rows = append(s.d.rows, args[0])
+	return driver.RowsAffected(1), nil
+}
+
+func (s *fakeBlobStmt) Query([]driver.Value) (driver.Rows, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+	return &fakeBlobRows{rows: append([]driver.Value(nil), s.d.rows...), buf: make([]byte, 0, 256)}, nil
+}
+
+type fakeBlobRows struct {
+	rows []driver.Value
+	buf  []byte
+}
+
+func (r *fakeBlobRows) Columns() []string { return []string{"data"} }
+func (r *fakeBlobRows) Close() error      { return nil }
+
+func (r *fakeBlobRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	v := r.rows[0]
+	r.rows = r.rows[1:]
+	if b, ok := v.([]byte); ok {
+		r.buf = append(r.buf[:0], b...)
+		v = r.buf
+	}
+	dest[0] = v
+	return nil
+}
+
+type blobUser struct {
+	Name   string
+	Avatar []byte
+}
+
+func TestBlob(t *testing.T) {
+	assertNoError := func(err error) {
+		t.Helper()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	sql.Register("fakeblob", &fakeBlobDriver{})
+	db, err := sql.Open("fakeblob", "")
+	assertNoError(err)
+	defer db.Close()
+
+	users := []blobUser{{"alice", []byte{1, 2, 3}}, {"bob", []byte{9, 9, 9, 9, 9, 9}}}
+	for _, u := range users {
+		_, err := db.Exec("INSERT", Blob[blobUser]{V: u})
+		assertNoError(err)
+	}
+	_, err = db.Exec("INSERT", nil)
+	assertNoError(err)
+
+	rows, err := db.Query("SELECT")
+	assertNoError(err)
+	var got []Blob[blobUser]
+	for rows.Next() {
+		var b Blob[blobUser]
+		assertNoError(rows.Scan(&b))
+		got = append(got, b)
+	}
+	assertNoError(rows.Err())
+
+	// The driver reuses its buffer between rows: earlier values must not change.
+	if len(got) != 3 || !reflect.DeepEqual(got[0].V, users[0]) || !reflect.DeepEqual(got[1].V, users[1]) || !reflect.DeepEqual(got[2].V, blobUser{}) {
+		t.Fatalf("unexpected rows %+v", got)
+	}
+
+	var b Blob[blobUser]
+	if err := b.Scan(42); err == nil {
+		t.Fatal("expected error for an int column")
+	}
+	if err := b.Scan([]byte{0xff}); err == nil {
+		t.Fatal("expected error for a corrupt blob")
+	}
+}
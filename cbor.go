@@ -0,0 +1,218 @@
+package binary
+
+import (
+	"math"
+
+	. "github.com/tinywasm/fmt"
+)
+
+// CBOR major types (RFC 8949, section 3.1).
+const (
+	cborUint   = 0 << 5
+	cborNegInt = 1 << 5
+	cborBytes  = 2 << 5
+	cborText   = 3 << 5
+	cborArray  = 4 << 5
+	cborMap    = 5 << 5
+	cborTag    = 6 << 5
+	cborSimple = 7 << 5
+)
+
+// CBOR simple values and float heads.
+const (
+	cborFalse   = cborSimple | 20
+	cborTrue    = cborSimple | 21
+	cborNull    = cborSimple | 22
+	cborUndef   = cborSimple | 23
+	cborFloat16 = cborSimple | 25
+	cborFloat32 = cborSimple | 26
+	cborFloat64 = cborSimple | 27
+)
+
+// cborWriter writes definite-length CBOR items with the shortest heads.
+type cborWriter struct{}
+
+func (cborWriter) appendNil(b []byte) []byte { return append(b, cborNull) }
+
+func (cborWriter) appendBool(b []byte, v bool) []byte {
+	if v {
+		return append(b, cborTrue)
+	}
+	return append(b, cborFalse)
+}
+
+func (cborWriter) appendInt(b []byte, v int64) []byte {
+	if v < 0 {
+		return appendCBORHead(b, cborNegInt, uint64(-1-v))
+	}
+	return appendCBORHead(b, cborUint, uint64(v))
+}
+
+func (cborWriter) appendUint(b []byte, v uint64) []byte {
+	return appendCBORHead(b, cborUint, v)
+}
+
+func (cborWriter) appendFloat32(b []byte, v float32) []byte {
+	return appendBigEndian(append(b, cborFloat32), uint64(math.Float32bits(v)), 4)
+}
+
+func (cborWriter) appendFloat64(b []byte, v float64) []byte {
+	return appendBigEndian(append(b, cborFloat64), math.Float64bits(v), 8)
+}
+
+func (cborWriter) appendString(b []byte, s string) []byte {
+	return append(appendCBORHead(b, cborText, uint64(len(s))), s...)
+}
+
+func (cborWriter) appendBytes(b []byte, v []byte) []byte {
+	return append(appendCBORHead(b, cborBytes, uint64(len(v))), v...)
+}
+
+func (cborWriter) appendArray(b []byte, n int) []byte {
+	return appendCBORHead(b, cborArray, uint64(n))
+}
+
+func (cborWriter) appendMap(b []byte, n int) []byte {
+	return appendCBORHead(b, cborMap, uint64(n))
+}
+
+// appendCBORHead appends the initial byte of major type major with argument
+// v, followed by as many bytes as v needs.
+func appendCBORHead(b []byte, major byte, v uint64) []byte {
+	switch {
+	case v < 24:
+		return append(b, major|byte(v))
+	case v <= math.MaxUint8:
+		return append(b, major|24, byte(v))
+	case v <= math.MaxUint16:
+		return appendBigEndian(append(b, major|25), v, 2)
+	case v <= math.MaxUint32:
+		return appendBigEndian(append(b, major|26), v, 4)
+	}
+	return appendBigEndian(append(b, major|27), v, 8)
+}
+
+// cborReader reads CBOR items. Tags are skipped, undefined reads as null and
+// half-precision floats are widened; indefinite-length items are rejected.
+type cborReader struct{}
+
+func (cborReader) next(r *sliceReader) (item, error) {
+	for {
+		head, err := r.ReadByte()
+		if err != nil {
+			return item{}, errItemTruncated(FormatCBOR)
+		}
+		major, info := head&0xe0, head&0x1f
+
+		if major == cborSimple {
+			return readCBORSimple(r, head)
+		}
+		if info == 31 {
+			return item{}, Err("CBOR", "indefinite-length items", D.Not, D.Supported)
+		}
+		arg, err := readCBORArgument(r, info)
+		if err != nil {
+			return item{}, err
+		}
+
+		switch major {
+		case cborUint:
+			return item{kind: itemUint, u: arg}, nil
+		case cborNegInt:
+			if arg > math.MaxInt64 {
+				return item{}, Err("CBOR", "integer", D.Out, D.Of, D.Range)
+			}
+			return item{kind: itemInt, i: -1 - int64(arg)}, nil
+		case cborBytes, cborText:
+			l, err := readItemLength(r, arg, FormatCBOR)
+			if err != nil {
+				return item{}, err
+			}
+			data, _ := r.Slice(l)
+			if major == cborText {
+				return item{kind: itemString, data: data}, nil
+			}
+			return item{kind: itemBytes, data: data}, nil
+		case cborArray:
+			n, err := readItemLength(r, arg, FormatCBOR)
+			return item{kind: itemArray, n: n}, err
+		case cborMap:
+			// Each entry takes at least two bytes.
+			if arg > uint64(r.Len()/2) {
+				return item{}, errItemTruncated(FormatCBOR)
+			}
+			return item{kind: itemMap, n: int(arg)}, nil
+		}
+		// cborTag: the tagged item follows.
+	}
+}
+
+// readCBORArgument reads the argument of a head with additional info info.
+func readCBORArgument(r *sliceReader, info byte) (uint64, error) {
+	if info < 24 {
+		return uint64(info), nil
+	}
+	if info > 27 {
+		return 0, Err("CBOR", "additional info", Convert(int(info)).String(), D.Invalid)
+	}
+	b, err := r.Slice(1 << (info - 24))
+	if err != nil {
+		return 0, errItemTruncated(FormatCBOR)
+	}
+	return readBigEndian(b), nil
+}
+
+// readCBORSimple reads the simple value or float of head.
+func readCBORSimple(r *sliceReader, head byte) (item, error) {
+	var size int
+	switch head {
+	case cborFalse, cborTrue:
+		return item{kind: itemBool, b: head == cborTrue}, nil
+	case cborNull, cborUndef:
+		return item{kind: itemNil}, nil
+	case cborFloat16:
+		size = 2
+	case cborFloat32:
+		size = 4
+	case cborFloat64:
+		size = 8
+	default:
+		return item{}, Err("CBOR", "simple value", Convert(int(head&0x1f)).String(), D.Not, D.Supported)
+	}
+
+	b, err := r.Slice(size)
+	if err != nil {
+		return item{}, errItemTruncated(FormatCBOR)
+	}
+	bits := readBigEndian(b)
+	switch size {
+	case 2:
+		return item{kind: itemFloat, f: float16ToFloat64(uint16(bits))}, nil
+	case 4:
+		return item{kind: itemFloat, f: float64(math.Float32frombits(uint32(bits)))}, nil
+	}
+	return item{kind: itemFloat, f: math.Float64frombits(bits)}, nil
+}
+
+// float16ToFloat64 converts IEEE 754 half-precision bits to a float64.
+func float16ToFloat64(h uint16) float64 {
+	exp := int(h>>10) & 0x1f
+	mant := float64(h & 0x3ff)
+	var f float64
+	switch exp {
+	case 0:
+		f = math.Ldexp(mant, -24)
+	case 0x1f:
+		if mant == 0 {
+			f = math.Inf(1)
+		} else {
+			f = math.NaN()
+		}
+	default:
+		f = math.Ldexp(mant+1024, exp-25)
+	}
+	if h&0x8000 != 0 {
+		return -f
+	}
+	return f
+}
@@ -0,0 +1,208 @@
+package binary
+
+import (
+	"bytes"
+	"math"
+	"reflect"
+	"testing"
+)
+
+type itemPoint struct {
+	X int  `json:"x"`
+	Y uint `binary:"-"`
+	Z uint16
+}
+
+type itemRecord struct {
+	Name   string            `json:"name"`
+	Age    int8              `json:"age"`
+	Tags   []string          `json:"tags"`
+	Parent *itemPoint        `json:"parent"`
+	Raw    []byte            `json:"raw"`
+	Score  float64           `json:"score"`
+	Ratio  float32           `json:"ratio"`
+	OK     bool              `json:"ok"`
+	Counts map[string]uint32 `json:"counts"`
+	Grid   [2]int16          `json:"grid"`
+	Hidden string            `json:"-"`
+}
+
+func formatEncode(c *Codec, v any) ([]byte, error) {
+	var data []byte
+	err := c.Encode(v, &data)
+	return data, err
+}
+
+func TestCBORVectors(t *testing.T) {
+	c := New(WithFormat(FormatCBOR))
+
+	// RFC 8949, Appendix A.
+	ints := []struct {
+		v    int64
+		want []byte
+	}{
+		{0, []byte{0x00}},
+		{23, []byte{0x17}},
+		{24, []byte{0x18, 0x18}},
+		{100, []byte{0x18, 0x64}},
+		{1000, []byte{0x19, 0x03, 0xe8}},
+		{1000000, []byte{0x1a, 0x00, 0x0f, 0x42, 0x40}},
+		{1000000000000, []byte{0x1b, 0x00, 0x00, 0x00, 0xe8, 0xd4, 0xa5, 0x10, 0x00}},
+		{-1, []byte{0x20}},
+		{-10, []byte{0x29}},
+		{-100, []byte{0x38, 0x63}},
+		{-1000, []byte{0x39, 0x03, 0xe7}},
+	}
+	for _, tt := range ints {
+		got, err := formatEncode(c, &tt.v)
+		assertNoError(t, err)
+		assertEqualBytes(t, tt.want, got)
+
+		var back int64
+		assertNoError(t, c.Decode(got, &back))
+		assertEqual(t, tt.v, back)
+	}
+
+	u := uint64(18446744073709551615)
+	got, err := formatEncode(c, &u)
+	assertNoError(t, err)
+	assertEqualBytes(t, []byte{0x1b, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}, got)
+
+	f := 1.1
+	got, err = formatEncode(c, &f)
+	assertNoError(t, err)
+	assertEqualBytes(t, []byte{0xfb, 0x3f, 0xf1, 0x99, 0x99, 0x99, 0x99, 0x99, 0x9a}, got)
+
+	s := "IETF"
+	got, err = formatEncode(c, &s)
+	assertNoError(t, err)
+	assertEqualBytes(t, []byte{0x64, 0x49, 0x45, 0x54, 0x46}, got)
+
+	got, err = formatEncode(c, &itemPoint{X: -1, Y: 9, Z: 500})
+	assertNoError(t, err)
+	assertEqualBytes(t, []byte{0xa2, 0x61, 'x', 0x20, 0x61, 'Z', 0x19, 0x01, 0xf4}, got)
+}
+
+func TestCBORDecodeFloats(t *testing.T) {
+	c := New(WithFormat(FormatCBOR))
+	tests := []struct {
+		data []byte
+		want float64
+	}{
+		{[]byte{0xf9, 0x3c, 0x00}, 1},
+		{[]byte{0xf9, 0x7b, 0xff}, 65504},
+		{[]byte{0xf9, 0x00, 0x01}, 5.960464477539063e-8},
+		{[]byte{0xf9, 0xc4, 0x00}, -4},
+		{[]byte{0xf9, 0x7c, 0x00}, math.Inf(1)},
+		{[]byte{0xfa, 0x47, 0xc3, 0x50, 0x00}, 100000},
+		{[]byte{0x18, 0x64}, 100}, // integers are accepted for floats
+	}
+	for _, tt := range tests {
+		var got float64
+		assertNoError(t, c.Decode(tt.data, &got))
+		assertEqual(t, tt.want, got)
+	}
+}
+
+func TestCBORRoundTrip(t *testing.T) {
+	for _, format := range []Format{FormatCBOR, FormatMsgPack} {
+		c := New(WithFormat(format))
+		in := itemRecord{
+			Name:   "Ada",
+			Age:    -36,
+			Tags:   []string{"a", "", "c"},
+			Parent: &itemPoint{X: 1 << 40, Z: 65535},
+			Raw:    []byte{0, 0xff},
+			Score:  math.Pi,
+			Ratio:  0.5,
+			OK:     true,
+			Counts: map[string]uint32{"x": 1, "y": 1 << 31},
+			Grid:   [2]int16{-32768, 32767},
+			Hidden: "dropped",
+		}
+		data, err := formatEncode(c, &in)
+		assertNoError(t, err)
+
+		var out itemRecord
+		assertNoError(t, c.Decode(data, &out))
+		in.Hidden = ""
+		if !reflect.DeepEqual(in, out) {
+			t.Fatalf("%s: got %+v, want %+v", formatName(format), out, in)
+		}
+
+		// Streams and nil values.
+		var buf bytes.Buffer
+		assertNoError(t, c.Encode(&itemRecord{}, &buf))
+		var zero, native itemRecord
+		assertNoError(t, c.Decode(&buf, &zero))
+		nativeData, err := formatEncode(New(), &itemRecord{})
+		assertNoError(t, err)
+		assertNoError(t, New().Decode(nativeData, &native))
+		if !reflect.DeepEqual(native, zero) {
+			t.Fatalf("%s: zero value decoded as %+v, native as %+v", formatName(format), zero, native)
+		}
+	}
+}
+
+func TestCBORStructKeys(t *testing.T) {
+	c := New(WithFormat(FormatCBOR))
+
+	// Keys out of order, an unknown key holding a nested array and a
+	// missing field.
+	data := []byte{
+		0xa2,
+		0x61, 'Z', 0x05,
+		0x67, 'u', 'n', 'k', 'n', 'o', 'w', 'n', 0x82, 0x01, 0x81, 0x02,
+	}
+	var p itemPoint
+	p.X = 99
+	assertNoError(t, c.Decode(data, &p))
+	assertEqual(t, 0, p.X)
+	assertEqual(t, uint16(5), p.Z)
+
+	// Tags are skipped: tag 1 (epoch time) around an integer.
+	data = []byte{0xc1, 0x1a, 0x51, 0x4b, 0x67, 0xb0}
+	var epoch int64
+	assertNoError(t, c.Decode(data, &epoch))
+	assertEqual(t, int64(1363896240), epoch)
+}
+
+func TestCBORErrors(t *testing.T) {
+	c := New(WithFormat(FormatCBOR))
+	var p itemPoint
+	var r itemRecord
+	tests := []struct {
+		data   []byte
+		target any
+	}{
+		{[]byte{0xa1, 0x61, 'Z', 0x1a, 0x00, 0x01, 0x00, 0x00}, &p}, // 65536 overflows uint16
+		{[]byte{0xa1, 0x61, 'Z', 0x20}, &p},                         // negative into uint
+		{[]byte{0xa1, 0x63, 'a', 'g', 'e', 0x19, 0x01, 0x00}, &r},   // 256 overflows int8
+		{[]byte{0xa1, 0x61, 'x', 0x61, 'a'}, &p},                    // string into int
+		{[]byte{0xa1, 0x61, 'x', 0xf6}, &p},                         // null into int
+		{[]byte{0xa1, 0x61, 'Z'}, &p},                               // missing value
+		{[]byte{0x9f, 0xff}, &r},                                    // indefinite length
+		{[]byte{0xbb, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}, &p},
+		{[]byte{0xa0, 0x00}, &p}, // trailing bytes
+		{[]byte{0xa1, 0x01, 0x02}, &p},
+		{[]byte{0xa1, 0x64, 'g', 'r', 'i', 'd', 0x81, 0x01}, &r}, // array length
+	}
+	for _, tt := range tests {
+		if err := c.Decode(tt.data, tt.target); err == nil {
+			t.Fatalf("Decode(% x): expected error", tt.data)
+		}
+	}
+}
+
+func TestItemSchemaCache(t *testing.T) {
+	c := New(WithFormat(FormatCBOR))
+	_, err := formatEncode(c, &itemPoint{X: 1})
+	assertNoError(t, err)
+
+	first := c.tb.schemaOf(reflect.TypeOf(itemPoint{}))
+	second := c.tb.schemaOf(reflect.TypeOf(itemPoint{}))
+	if first != second {
+		t.Fatal("schema descriptor was not cached")
+	}
+	assertEqual(t, 2, len(first.Root().Fields))
+}
@@ -0,0 +1,311 @@
+// Command binary inspects, converts and validates payloads encoded with
+// github.com/tinywasm/binary without the Go types that produced them.
+//
+// Every subcommand reads the layout from a schema descriptor file, written
+// by the owning service either as binary or as JSON:
+//
+//	var desc []byte
+//	binary.Encode(binary.DescribeType(User{}), &desc) // binary descriptor
+//	js, _ := binary.ToJSON(desc, binary.Schema{})     // JSON descriptor
+//
+// Usage:
+//
+//	binary inspect     -schema FILE [-fingerprint] [-names] [PAYLOAD]
+//	binary tojson      -schema FILE [-fingerprint] [-names] [PAYLOAD]
+//	binary fromjson    -schema FILE [-fingerprint] [-names] [JSON]
+//	binary validate    -schema FILE [-fingerprint] [-names] [PAYLOAD]
+//	binary fingerprint -schema FILE [-names]
+//	binary gents       -schema FILE [-js]
+//	binary gengo       -schema FILE [-package NAME] [-codecs]
+//
+// Input is read from stdin when no file is given or the file is "-".
+// -fingerprint expects the 8-byte header written by WithFingerprint and
+// checks it against the schema before decoding; fromjson writes it.
+// gents prints TypeScript classes for the schema, or JavaScript with -js.
+// gengo prints Go structs for the schema, with reflection-free codecs when
+// -codecs is set.
+package main
+
+import (
+	"flag"
+	"io"
+	"os"
+	"strconv"
+
+	"github.com/tinywasm/binary"
+	. "github.com/tinywasm/fmt"
+)
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+const usage = `usage: binary <command> -schema FILE [flags] [INPUT]
+
+commands:
+  inspect      annotated dump of a payload
+  tojson       payload to JSON
+  fromjson     JSON to payload
+  validate     check that a payload decodes cleanly
+  fingerprint  print the schema fingerprint
+  gents        generate TypeScript (or JavaScript with -js) classes
+  gengo        generate Go structs (and codecs with -codecs)
+`
+
+// run executes the command line args and returns the process exit code:
+// 0 on success, 1 when the input does not match the schema, 2 on misuse.
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		io.WriteString(stderr, usage)
+		return 2
+	}
+	cmd := args[0]
+
+	fs := flag.NewFlagSet(cmd, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	schemaPath := fs.String("schema", "", "schema descriptor `file` (binary or JSON)")
+	withFP := fs.Bool("fingerprint", false, "payload starts with a fingerprint header")
+	names := fs.Bool("names", false, "fingerprint includes field names")
+	js := fs.Bool("js", false, "gents writes JavaScript instead of TypeScript")
+	pkg := fs.String("package", "types", "gengo package `name`")
+	codecs := fs.Bool("codecs", false, "gengo also writes reflection-free codecs")
+	if err := fs.Parse(args[1:]); err != nil {
+		return 2
+	}
+
+	switch cmd {
+	case "inspect", "tojson", "fromjson", "validate", "fingerprint", "gents", "gengo":
+	default:
+		io.WriteString(stderr, "binary: unknown command "+strconv.Quote(cmd)+"\n"+usage)
+		return 2
+	}
+	if *schemaPath == "" || fs.NArg() > 1 {
+		io.WriteString(stderr, usage)
+		return 2
+	}
+
+	schema, err := loadSchema(*schemaPath)
+	if err != nil {
+		return fail(stderr, err)
+	}
+
+	switch cmd {
+	case "fingerprint":
+		io.WriteString(stdout, hex64(schema.Fingerprint(*names))+"\n")
+		return 0
+	case "gents":
+		generate := binary.GenerateTypeScript
+		if *js {
+			generate = binary.GenerateJavaScript
+		}
+		out, err := generate(schema)
+		if err != nil {
+			return fail(stderr, err)
+		}
+		stdout.Write(out)
+		return 0
+	case "gengo":
+		out, err := binary.GenerateGo(binary.GoOptions{Package: *pkg, Codecs: *codecs}, schema)
+		if err != nil {
+			return fail(stderr, err)
+		}
+		stdout.Write(out)
+		return 0
+	}
+
+	input, err := readInput(fs.Arg(0), stdin)
+	if err != nil {
+		return fail(stderr, err)
+	}
+
+	if cmd == "fromjson" {
+		out, err := schema.FromJSON(input)
+		if err != nil {
+			return fail(stderr, err)
+		}
+		if *withFP {
+			out = insertFingerprint(schema, out, *names)
+		}
+		stdout.Write(out)
+		return 0
+	}
+
+	if *withFP {
+		if input, err = stripFingerprint(schema, input, *names); err != nil {
+			return fail(stderr, err)
+		}
+	}
+
+	switch cmd {
+	case "inspect":
+		io.WriteString(stdout, schema.Dump(input))
+		if schema.Validate(input) != nil {
+			return 1
+		}
+	case "tojson":
+		out, err := schema.ToJSON(input)
+		if err != nil {
+			return fail(stderr, err)
+		}
+		stdout.Write(append(out, '\n'))
+	case "validate":
+		if err := schema.Validate(input); err != nil {
+			return fail(stderr, err)
+		}
+		io.WriteString(stdout, "ok: "+strconv.Itoa(len(input))+" bytes match "+schema.Name+"\n")
+	}
+	return 0
+}
+
+func fail(stderr io.Writer, err error) int {
+	io.WriteString(stderr, "binary: "+err.Error()+"\n")
+	return 1
+}
+
+// loadSchema reads a schema descriptor, encoded either with this package or
+// as the JSON produced by ToJSON.
+func loadSchema(path string) (binary.Schema, error) {
+	var s binary.Schema
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return s, err
+	}
+	if isJSON(data) {
+		if data, err = binary.FromJSON(data, binary.Schema{}); err != nil {
+			return s, Err("schema", path+":", err)
+		}
+	}
+	if err = binary.Decode(data, &s); err != nil {
+		return s, Err("schema", path+":", err)
+	}
+	if len(s.Nodes) == 0 {
+		return s, Err("schema", path+":", "no nodes")
+	}
+	if err = checkNodes(s); err != nil {
+		return s, Err("schema", path+":", err.Error())
+	}
+	return s, nil
+}
+
+// checkNodes rejects descriptors the decoders cannot walk: Elem, Key and
+// field indexes outside Nodes, and cycles, which only a corrupt or crafted
+// file holds since DescribeType never writes them.
+func checkNodes(s binary.Schema) error {
+	const (
+		unvisited = iota
+		visiting
+		done
+	)
+	state := make([]uint8, len(s.Nodes))
+	var visit func(n int) error
+	visit = func(n int) error {
+		if n < 0 || n >= len(s.Nodes) {
+			return Err("node", strconv.Itoa(n), D.Out, D.Of, D.Range)
+		}
+		switch state[n] {
+		case visiting:
+			return Err("cycle at node", strconv.Itoa(n))
+		case done:
+			return nil
+		}
+		state[n] = visiting
+
+		var refs []int
+		node := &s.Nodes[n]
+		switch node.Kind {
+		case binary.KindPointer, binary.KindSlice, binary.KindArray:
+			refs = append(refs, node.Elem)
+		case binary.KindMap:
+			refs = append(refs, node.Key, node.Elem)
+		case binary.KindStruct:
+			for _, f := range node.Fields {
+				refs = append(refs, f.Type)
+			}
+		}
+		for _, r := range refs {
+			if err := visit(r); err != nil {
+				return err
+			}
+		}
+		state[n] = done
+		return nil
+	}
+	for n := range s.Nodes {
+		if err := visit(n); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// isJSON reports whether data starts, after white space, with a JSON object.
+func isJSON(data []byte) bool {
+	for _, c := range data {
+		switch c {
+		case ' ', '\t', '\r', '\n':
+			continue
+		}
+		return c == '{'
+	}
+	return false
+}
+
+func readInput(path string, stdin io.Reader) ([]byte, error) {
+	if path == "" || path == "-" {
+		return io.ReadAll(stdin)
+	}
+	return os.ReadFile(path)
+}
+
+// headerLen returns the length of the version header that precedes the
+// fingerprint in versioned payloads.
+func headerLen(s binary.Schema, data []byte) int {
+	if !s.Versioned {
+		return 0
+	}
+	for i, c := range data {
+		if c < 0x80 {
+			return i + 1
+		}
+	}
+	return len(data)
+}
+
+// stripFingerprint checks the fingerprint header of data against the schema
+// and returns the payload without it.
+func stripFingerprint(s binary.Schema, data []byte, names bool) ([]byte, error) {
+	at := headerLen(s, data)
+	if len(data) < at+8 {
+		return nil, Err("payload too short for a fingerprint header")
+	}
+	var got uint64
+	for i := 7; i >= 0; i-- {
+		got = got<<8 | uint64(data[at+i])
+	}
+	if want := s.Fingerprint(names); got != want {
+		return nil, &binary.SchemaMismatchError{Type: s.Name, Expected: want, Got: got}
+	}
+	out := make([]byte, 0, len(data)-8)
+	out = append(out, data[:at]...)
+	return append(out, data[at+8:]...), nil
+}
+
+// insertFingerprint adds the fingerprint header of the schema to data.
+func insertFingerprint(s binary.Schema, data []byte, names bool) []byte {
+	at := headerLen(s, data)
+	fp := s.Fingerprint(names)
+	out := make([]byte, 0, len(data)+8)
+	out = append(out, data[:at]...)
+	for i := 0; i < 8; i++ {
+		out = append(out, byte(fp>>(8*i)))
+	}
+	return append(out, data[at:]...)
+}
+
+func hex64(v uint64) string {
+	s := strconv.FormatUint(v, 16)
+	for len(s) < 16 {
+		s = "0" + s
+	}
+	return "0x" + s
+}
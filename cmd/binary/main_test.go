@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/tinywasm/binary"
+)
+
+type cliUser struct {
+	Name string
+	Age  int
+	Tags []string
+}
+
+// cliFixture writes a binary and a JSON schema descriptor of cliUser and an
+// encoded payload, and returns their paths.
+func cliFixture(t *testing.T) (schemaBin, schemaJSON, payload string) {
+	t.Helper()
+	dir := t.TempDir()
+
+	var desc []byte
+	if err := binary.Encode(binary.DescribeType(cliUser{}), &desc); err != nil {
+		t.Fatal(err)
+	}
+	js, err := binary.ToJSON(desc, binary.Schema{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var data []byte
+	if err := binary.Encode(&cliUser{Name: "Alice", Age: 30, Tags: []string{"x"}}, &data); err != nil {
+		t.Fatal(err)
+	}
+
+	schemaBin = filepath.Join(dir, "user.schema")
+	schemaJSON = filepath.Join(dir, "user.schema.json")
+	payload = filepath.Join(dir, "user.bin")
+	for path, b := range map[string][]byte{schemaBin: desc, schemaJSON: js, payload: data} {
+		if err := os.WriteFile(path, b, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return
+}
+
+func runCLI(stdin []byte, args ...string) (code int, stdout, stderr string) {
+	var out, errOut bytes.Buffer
+	code = run(args, bytes.NewReader(stdin), &out, &errOut)
+	return code, out.String(), errOut.String()
+}
+
+func TestCLI(t *testing.T) {
+	schemaBin, schemaJSON, payload := cliFixture(t)
+	data, _ := os.ReadFile(payload)
+
+	t.Run("Inspect", func(t *testing.T) {
+		code, out, _ := runCLI(nil, "inspect", "-schema", schemaJSON, payload)
+		if code != 0 || !strings.Contains(out, `Name (string, len=5) "Alice"`) {
+			t.Fatalf("code %d, output:\n%s", code, out)
+		}
+		code, out, _ = runCLI(data[:6], "inspect", "-schema", schemaBin)
+		if code != 1 || !strings.Contains(out, ">> 0x0006 Age (int) error") {
+			t.Fatalf("truncated payload: code %d, output:\n%s", code, out)
+		}
+	})
+
+	t.Run("JSONRoundTrip", func(t *testing.T) {
+		code, js, stderr := runCLI(nil, "tojson", "-schema", schemaBin, payload)
+		if code != 0 || strings.TrimSpace(js) != `{"Name":"Alice","Age":30,"Tags":["x"]}` {
+			t.Fatalf("tojson: code %d, %q %s", code, js, stderr)
+		}
+		code, back, stderr := runCLI([]byte(js), "fromjson", "-schema", schemaBin, "-")
+		if code != 0 || back != string(data) {
+			t.Fatalf("fromjson: code %d, % x %s", code, back, stderr)
+		}
+	})
+
+	t.Run("Validate", func(t *testing.T) {
+		if code, out, stderr := runCLI(nil, "validate", "-schema", schemaBin, payload); code != 0 || !strings.HasPrefix(out, "ok:") {
+			t.Fatalf("code %d, %q %s", code, out, stderr)
+		}
+		if code, _, stderr := runCLI(append(data, 0), "validate", "-schema", schemaBin); code != 1 || !strings.Contains(stderr, "trailing") {
+			t.Fatalf("trailing byte: code %d, %s", code, stderr)
+		}
+	})
+
+	t.Run("Fingerprint", func(t *testing.T) {
+		want := binary.DescribeType(cliUser{}).Fingerprint(true)
+		code, out, _ := runCLI(nil, "fingerprint", "-schema", schemaJSON, "-names")
+		if code != 0 || strings.TrimSpace(out) != hex64(want) {
+			t.Fatalf("code %d, got %q want %s", code, out, hex64(want))
+		}
+
+		var framed []byte
+		c := binary.New(binary.WithFingerprint(false))
+		if err := c.Encode(&cliUser{Name: "Bob"}, &framed); err != nil {
+			t.Fatal(err)
+		}
+		if code, out, stderr := runCLI(framed, "tojson", "-schema", schemaBin, "-fingerprint"); code != 0 || !strings.Contains(out, `"Bob"`) {
+			t.Fatalf("fingerprinted payload: code %d, %q %s", code, out, stderr)
+		}
+		if code, _, stderr := runCLI(framed, "tojson", "-schema", schemaBin, "-fingerprint", "-names"); code != 1 || !strings.Contains(stderr, "schema mismatch") {
+			t.Fatalf("mismatch: code %d, %s", code, stderr)
+		}
+	})
+
+	t.Run("GenTS", func(t *testing.T) {
+		code, out, stderr := runCLI(nil, "gents", "-schema", schemaJSON)
+		if code != 0 || !strings.Contains(out, "export class CliUser {") || !strings.Contains(out, "  Age: bigint = 0n;") {
+			t.Fatalf("code %d, %s\n%s", code, stderr, out)
+		}
+		code, out, _ = runCLI(nil, "gents", "-schema", schemaBin, "-js")
+		if code != 0 || !strings.Contains(out, "  Age = 0n;") {
+			t.Fatalf("-js: code %d\n%s", code, out)
+		}
+	})
+
+	t.Run("GenGo", func(t *testing.T) {
+		code, out, stderr := runCLI(nil, "gengo", "-schema", schemaJSON, "-package", "users")
+		if code != 0 || !strings.Contains(out, "package users\n") || !strings.Contains(out, "type CliUser struct {\n\tName string\n\tAge  int\n") {
+			t.Fatalf("code %d, %s\n%s", code, stderr, out)
+		}
+		code, out, _ = runCLI(nil, "gengo", "-schema", schemaBin, "-codecs")
+		if code != 0 || !strings.Contains(out, "func (v *CliUser) BinaryRead(data []byte) error {") {
+			t.Fatalf("-codecs: code %d\n%s", code, out)
+		}
+	})
+
+	t.Run("CorruptSchema", func(t *testing.T) {
+		dir := t.TempDir()
+		for name, s := range map[string]binary.Schema{
+			"key":   {Nodes: []binary.Node{{Kind: binary.KindMap, Key: 5, Elem: 1}, {Kind: binary.KindBool}}},
+			"elem":  {Nodes: []binary.Node{{Kind: binary.KindSlice, Elem: -1}}},
+			"field": {Nodes: []binary.Node{{Kind: binary.KindStruct, Fields: []binary.Field{{Name: "A", Type: 3}}}}},
+			"cycle": {Nodes: []binary.Node{{Kind: binary.KindStruct, Fields: []binary.Field{{Name: "Self", Type: 0}}}}},
+		} {
+			var desc []byte
+			if err := binary.Encode(s, &desc); err != nil {
+				t.Fatal(err)
+			}
+			path := filepath.Join(dir, name+".schema")
+			if err := os.WriteFile(path, desc, 0o644); err != nil {
+				t.Fatal(err)
+			}
+			for _, cmd := range []string{"validate", "tojson", "fromjson"} {
+				code, _, errOut := runCLI([]byte("{}"), cmd, "-schema", path)
+				if code != 1 || !strings.Contains(errOut, "schema") {
+					t.Errorf("%s %s: code %d, stderr %q", cmd, name, code, errOut)
+				}
+			}
+		}
+	})
+
+	t.Run("Usage", func(t *testing.T) {
+		if code, _, _ := runCLI(nil); code != 2 {
+			t.Fatalf("no args: code %d", code)
+		}
+		if code, _, _ := runCLI(nil, "bogus", "-schema", schemaBin); code != 2 {
+			t.Fatalf("unknown command: code %d", code)
+		}
+		if code, _, _ := runCLI(nil, "inspect"); code != 2 {
+			t.Fatalf("missing schema: code %d", code)
+		}
+	})
+}
@@ -1,8 +1,10 @@
 package binary
 
 import (
+	"bytes"
 	"encoding"
 	"reflect"
+	"sort"
 
 	. "github.com/tinywasm/fmt"
 )
@@ -516,6 +518,9 @@ type mapcodec struct {
 func (c *mapcodec) encodeTo(e *encoder, rv reflect.Value) (err error) {
 	l := rv.Len()
 	e.writeUvarint(uint64(l))
+	if e.canonical && l > 1 {
+		return c.encodeSorted(e, rv)
+	}
 	iter := rv.MapRange()
 	for iter.Next() {
 		if err = c.keycodec.encodeTo(e, iter.Key()); err != nil {
@@ -528,6 +533,41 @@ func (c *mapcodec) encodeTo(e *encoder, rv reflect.Value) (err error) {
 	return e.err
 }
 
+// encodeSorted encodes the entries of rv ordered by their encoded key, so
+// equal maps always produce the same bytes.
+func (c *mapcodec) encodeSorted(e *encoder, rv reflect.Value) error {
+	type entry struct{ key, value []byte }
+	entries := make([]entry, 0, rv.Len())
+
+	var buf bytes.Buffer
+	sub := encoder{out: &buf, tb: e.tb, canonical: true}
+	iter := rv.MapRange()
+	for iter.Next() {
+		buf.Reset()
+		if err := c.keycodec.encodeTo(&sub, iter.Key()); err != nil {
+			return err
+		}
+		keyLen := buf.Len()
+		if err := c.valuecodec.encodeTo(&sub, iter.Value()); err != nil {
+			return err
+		}
+		if sub.err != nil {
+			return sub.err
+		}
+		b := append([]byte(nil), buf.Bytes()...)
+		entries = append(entries, entry{b[:keyLen], b[keyLen:]})
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return bytes.Compare(entries[i].key, entries[j].key) < 0
+	})
+	for _, en := range entries {
+		e.write(en.key)
+		e.write(en.value)
+	}
+	return e.err
+}
+
 // Decode decodes into a reflect value from the decoder.
 func (c *mapcodec) decodeTo(d *decoder, rv reflect.Value) (err error) {
 	var l uint64
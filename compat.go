@@ -0,0 +1,232 @@
+package binary
+
+import (
+	. "github.com/tinywasm/fmt"
+)
+
+// Change classifies a difference between two versions of a schema.
+type Change uint8
+
+const (
+	ChangeFieldAdded     Change = iota // field appended to, or inserted into, a struct
+	ChangeFieldRemoved                 // field no longer present
+	ChangeFieldRenamed                 // same position and layout, different name
+	ChangeFieldReordered               // field moved to another position
+	ChangeIntWidened                   // integer grew, e.g. int32 to int64
+	ChangeIntNarrowed                  // integer shrank, e.g. int64 to int32
+	ChangeArrayLength                  // fixed array length changed
+	ChangeKind                         // wire kind changed, e.g. slice to pointer or int to uint
+	ChangeIntEncoding                  // integer encoding changed, e.g. varint to fixed32
+)
+
+var changeNames = [...]string{"field added", "field removed", "field renamed", "field reordered", "int widened", "int narrowed", "array length changed", "kind changed", "int encoding changed"}
+
+// String returns a short human-readable name of the change.
+func (c Change) String() string {
+	if int(c) < len(changeNames) {
+		return changeNames[c]
+	}
+	return "unknown change"
+}
+
+// Incompatibility describes one change found by CheckCompatibility and how it
+// affects readers of each version.
+type Incompatibility struct {
+	Path     string // location of the change, e.g. "User.Address.Zip"
+	Change   Change
+	Detail   string // human-readable description
+	Backward bool   // the new type can still read data written by the old one
+	Forward  bool   // the old type can still read data written by the new one
+	Tagged   bool   // safe when fields are matched by tag or name rather than position
+}
+
+// Breaking reports whether the change prevents reading in either direction
+// with the positional format.
+func (i Incompatibility) Breaking() bool {
+	return !i.Backward || !i.Forward
+}
+
+// String formats the change as a single report line.
+func (i Incompatibility) String() string {
+	return i.Path + ": " + i.Change.String() + " (" + i.Detail + ") backward=" + yesNo(i.Backward) + " forward=" + yesNo(i.Forward) + " tagged=" + yesNo(i.Tagged)
+}
+
+// CompatibilityReport formats changes as a multi-line report, one per line.
+func CompatibilityReport(changes []Incompatibility) string {
+	if len(changes) == 0 {
+		return "compatible: no changes\n"
+	}
+	var out []byte
+	for _, c := range changes {
+		if c.Breaking() {
+			out = append(out, "BREAKING "...)
+		} else {
+			out = append(out, "ok       "...)
+		}
+		out = append(out, c.String()...)
+		out = append(out, '\n')
+	}
+	return string(out)
+}
+
+// CheckCompatibility compares two versions of a schema and returns every
+// change found, classified by whether data written by one version can still
+// be read by the other. Data is positional: a change is only safe when the
+// bytes written by one version decode to the same values in the other.
+func CheckCompatibility(old, new Schema) []Incompatibility {
+	c := compatChecker{old: &old, new: &new}
+	if len(old.Nodes) == 0 || len(new.Nodes) == 0 {
+		c.add(old.Name, ChangeKind, "empty schema", false, false, false)
+		return c.out
+	}
+	c.compare(old.Name, 0, 0, true, 0)
+	return c.out
+}
+
+type compatChecker struct {
+	old, new *Schema
+	out      []Incompatibility
+}
+
+func (c *compatChecker) add(path string, change Change, detail string, backward, forward, tagged bool) {
+	c.out = append(c.out, Incompatibility{
+		Path:     path,
+		Change:   change,
+		Detail:   detail,
+		Backward: backward,
+		Forward:  forward,
+		Tagged:   tagged,
+	})
+}
+
+// compare checks old node o against new node n. tail is true when nothing is
+// encoded after the node, so trailing fields can be added or dropped safely.
+func (c *compatChecker) compare(path string, o, n int, tail bool, depth int) {
+	if o < 0 || o >= len(c.old.Nodes) || n < 0 || n >= len(c.new.Nodes) || depth > len(c.old.Nodes)+len(c.new.Nodes) {
+		c.add(path, ChangeKind, "invalid node", false, false, false)
+		return
+	}
+	on, nn := &c.old.Nodes[o], &c.new.Nodes[n]
+
+	if on.Kind != nn.Kind {
+		c.compareKinds(path, on, nn)
+		return
+	}
+
+	switch on.Kind {
+	case KindInt, KindUint:
+		if on.Encoding != nn.Encoding {
+			c.add(path, ChangeIntEncoding, encodingName(on.Encoding)+" to "+encodingName(nn.Encoding), false, false, false)
+			return
+		}
+		if nn.Bits > on.Bits {
+			c.add(path, ChangeIntWidened, on.Type+" to "+nn.Type, true, false, false)
+		} else if nn.Bits < on.Bits {
+			c.add(path, ChangeIntNarrowed, on.Type+" to "+nn.Type, false, true, false)
+		}
+	case KindPointer, KindSlice:
+		c.compare(path+"[]", on.Elem, nn.Elem, false, depth+1)
+	case KindArray:
+		if on.Len != nn.Len {
+			c.add(path, ChangeArrayLength, Convert(on.Len).String()+" to "+Convert(nn.Len).String(), false, false, false)
+			return
+		}
+		c.compare(path+"[]", on.Elem, nn.Elem, false, depth+1)
+	case KindMap:
+		c.compare(path+"[key]", on.Key, nn.Key, false, depth+1)
+		c.compare(path+"[]", on.Elem, nn.Elem, false, depth+1)
+	case KindStruct:
+		c.compareFields(path, on, nn, tail, depth)
+	}
+}
+
+// compareKinds reports a change of wire kind between two nodes.
+func (c *compatChecker) compareKinds(path string, on, nn *Node) {
+	detail := on.Kind.String() + " (" + on.Type + ") to " + nn.Kind.String() + " (" + nn.Type + ")"
+	switch {
+	case (on.Kind == KindString && nn.Kind == KindBytes) || (on.Kind == KindBytes && nn.Kind == KindString):
+		// Both are a uvarint length followed by raw bytes.
+		c.add(path, ChangeKind, detail+", same wire layout", true, true, true)
+	case nn.Kind == KindPointer && c.new.kindOf(nn.Elem) == on.Kind:
+		c.add(path, ChangeKind, detail+", value became a pointer and gained a nil flag", false, false, false)
+	case on.Kind == KindPointer && c.old.kindOf(on.Elem) == nn.Kind:
+		c.add(path, ChangeKind, detail+", pointer became a value and lost its nil flag", false, false, false)
+	default:
+		c.add(path, ChangeKind, detail, false, false, false)
+	}
+}
+
+// compareFields matches struct fields by name and classifies additions,
+// removals, renames and moves.
+func (c *compatChecker) compareFields(path string, on, nn *Node, tail bool, depth int) {
+	matched := make([]bool, len(on.Fields))
+
+	for j, nf := range nn.Fields {
+		i := fieldIndex(on.Fields, nf.Name)
+		last := tail && j == len(nn.Fields)-1
+
+		switch {
+		case i == j:
+			matched[i] = true
+			c.compare(path+"."+nf.Name, on.Fields[i].Type, nf.Type, last, depth+1)
+		case i >= 0:
+			matched[i] = true
+			c.add(path+"."+nf.Name, ChangeFieldReordered, "moved from position "+Convert(i).String()+" to "+Convert(j).String(), false, false, true)
+			c.compare(path+"."+nf.Name, on.Fields[i].Type, nf.Type, last, depth+1)
+		case j < len(on.Fields) && fieldIndex(nn.Fields, on.Fields[j].Name) < 0:
+			matched[j] = true
+			c.add(path+"."+nf.Name, ChangeFieldRenamed, "was "+on.Fields[j].Name, true, true, false)
+			c.compare(path+"."+nf.Name, on.Fields[j].Type, nf.Type, last, depth+1)
+		case j >= len(on.Fields):
+			// Old data ends before the new field; old readers ignore trailing bytes only at the end of the payload.
+			c.add(path+"."+nf.Name, ChangeFieldAdded, "appended", false, tail, true)
+		default:
+			c.add(path+"."+nf.Name, ChangeFieldAdded, "inserted at position "+Convert(j).String(), false, false, true)
+		}
+	}
+
+	for i, of := range on.Fields {
+		if matched[i] {
+			continue
+		}
+		if i >= len(nn.Fields) {
+			// New readers stop before the dropped trailing field.
+			c.add(path+"."+of.Name, ChangeFieldRemoved, "trailing field removed", tail, false, true)
+		} else {
+			c.add(path+"."+of.Name, ChangeFieldRemoved, "removed from position "+Convert(i).String(), false, false, true)
+		}
+	}
+}
+
+// kindOf returns the kind of node n, or KindInvalid when a malformed
+// descriptor points outside its nodes.
+func (s *Schema) kindOf(n int) NodeKind {
+	if n < 0 || n >= len(s.Nodes) {
+		return KindInvalid
+	}
+	return s.Nodes[n].Kind
+}
+
+func fieldIndex(fields []Field, name string) int {
+	for i, f := range fields {
+		if f.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+func yesNo(b bool) string {
+	if b {
+		return "yes"
+	}
+	return "no"
+}
+
+// encodingName names a Node.Encoding for reports.
+func encodingName(enc string) string {
+	if enc == "" {
+		return "varint"
+	}
+	return enc
+}
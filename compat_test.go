@@ -0,0 +1,197 @@
+package binary
+
+import (
+	"strings"
+	"testing"
+)
+
+type compatAddressV1 struct {
+	Street string
+	Zip    int32
+}
+
+type compatAddressV2 struct {
+	Street string
+	Zip    int64
+}
+
+type compatUserV1 struct {
+	ID      uint64
+	Name    string
+	Address compatAddressV1
+	Tags    []string
+	Notes   string
+}
+
+type compatUserV2 struct {
+	ID      uint64
+	Title   string
+	Address compatAddressV2
+	Tags    *string
+	Notes   string
+	Email   string
+}
+
+func findChange(changes []Incompatibility, path string) (Incompatibility, bool) {
+	for _, c := range changes {
+		if c.Path == path {
+			return c, true
+		}
+	}
+	return Incompatibility{}, false
+}
+
+func TestCheckCompatibility(t *testing.T) {
+	changes := CheckCompatibility(DescribeType(compatUserV1{}), DescribeType(compatUserV2{}))
+
+	tests := []struct {
+		path     string
+		change   Change
+		backward bool
+		forward  bool
+	}{
+		{"binary.compatUserV1.Title", ChangeFieldRenamed, true, true},
+		{"binary.compatUserV1.Address.Zip", ChangeIntWidened, true, false},
+		{"binary.compatUserV1.Tags", ChangeKind, false, false},
+		{"binary.compatUserV1.Email", ChangeFieldAdded, false, true},
+	}
+	for _, tt := range tests {
+		c, ok := findChange(changes, tt.path)
+		if !ok {
+			t.Errorf("missing change for %s in %v", tt.path, changes)
+			continue
+		}
+		if c.Change != tt.change || c.Backward != tt.backward || c.Forward != tt.forward {
+			t.Errorf("%s: expected %v backward=%v forward=%v, got %v", tt.path, tt.change, tt.backward, tt.forward, c)
+		}
+	}
+	if len(changes) != len(tests) {
+		t.Errorf("expected %d changes, got %d: %v", len(tests), len(changes), changes)
+	}
+
+	report := CompatibilityReport(changes)
+	if !strings.Contains(report, "BREAKING binary.compatUserV1.Tags: kind changed") ||
+		!strings.Contains(report, "ok       binary.compatUserV1.Title: field renamed") {
+		t.Errorf("unexpected report:\n%s", report)
+	}
+}
+
+func TestCheckCompatibilityCases(t *testing.T) {
+	type same struct {
+		A int
+		B string
+	}
+	type reordered struct {
+		B string
+		A int
+	}
+	type inserted struct {
+		A int
+		X bool
+		B string
+	}
+	type removed struct {
+		A int
+	}
+	type nested struct {
+		Inner same
+		After int
+	}
+	type nestedAppended struct {
+		Inner struct {
+			A int
+			B string
+			C int
+		}
+		After int
+	}
+
+	if got := CheckCompatibility(DescribeType(same{}), DescribeType(same{})); len(got) != 0 {
+		t.Errorf("identical schemas should have no changes, got %v", got)
+	}
+	if CompatibilityReport(nil) != "compatible: no changes\n" {
+		t.Error("unexpected empty report")
+	}
+
+	got := CheckCompatibility(DescribeType(same{}), DescribeType(reordered{}))
+	if len(got) != 2 || got[0].Change != ChangeFieldReordered || !got[0].Tagged || !got[0].Breaking() {
+		t.Errorf("expected reordered fields, got %v", got)
+	}
+
+	got = CheckCompatibility(DescribeType(same{}), DescribeType(inserted{}))
+	c, _ := findChange(got, "binary.same.X")
+	if c.Change != ChangeFieldAdded || c.Forward || !strings.Contains(c.Detail, "inserted") {
+		t.Errorf("expected inserted field, got %v", got)
+	}
+
+	got = CheckCompatibility(DescribeType(same{}), DescribeType(removed{}))
+	if len(got) != 1 || got[0].Change != ChangeFieldRemoved || !got[0].Backward || got[0].Forward {
+		t.Errorf("expected trailing field removed, got %v", got)
+	}
+
+	got = CheckCompatibility(DescribeType(nested{}), DescribeType(nestedAppended{}))
+	c, _ = findChange(got, "binary.nested.Inner.C")
+	if c.Change != ChangeFieldAdded || c.Forward {
+		t.Errorf("field appended to a nested struct is not at the tail, got %v", got)
+	}
+
+	got = CheckCompatibility(DescribeType([2]int{}), DescribeType([3]int{}))
+	if len(got) != 1 || got[0].Change != ChangeArrayLength {
+		t.Errorf("expected array length change, got %v", got)
+	}
+
+	got = CheckCompatibility(DescribeType(int64(0)), DescribeType(int8(0)))
+	if len(got) != 1 || got[0].Change != ChangeIntNarrowed || got[0].Backward || !got[0].Forward {
+		t.Errorf("expected narrowed int, got %v", got)
+	}
+
+	got = CheckCompatibility(DescribeType(""), DescribeType([]byte{}))
+	if len(got) != 1 || got[0].Breaking() {
+		t.Errorf("string to bytes keeps the wire layout, got %v", got)
+	}
+
+	got = CheckCompatibility(DescribeType(int(0)), DescribeType(uint(0)))
+	if len(got) != 1 || got[0].Change != ChangeKind || !got[0].Breaking() {
+		t.Errorf("int to uint is breaking, got %v", got)
+	}
+
+	type optional struct{ V *string }
+	type required struct{ V string }
+	got = CheckCompatibility(DescribeType(optional{}), DescribeType(required{}))
+	if len(got) != 1 || !strings.Contains(got[0].Detail, "pointer became a value") {
+		t.Errorf("expected pointer to value change, got %v", got)
+	}
+
+	got = CheckCompatibility(DescribeType(map[string]int{}), DescribeType(map[string]uint{}))
+	if len(got) != 1 || got[0].Path != "map[string]int[]" {
+		t.Errorf("expected map value change, got %v", got)
+	}
+
+	if got := CheckCompatibility(Schema{}, DescribeType(same{})); len(got) != 1 || !got[0].Breaking() {
+		t.Errorf("expected empty schema to be breaking, got %v", got)
+	}
+	bad := Schema{Nodes: []Node{{Kind: KindSlice, Elem: 7}}}
+	if got := CheckCompatibility(bad, bad); len(got) != 1 {
+		t.Errorf("expected invalid node, got %v", got)
+	}
+	badPtr := Schema{Nodes: []Node{{Kind: KindPointer, Elem: 9}}}
+	if got := CheckCompatibility(DescribeType(""), badPtr); len(got) != 1 || !got[0].Breaking() {
+		t.Errorf("expected kind change for a malformed pointer, got %v", got)
+	}
+	if got := CheckCompatibility(badPtr, DescribeType("")); len(got) != 1 || !got[0].Breaking() {
+		t.Errorf("expected kind change for a malformed pointer, got %v", got)
+	}
+
+	// A moved field is still compared with its old type.
+	type movedNarrowed struct {
+		B string
+		A int8
+	}
+	got = CheckCompatibility(DescribeType(same{}), DescribeType(movedNarrowed{}))
+	if len(got) != 3 || got[2].Path != "binary.same.A" || got[2].Change != ChangeIntNarrowed {
+		t.Errorf("expected the moved field to be compared, got %v", got)
+	}
+	if Change(99).String() != "unknown change" {
+		t.Error("unexpected change name")
+	}
+}
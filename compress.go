@@ -0,0 +1,125 @@
+package binary
+
+import (
+	"bytes"
+	"compress/flate"
+	"io"
+
+	. "github.com/tinywasm/fmt"
+)
+
+// DefaultMaxSize bounds the size of an inflated body when WithCompression is
+// set and WithMaxSize is not.
+const DefaultMaxSize = 64 << 20
+
+// Compression flags written before the body by WithCompression.
+const (
+	flagRaw     byte = 0
+	flagDeflate byte = 1
+)
+
+// ErrTooLarge is returned by Decode when a body exceeds the size configured
+// with WithMaxSize, e.g. a compressed payload that inflates past it.
+var ErrTooLarge error = Err(D.Binary, "payload exceeds maximum size")
+
+// encodeCompressed encodes data into a buffer and writes it to dst behind a
+// flag byte, deflated when it reaches the compression threshold.
+func (tb *instance) encodeCompressed(data any, dst io.Writer) error {
+	var body bytes.Buffer
+	body.Grow(64)
+	if err := tb.encodeBody(data, &body); err != nil {
+		return err
+	}
+
+	if body.Len() < tb.compressAt {
+		if _, err := dst.Write([]byte{flagRaw}); err != nil {
+			return err
+		}
+		_, err := dst.Write(body.Bytes())
+		return err
+	}
+
+	var out bytes.Buffer
+	out.Grow(body.Len()/2 + 1)
+	out.WriteByte(flagDeflate)
+	zw, err := flate.NewWriter(&out, flate.DefaultCompression)
+	if err != nil {
+		return err
+	}
+	if _, err = zw.Write(body.Bytes()); err == nil {
+		err = zw.Close()
+	}
+	if err != nil {
+		return err
+	}
+	_, err = dst.Write(out.Bytes())
+	return err
+}
+
+// decodeCompressed reads the flag byte of data and decodes the body, inflating
+// it first when it was compressed.
+func (tb *instance) decodeCompressed(data []byte, target any) error {
+	if len(data) == 0 {
+		return io.ErrUnexpectedEOF
+	}
+	switch data[0] {
+	case flagRaw:
+		if len(data)-1 > tb.maxBody() {
+			return ErrTooLarge
+		}
+		return tb.decodeBody(data[1:], target)
+	case flagDeflate:
+		body, err := tb.inflate(bytes.NewReader(data[1:]))
+		if err != nil {
+			return err
+		}
+		return tb.decodeBody(body, target)
+	}
+	return Err("Decode", "compression flag", Convert(int(data[0])).String(), D.Not, D.Supported)
+}
+
+// decodeCompressedFrom is decodeCompressed for a stream. Raw bodies are
+// decoded straight from r; compressed ones are inflated into memory first.
+func (tb *instance) decodeCompressedFrom(r io.Reader, target any) error {
+	var flag [1]byte
+	if _, err := io.ReadFull(r, flag[:]); err != nil {
+		return err
+	}
+	switch flag[0] {
+	case flagRaw:
+		return tb.decodeBodyFrom(r, target)
+	case flagDeflate:
+		body, err := tb.inflate(r)
+		if err != nil {
+			return err
+		}
+		return tb.decodeBody(body, target)
+	}
+	return Err("Decode", "compression flag", Convert(int(flag[0])).String(), D.Not, D.Supported)
+}
+
+// inflate decompresses r, failing with ErrTooLarge as soon as the output
+// grows past the size limit instead of inflating it all.
+func (tb *instance) inflate(r io.Reader) ([]byte, error) {
+	limit := tb.maxBody()
+	zr := flate.NewReader(r)
+	defer zr.Close()
+
+	var out bytes.Buffer
+	n, err := out.ReadFrom(io.LimitReader(zr, int64(limit)+1))
+	if err != nil {
+		return nil, err
+	}
+	if n > int64(limit) {
+		return nil, ErrTooLarge
+	}
+	return out.Bytes(), nil
+}
+
+// maxBody returns the largest body Decode accepts.
+func (tb *instance) maxBody() int {
+	if tb.maxSize > 0 {
+		return tb.maxSize
+	}
+	return DefaultMaxSize
+}
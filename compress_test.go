@@ -0,0 +1,97 @@
+package binary
+
+import (
+	"bytes"
+	"compress/flate"
+	"errors"
+	"strings"
+	"testing"
+)
+
+type compressRecord struct {
+	ID   int
+	Name string
+}
+
+func TestCompression(t *testing.T) {
+	c := New(WithCompression(128))
+
+	t.Run("SmallStaysRaw", func(t *testing.T) {
+		in := compressRecord{ID: 1, Name: "a"}
+		var data []byte
+		assertNoError(t, c.Encode(&in, &data))
+		var plain []byte
+		assertNoError(t, Encode(&in, &plain))
+		assertEqualBytes(t, append([]byte{flagRaw}, plain...), data)
+
+		var out compressRecord
+		assertNoError(t, c.Decode(data, &out))
+		assertEqual(t, in, out)
+	})
+
+	t.Run("LargeIsDeflated", func(t *testing.T) {
+		in := make([]compressRecord, 200)
+		for i := range in {
+			in[i] = compressRecord{ID: i, Name: "repetitive record name"}
+		}
+		var data, plain []byte
+		assertNoError(t, c.Encode(&in, &data))
+		assertNoError(t, Encode(&in, &plain))
+		if data[0] != flagDeflate || len(data) >= len(plain)/2 {
+			t.Fatalf("flag %d, %d compressed bytes for %d raw", data[0], len(data), len(plain))
+		}
+
+		var out []compressRecord
+		assertNoError(t, c.Decode(data, &out))
+		assertEqual(t, in, out)
+
+		var fromStream []compressRecord
+		assertNoError(t, c.Decode(bytes.NewReader(data), &fromStream))
+		assertEqual(t, in, fromStream)
+	})
+
+	t.Run("RawStream", func(t *testing.T) {
+		var buf bytes.Buffer
+		in := compressRecord{ID: 7, Name: "b"}
+		assertNoError(t, c.Encode(&in, &buf))
+		var out compressRecord
+		assertNoError(t, c.Decode(struct{ *bytes.Buffer }{&buf}, &out))
+		assertEqual(t, in, out)
+	})
+
+	t.Run("ZipBomb", func(t *testing.T) {
+		var bomb bytes.Buffer
+		bomb.WriteByte(flagDeflate)
+		zw, _ := flate.NewWriter(&bomb, flate.BestCompression)
+		zw.Write(make([]byte, 4<<20))
+		zw.Close()
+
+		small := New(WithCompression(0), WithMaxSize(1<<20))
+		var out []byte
+		if err := small.Decode(bomb.Bytes(), &out); !errors.Is(err, ErrTooLarge) {
+			t.Fatalf("expected ErrTooLarge, got %v", err)
+		}
+		if err := small.Decode(bytes.NewReader(bomb.Bytes()), &out); !errors.Is(err, ErrTooLarge) {
+			t.Fatalf("stream: expected ErrTooLarge, got %v", err)
+		}
+	})
+
+	t.Run("MaxSizeRaw", func(t *testing.T) {
+		var data []byte
+		assertNoError(t, Encode(strings.Repeat("x", 100), &data))
+		var out string
+		if err := New(WithMaxSize(50)).Decode(data, &out); !errors.Is(err, ErrTooLarge) {
+			t.Fatalf("expected ErrTooLarge, got %v", err)
+		}
+	})
+
+	t.Run("BadFlag", func(t *testing.T) {
+		var out compressRecord
+		if err := c.Decode([]byte{9, 0, 0}, &out); err == nil {
+			t.Fatal("expected error for unknown flag")
+		}
+		if err := c.Decode([]byte{}, &out); err == nil {
+			t.Fatal("expected error for empty input")
+		}
+	})
+}
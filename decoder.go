@@ -32,6 +32,9 @@ func (d *decoder) decode(v any) (err error) {
 		if c, typ, found := d.tb.findSchemaByName(name); found {
 			rv := reflect.Indirect(reflect.ValueOf(v))
 			if rv.Type() == typ {
+				if done, err := d.decodeHeader(rv); err != nil || done {
+					return err
+				}
 				return c.decodeTo(d, rv)
 			}
 		}
@@ -52,7 +55,10 @@ func (d *decoder) decode(v any) (err error) {
 	}
 
 	if c, err = d.scanToCache(typ, name); err == nil {
-		err = c.decodeTo(d, rv)
+		var done bool
+		if done, err = d.decodeHeader(rv); err == nil && !done {
+			err = c.decodeTo(d, rv)
+		}
 	}
 
 	return
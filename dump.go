@@ -0,0 +1,304 @@
+package binary
+
+import (
+	"strconv"
+
+	. "github.com/tinywasm/fmt"
+)
+
+// Dump returns an annotated listing of data decoded with the layout of typ:
+// one line per value with its offset, path, kind, decoded value and raw bytes,
+// e.g. `0x0004 Name (string, len=5) "Alice" [05 41 6c 69 63 65]`. Decoding
+// keeps going after an error: the first failure is marked with ">>" and
+// values past the end of data are listed as <missing>.
+func Dump(data []byte, typ any) string {
+	return DescribeType(typ).Dump(data)
+}
+
+// Dump returns an annotated listing of a payload described by the schema.
+func (s Schema) Dump(data []byte) string {
+	if len(s.Nodes) == 0 {
+		return "!! empty schema\n"
+	}
+
+	w := dumper{schema: &s, r: newSliceReader(data)}
+	if s.Versioned {
+		start := w.pos()
+		if v, err := w.r.ReadUvarint(); err != nil {
+			w.fail(start, "version", "uvarint", err)
+		} else {
+			w.line(start, "version", "uvarint", strconv.FormatUint(v, 10))
+		}
+	}
+
+	w.node(0, s.Name, 0)
+
+	if rest := w.r.Len(); rest > 0 {
+		start := w.pos()
+		w.r.offset += int64(rest)
+		w.fail(start, "<trailing>", "bytes", Err(Convert(rest).String(), "unread bytes"))
+	}
+	return string(w.out)
+}
+
+// dumper walks a schema over a payload and writes one line per value.
+type dumper struct {
+	schema *Schema
+	r      *sliceReader
+	out    []byte
+	failed bool // an error was already marked
+}
+
+func (w *dumper) pos() int {
+	return int(w.r.offset)
+}
+
+// line writes a value that starts at offset start and ends at the reader position.
+func (w *dumper) line(start int, path, kind, value string) {
+	w.out = append(w.out, "   "...)
+	w.out = appendOffset(w.out, start)
+	w.out = append(w.out, ' ')
+	w.out = append(w.out, path...)
+	w.out = append(w.out, " ("...)
+	w.out = append(w.out, kind...)
+	w.out = append(w.out, ')')
+	if value != "" {
+		w.out = append(w.out, ' ')
+		w.out = append(w.out, value...)
+	}
+	if end := w.pos(); end > start {
+		w.out = append(w.out, " ["...)
+		w.out = appendHexBytes(w.out, w.r.buffer[start:end], 16)
+		w.out = append(w.out, ']')
+	}
+	w.out = append(w.out, '\n')
+}
+
+// fail writes a line for a value that could not be decoded.
+func (w *dumper) fail(start int, path, kind string, err error) {
+	marker := "!! "
+	if !w.failed {
+		marker = ">> "
+		w.failed = true
+	}
+	w.out = append(w.out, marker...)
+	w.out = appendOffset(w.out, start)
+	w.out = append(w.out, ' ')
+	w.out = append(w.out, path...)
+	w.out = append(w.out, " ("...)
+	w.out = append(w.out, kind...)
+	w.out = append(w.out, ") error: "...)
+	w.out = append(w.out, err.Error()...)
+	if end := w.pos(); end > start {
+		w.out = append(w.out, " ["...)
+		w.out = appendHexBytes(w.out, w.r.buffer[start:end], 16)
+		w.out = append(w.out, ']')
+	}
+	w.out = append(w.out, '\n')
+}
+
+// node dumps node n at path. depth guards against cyclic descriptors.
+func (w *dumper) node(n int, path string, depth int) {
+	start := w.pos()
+	if n < 0 || n >= len(w.schema.Nodes) || depth > 256 {
+		w.fail(start, path, "invalid", Err("node", D.Out, D.Of, D.Range))
+		return
+	}
+	node := &w.schema.Nodes[n]
+	kind := node.Kind.String()
+	if node.Type != "" && node.Type != kind {
+		kind += " " + node.Type
+	}
+	if node.Encoding != "" {
+		kind += " " + node.Encoding
+	}
+
+	if w.r.Len() == 0 && !(node.Kind == KindArray && node.Len == 0) && !(node.Kind == KindStruct && len(node.Fields) == 0) {
+		w.missing(n, path, depth)
+		return
+	}
+
+	switch node.Kind {
+	case KindBool:
+		b, _ := w.r.ReadByte()
+		if b > 1 {
+			w.fail(start, path, kind, Err("invalid bool", "0x"+hexByte(b)))
+			return
+		}
+		w.line(start, path, kind, strconv.FormatBool(b == 1))
+	case KindInt, KindUint:
+		enc, err := node.intEncoding()
+		if err != nil {
+			w.fail(start, path, kind, err)
+			w.r.offset = int64(len(w.r.buffer))
+			return
+		}
+		d := decoder{reader: w.r}
+		var value string
+		if node.Kind == KindInt {
+			var v int64
+			v, err = d.readIntAs(enc)
+			value = strconv.FormatInt(v, 10)
+		} else {
+			var v uint64
+			v, err = d.readUintAs(enc)
+			value = strconv.FormatUint(v, 10)
+		}
+		if err != nil {
+			if enc.size > 0 {
+				w.r.offset = int64(len(w.r.buffer))
+			}
+			w.fail(start, path, kind, err)
+			return
+		}
+		w.line(start, path, kind, value)
+	case KindFloat32, KindFloat64:
+		size := 4
+		if node.Kind == KindFloat64 {
+			size = 8
+		}
+		d := decoder{reader: w.r}
+		var f float64
+		var err error
+		if size == 4 {
+			var f32 float32
+			f32, err = d.readFloat32()
+			f = float64(f32)
+		} else {
+			f, err = d.readFloat64()
+		}
+		if err != nil {
+			w.r.offset = int64(len(w.r.buffer))
+			w.fail(start, path, kind, err)
+			return
+		}
+		w.line(start, path, kind, strconv.FormatFloat(f, 'g', -1, size*8))
+	case KindString, KindBytes, KindMarshaler:
+		l, err := w.r.ReadUvarint()
+		if err == nil && l > uint64(w.r.Len()) {
+			err = Err("length", strconv.FormatUint(l, 10), "exceeds", Convert(w.r.Len()).String(), "remaining bytes")
+			w.r.offset = int64(len(w.r.buffer))
+		}
+		if err != nil {
+			w.fail(start, path, kind, err)
+			return
+		}
+		b, _ := w.r.Slice(int(l))
+		kind += ", len=" + strconv.FormatUint(l, 10)
+		if node.Kind == KindString {
+			w.line(start, path, kind, string(appendJSONString(nil, string(b))))
+		} else {
+			w.line(start, path, kind, string(appendHexBytes(nil, b, 32)))
+		}
+	case KindPointer:
+		b, _ := w.r.ReadByte()
+		switch b {
+		case 1:
+			w.line(start, path, kind, "nil")
+		case 0:
+			w.line(start, path, kind, "")
+			w.node(node.Elem, path, depth+1)
+		default:
+			w.fail(start, path, kind, Err("invalid nil flag", "0x"+hexByte(b)))
+		}
+	case KindSlice, KindArray, KindMap:
+		l := uint64(node.Len)
+		if node.Kind != KindArray {
+			var err error
+			if l, err = w.r.ReadUvarint(); err != nil {
+				w.fail(start, path, kind, err)
+				return
+			}
+		}
+		w.line(start, path, kind+", len="+strconv.FormatUint(l, 10), "")
+		for i := uint64(0); i < l; i++ {
+			elem := path + "[" + strconv.FormatUint(i, 10) + "]"
+			if w.r.Len() == 0 {
+				// Every element takes at least one byte: stop instead of
+				// listing a corrupt length element by element.
+				w.fail(w.pos(), elem, "missing", Err(strconv.FormatUint(l-i, 10), "elements past end of data"))
+				return
+			}
+			if node.Kind == KindMap {
+				w.node(node.Key, elem+".key", depth+1)
+				w.node(node.Elem, elem+".value", depth+1)
+			} else {
+				w.node(node.Elem, elem, depth+1)
+			}
+		}
+	case KindStruct:
+		w.line(start, path, kind+", "+Convert(len(node.Fields)).String()+" fields", "")
+		for _, f := range node.Fields {
+			w.node(f.Type, joinPath(path, f.Name, depth), depth+1)
+		}
+	default:
+		w.fail(start, path, kind, Err(D.Type, D.Not, D.Supported))
+		w.r.offset = int64(len(w.r.buffer))
+	}
+}
+
+// missing lists node n and its fields as absent from the payload.
+func (w *dumper) missing(n int, path string, depth int) {
+	node := &w.schema.Nodes[n]
+	if !w.failed {
+		w.fail(w.pos(), path, node.Kind.String(), Err("unexpected end of data"))
+		return
+	}
+	w.out = append(w.out, "   "...)
+	w.out = appendOffset(w.out, w.pos())
+	w.out = append(w.out, ' ')
+	w.out = append(w.out, path...)
+	w.out = append(w.out, " ("...)
+	w.out = append(w.out, node.Kind.String()...)
+	w.out = append(w.out, ") <missing>\n"...)
+	if node.Kind == KindStruct && depth < 256 {
+		for _, f := range node.Fields {
+			if f.Type >= 0 && f.Type < len(w.schema.Nodes) {
+				w.missing(f.Type, joinPath(path, f.Name, depth), depth+1)
+			}
+		}
+	}
+}
+
+// joinPath builds the path of a struct field. Fields of the root are listed
+// by name only.
+func joinPath(path, name string, depth int) string {
+	if depth == 0 {
+		return name
+	}
+	return path + "." + name
+}
+
+// appendOffset appends n as a 0x-prefixed hexadecimal offset of at least four digits.
+func appendOffset(b []byte, n int) []byte {
+	const digits = "0123456789abcdef"
+	var tmp [16]byte
+	i := len(tmp)
+	for n > 0 || i > len(tmp)-4 {
+		i--
+		tmp[i] = digits[n&0xf]
+		n >>= 4
+	}
+	b = append(b, '0', 'x')
+	return append(b, tmp[i:]...)
+}
+
+// appendHexBytes appends data as space separated hex bytes, truncated to max bytes.
+func appendHexBytes(b, data []byte, max int) []byte {
+	for i, c := range data {
+		if i == max {
+			b = append(b, " ..."...)
+			break
+		}
+		if i > 0 {
+			b = append(b, ' ')
+		}
+		b = append(b, hexByte(c)...)
+	}
+	return b
+}
+
+func hexByte(c byte) string {
+	const digits = "0123456789abcdef"
+	return string([]byte{digits[c>>4], digits[c&0xf]})
+}
@@ -0,0 +1,91 @@
+package binary
+
+import (
+	"strings"
+	"testing"
+)
+
+type dumpUser struct {
+	Name   string
+	Age    int
+	Tags   []string
+	Parent *dumpAddr
+}
+
+type dumpAddr struct {
+	City string
+}
+
+func TestDump(t *testing.T) {
+	var data []byte
+	if err := Encode(&dumpUser{Name: "Alice", Age: 30, Tags: []string{"a"}}, &data); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("Valid", func(t *testing.T) {
+		out := Dump(data, dumpUser{})
+		for _, want := range []string{
+			`0x0000 Name (string, len=5) "Alice" [05 41 6c 69 63 65]`,
+			`0x0006 Age (int) 30 [3c]`,
+			`0x0007 Tags (slice []string, len=1) [01]`,
+			`0x0008 Tags[0] (string, len=1) "a" [01 61]`,
+			`0x000a Parent (pointer *binary.dumpAddr) nil [01]`,
+		} {
+			if !strings.Contains(out, want) {
+				t.Errorf("missing %q in:\n%s", want, out)
+			}
+		}
+		if strings.Contains(out, ">>") || strings.Contains(out, "!!") {
+			t.Errorf("unexpected error mark:\n%s", out)
+		}
+	})
+
+	t.Run("Truncated", func(t *testing.T) {
+		out := Dump(data[:7], dumpUser{})
+		if !strings.Contains(out, `0x0006 Age (int) 30`) {
+			t.Errorf("fields before the failure should decode:\n%s", out)
+		}
+		if !strings.Contains(out, ">> 0x0007 Tags (slice) error: unexpected end of data") {
+			t.Errorf("failure not marked:\n%s", out)
+		}
+		if !strings.Contains(out, "0x0007 Parent (pointer) <missing>") {
+			t.Errorf("fields after the failure should be listed:\n%s", out)
+		}
+	})
+
+	t.Run("CorruptLength", func(t *testing.T) {
+		bad := append([]byte{}, data...)
+		bad[0] = 0x7f
+		out := Dump(bad, dumpUser{})
+		if !strings.Contains(out, ">> 0x0000 Name (string) error: length 127 exceeds") {
+			t.Errorf("bad length not marked:\n%s", out)
+		}
+	})
+
+	t.Run("InvalidBool", func(t *testing.T) {
+		bad := append([]byte{}, data...)
+		bad[len(bad)-1] = 7
+		out := Dump(bad, dumpUser{})
+		if !strings.Contains(out, ">> 0x000a Parent (pointer *binary.dumpAddr) error: invalid nil flag 0x07") {
+			t.Errorf("bad nil flag not marked:\n%s", out)
+		}
+	})
+
+	t.Run("Trailing", func(t *testing.T) {
+		out := Dump(append(append([]byte{}, data...), 9, 9), dumpUser{})
+		if !strings.Contains(out, ">> 0x000b <trailing> (bytes) error: 2 unread bytes [09 09]") {
+			t.Errorf("trailing bytes not marked:\n%s", out)
+		}
+	})
+
+	t.Run("Versioned", func(t *testing.T) {
+		var v []byte
+		if err := Encode(&verUser{First: "Bob"}, &v); err != nil {
+			t.Fatal(err)
+		}
+		out := Dump(v, &verUser{})
+		if !strings.HasPrefix(out, "   0x0000 version (uvarint) 3 [03]\n") {
+			t.Errorf("version header not listed:\n%s", out)
+		}
+	})
+}
@@ -12,10 +12,11 @@ import (
 
 // encoder represents a binary encoder.
 type encoder struct {
-	scratch [10]byte
-	tb      *instance // Reference to the instance for schema caching
-	out     io.Writer
-	err     error
+	scratch   [10]byte
+	canonical bool      // sort map entries, see WithCanonical
+	tb        *instance // Reference to the instance for schema caching
+	out       io.Writer
+	err       error
 }
 
 // newEncoder creates a new encoder.
@@ -30,6 +31,7 @@ func (e *encoder) reset(out io.Writer, tb *instance) {
 	e.out = out
 	e.err = nil
 	e.tb = tb
+	e.canonical = tb != nil && tb.canonical
 }
 
 // buffer returns the underlying writer.
@@ -49,6 +51,9 @@ func (e *encoder) encode(v any) (err error) {
 		if c, typ, found := e.tb.findSchemaByName(name); found {
 			rv := reflect.Indirect(reflect.ValueOf(v))
 			if rv.Type() == typ {
+				if err = e.encodeHeader(typ); err != nil {
+					return err
+				}
 				return c.encodeTo(e, rv)
 			}
 		}
@@ -65,7 +70,9 @@ func (e *encoder) encode(v any) (err error) {
 	}
 
 	if c, err = e.tb.scanToCache(typ, name); err == nil {
-		err = c.encodeTo(e, rv)
+		if err = e.encodeHeader(typ); err == nil {
+			err = c.encodeTo(e, rv)
+		}
 	}
 
 	// Double check for any error during the encode process
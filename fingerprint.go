@@ -0,0 +1,124 @@
+package binary
+
+import (
+	"reflect"
+)
+
+// FNV-1a 64-bit parameters.
+const (
+	fnvOffset64 = 14695981039346656037
+	fnvPrime64  = 1099511628211
+)
+
+// SchemaMismatchError is returned by Decode in fingerprint mode when the
+// payload was produced from a different schema than the target type's.
+type SchemaMismatchError struct {
+	Type     string // Go type of the decode target
+	Expected uint64 // fingerprint of the target type
+	Got      uint64 // fingerprint found in the payload
+}
+
+func (e *SchemaMismatchError) Error() string {
+	return "binary: schema mismatch for " + e.Type + ": payload fingerprint " + hex64(e.Got) + ", expected " + hex64(e.Expected)
+}
+
+// Fingerprint returns a stable 64-bit hash of the wire layout described by the
+// schema: field order, kinds, integer encodings, array lengths and element
+// types. Go type names never take part; field names only do when includeNames
+// is true.
+func (s Schema) Fingerprint(includeNames bool) uint64 {
+	h := uint64(fnvOffset64)
+	if len(s.Nodes) > 0 {
+		s.hashNode(&h, 0, includeNames, 0)
+	}
+	return h
+}
+
+// hashNode feeds node n into h. depth guards against cyclic descriptors.
+func (s Schema) hashNode(h *uint64, n int, includeNames bool, depth int) {
+	if n < 0 || n >= len(s.Nodes) || depth > len(s.Nodes) {
+		hashByte(h, byte(KindInvalid))
+		return
+	}
+	node := &s.Nodes[n]
+	hashByte(h, byte(node.Kind))
+
+	switch node.Kind {
+	case KindInt, KindUint:
+		// Default varints hash nothing more, keeping older fingerprints.
+		if node.Encoding != "" {
+			for i := 0; i < len(node.Encoding); i++ {
+				hashByte(h, node.Encoding[i])
+			}
+			hashByte(h, 0)
+		}
+	case KindPointer, KindSlice:
+		s.hashNode(h, node.Elem, includeNames, depth+1)
+	case KindArray:
+		hashUvarint(h, uint64(node.Len))
+		s.hashNode(h, node.Elem, includeNames, depth+1)
+	case KindMap:
+		s.hashNode(h, node.Key, includeNames, depth+1)
+		s.hashNode(h, node.Elem, includeNames, depth+1)
+	case KindStruct:
+		hashUvarint(h, uint64(len(node.Fields)))
+		for _, f := range node.Fields {
+			if includeNames {
+				for i := 0; i < len(f.Name); i++ {
+					hashByte(h, f.Name[i])
+				}
+				hashByte(h, 0)
+			}
+			s.hashNode(h, f.Type, includeNames, depth+1)
+		}
+	}
+}
+
+func hashByte(h *uint64, b byte) {
+	*h ^= uint64(b)
+	*h *= fnvPrime64
+}
+
+func hashUvarint(h *uint64, x uint64) {
+	for x >= 0x80 {
+		hashByte(h, byte(x)|0x80)
+		x >>= 7
+	}
+	hashByte(h, byte(x))
+}
+
+// fingerprintOf returns the cached fingerprint of t, computing it on first use.
+func (tb *instance) fingerprintOf(t reflect.Type) uint64 {
+	tb.mu.RLock()
+	for _, entry := range tb.schemas {
+		if entry.Type == t && entry.fp != 0 {
+			tb.mu.RUnlock()
+			return entry.fp
+		}
+	}
+	tb.mu.RUnlock()
+
+	fp := describeType(t).Fingerprint(tb.fingerprintNames)
+
+	tb.mu.Lock()
+	for i := range tb.schemas {
+		if tb.schemas[i].Type == t {
+			tb.schemas[i].fp = fp
+			break
+		}
+	}
+	tb.mu.Unlock()
+	return fp
+}
+
+// hex64 formats v as a 0x-prefixed, zero-padded hexadecimal string.
+func hex64(v uint64) string {
+	const digits = "0123456789abcdef"
+	var b [18]byte
+	b[0], b[1] = '0', 'x'
+	for i := 17; i >= 2; i-- {
+		b[i] = digits[v&0xf]
+		v >>= 4
+	}
+	return string(b[:])
+}
@@ -0,0 +1,126 @@
+package binary
+
+import (
+	"testing"
+)
+
+type fpV1 struct {
+	ID   uint64
+	Name string
+}
+
+type fpV1Renamed struct {
+	Key   uint64
+	Title string
+}
+
+type fpV2 struct {
+	ID    uint64
+	Name  string
+	Email string
+}
+
+type fpReordered struct {
+	Name string
+	ID   uint64
+}
+
+func TestSchemaFingerprint(t *testing.T) {
+	v1 := DescribeType(fpV1{}).Fingerprint(false)
+
+	if v1 != DescribeType(&fpV1{}).Fingerprint(false) {
+		t.Error("fingerprint should be stable across calls")
+	}
+	if v1 != DescribeType(fpV1Renamed{}).Fingerprint(false) {
+		t.Error("renamed fields should not change the fingerprint by default")
+	}
+	if v1 == DescribeType(fpV1Renamed{}).Fingerprint(true) {
+		t.Error("renamed fields should change the fingerprint when names are included")
+	}
+	if v1 == DescribeType(fpV2{}).Fingerprint(false) {
+		t.Error("appended field should change the fingerprint")
+	}
+	if v1 == DescribeType(fpReordered{}).Fingerprint(false) {
+		t.Error("reordered fields should change the fingerprint")
+	}
+	if DescribeType([2]int{}).Fingerprint(false) == DescribeType([3]int{}).Fingerprint(false) {
+		t.Error("array length should change the fingerprint")
+	}
+	if DescribeType(map[string]int{}).Fingerprint(false) == DescribeType(map[string]uint{}).Fingerprint(false) {
+		t.Error("map element kind should change the fingerprint")
+	}
+
+	// Cyclic or out of range descriptors must not loop forever.
+	cyclic := Schema{Nodes: []Node{{Kind: KindPointer, Elem: 0}}}
+	cyclic.Fingerprint(false)
+	(Schema{Nodes: []Node{{Kind: KindSlice, Elem: 9}}}).Fingerprint(false)
+	(Schema{}).Fingerprint(false)
+}
+
+func TestFingerprintHeader(t *testing.T) {
+	c := New(WithFingerprint(false))
+
+	var b []byte
+	if err := c.Encode(&fpV1{ID: 1, Name: "a"}, &b); err != nil {
+		t.Fatal(err)
+	}
+
+	var plain []byte
+	if err := Encode(&fpV1{ID: 1, Name: "a"}, &plain); err != nil {
+		t.Fatal(err)
+	}
+	if len(b) != len(plain)+8 {
+		t.Fatalf("expected 8-byte header, got %d vs %d bytes", len(b), len(plain))
+	}
+
+	var out fpV1
+	if err := c.Decode(b, &out); err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+	if out.ID != 1 || out.Name != "a" {
+		t.Errorf("unexpected value %+v", out)
+	}
+
+	var renamed fpV1Renamed
+	if err := c.Decode(b, &renamed); err != nil {
+		t.Errorf("same layout with other names should decode: %v", err)
+	}
+
+	var v2 fpV2
+	err := c.Decode(b, &v2)
+	mismatch, ok := err.(*SchemaMismatchError)
+	if !ok {
+		t.Fatalf("expected *SchemaMismatchError, got %v", err)
+	}
+	if mismatch.Type != "binary.fpV2" || mismatch.Got != DescribeType(fpV1{}).Fingerprint(false) {
+		t.Errorf("unexpected mismatch details %+v", mismatch)
+	}
+	if mismatch.Error() == "" {
+		t.Error("expected error message")
+	}
+
+	if err := c.Decode(b[:4], &out); err == nil {
+		t.Error("expected error for truncated header")
+	}
+
+	t.Run("WithNames", func(t *testing.T) {
+		c := New(WithFingerprint(true))
+		var b []byte
+		if err := c.Encode(&fpV1{ID: 1}, &b); err != nil {
+			t.Fatal(err)
+		}
+		var renamed fpV1Renamed
+		if _, ok := c.Decode(b, &renamed).(*SchemaMismatchError); !ok {
+			t.Error("expected mismatch when names are part of the fingerprint")
+		}
+	})
+}
+
+func TestHex64(t *testing.T) {
+	if got := hex64(0xdeadbeef); got != "0x00000000deadbeef" {
+		t.Errorf("unexpected hex %q", got)
+	}
+	if got := hex64(1 << 63); got != "0x8000000000000000" {
+		t.Errorf("unexpected hex %q", got)
+	}
+}
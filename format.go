@@ -0,0 +1,114 @@
+package binary
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+
+	. "github.com/tinywasm/fmt"
+)
+
+// Format selects the wire format a Codec writes and reads.
+type Format uint8
+
+const (
+	FormatBinary   Format = iota // this package's native format
+	FormatProtobuf               // Protocol Buffers wire format, see WithFormat
+	FormatCBOR                   // CBOR (RFC 8949), see WithFormat
+	FormatMsgPack                // MessagePack, see WithFormat
+)
+
+// WithFormat makes the codec encode and decode values in format f instead of
+// the native format. The version and fingerprint headers are native only;
+// the compression envelope and frames wrap any format.
+//
+// FormatProtobuf numbers struct fields with their binary tag, e.g.
+// `binary:"1"`, and accepts these options after the number:
+//
+//   - sint: zigzag varint (sint32, sint64)
+//   - fixed32, fixed64: fixed width (fixed32/64 for uints, sfixed32/64 for ints)
+//
+// Other ints and uints are varints, floats are float and double, strings,
+// []byte and structs are length-delimited, and slices of numbers and bools
+// are packed. A map becomes repeated entries with the key as field 1 and the
+// value as field 2. Zero values are omitted, except behind a non-nil pointer.
+//
+// FormatCBOR and FormatMsgPack transcode the native encoding along the type's
+// schema, so they skip the same fields and use the same marshalers. Structs
+// are maps keyed by field name (or `json` tag name), nil pointers are null,
+// and []byte values are byte strings. When decoding, struct keys may come in
+// any order, unknown keys are ignored and missing fields are left zero.
+func WithFormat(f Format) Option {
+	return func(tb *instance) {
+		tb.format = f
+	}
+}
+
+// encodeFormat encodes data in the codec's non-native format.
+func (tb *instance) encodeFormat(data any, dst io.Writer) error {
+	if data == nil {
+		return Err("Encode", "nil value")
+	}
+	rv := reflect.Indirect(reflect.ValueOf(data))
+
+	var name string
+	if nh, ok := data.(namedHandler); ok {
+		name = nh.HandlerName()
+	}
+
+	var out []byte
+	var err error
+	switch tb.format {
+	case FormatProtobuf:
+		out, err = tb.encodeProto(rv)
+	case FormatCBOR:
+		out, err = tb.encodeItems(rv, name, cborWriter{})
+	case FormatMsgPack:
+		out, err = tb.encodeItems(rv, name, msgpackWriter{})
+	default:
+		err = Err("Encode", "format", Convert(int(tb.format)).String(), D.Not, D.Supported)
+	}
+	if err != nil {
+		return err
+	}
+	_, err = dst.Write(out)
+	return err
+}
+
+// decodeFormat decodes data in the codec's non-native format into target.
+func (tb *instance) decodeFormat(data []byte, target any) error {
+	rv := reflect.ValueOf(target)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return Err(D.Binary, "decoder", D.Required, D.Type, D.Pointer)
+	}
+	var name string
+	if nh, ok := target.(namedHandler); ok {
+		name = nh.HandlerName()
+	}
+
+	switch tb.format {
+	case FormatProtobuf:
+		return tb.decodeProto(data, rv.Elem())
+	case FormatCBOR:
+		return tb.decodeItems(data, rv.Elem(), name, cborReader{})
+	case FormatMsgPack:
+		return tb.decodeItems(data, rv.Elem(), name, msgpackReader{})
+	}
+	return Err("Decode", "format", Convert(int(tb.format)).String(), D.Not, D.Supported)
+}
+
+// decodeFormatFrom reads the rest of r, up to the size limit, and decodes it
+// in the codec's non-native format. These formats are not self-delimiting at
+// the top level, so the value must be the whole stream.
+func (tb *instance) decodeFormatFrom(r io.Reader, target any) error {
+	limit := tb.maxBody()
+	var buf bytes.Buffer
+	n, err := buf.ReadFrom(io.LimitReader(r, int64(limit)+1))
+	if err != nil {
+		return err
+	}
+	if n > int64(limit) {
+		return ErrTooLarge
+	}
+	return tb.decodeFormat(buf.Bytes(), target)
+}
@@ -0,0 +1,150 @@
+package binary
+
+import (
+	"bytes"
+	"hash/crc32"
+	"io"
+	"sync"
+
+	. "github.com/tinywasm/fmt"
+)
+
+// Frame layout:
+//
+//	uvarint(len(body)<<1 | hasChecksum) | CRC32C(body), 4 bytes LE, if hasChecksum | body
+//
+// body is the value as written by Encode, including any enabled headers and
+// the compression envelope.
+
+var (
+	castagnoliOnce  sync.Once
+	castagnoliTable *crc32.Table
+)
+
+// castagnoli returns the CRC32C table, built on first use so programs that
+// never checksum a frame or log entry don't pay for it at init.
+func castagnoli() *crc32.Table {
+	castagnoliOnce.Do(func() {
+		castagnoliTable = crc32.MakeTable(crc32.Castagnoli)
+	})
+	return castagnoliTable
+}
+
+// ErrChecksum is returned by ReadFrame when a frame body does not match its
+// CRC32C. The frame has been consumed, so the next ReadFrame starts at the
+// following frame.
+var ErrChecksum error = Err(D.Binary, "frame checksum mismatch")
+
+// WriteFrame encodes v and writes it to w as one length-delimited frame.
+func WriteFrame(w io.Writer, v any) error {
+	return defaultCodec().WriteFrame(w, v)
+}
+
+// ReadFrame reads one frame written by WriteFrame from r and decodes it into
+// v. It returns io.EOF when r ends cleanly before a frame and
+// io.ErrUnexpectedEOF when it ends inside one.
+func ReadFrame(r io.Reader, v any) error {
+	return defaultCodec().ReadFrame(r, v)
+}
+
+// WriteFrame is the package-level WriteFrame using this codec's options. The
+// frame carries a CRC32C when the codec was created WithChecksum.
+func (c *Codec) WriteFrame(w io.Writer, v any) error {
+	var body bytes.Buffer
+	if err := c.tb.encodeTo(v, &body); err != nil {
+		return err
+	}
+	if body.Len() > c.tb.maxBody() {
+		return ErrTooLarge
+	}
+
+	var head bytes.Buffer
+	e := newEncoder(&head)
+	if c.tb.checksum {
+		e.writeUvarint(uint64(body.Len())<<1 | 1)
+		e.writeUint32(crc32.Checksum(body.Bytes(), castagnoli()))
+	} else {
+		e.writeUvarint(uint64(body.Len()) << 1)
+	}
+	if _, err := w.Write(head.Bytes()); err != nil {
+		return err
+	}
+	_, err := w.Write(body.Bytes())
+	return err
+}
+
+// ReadFrame is the package-level ReadFrame using this codec's options. Frames
+// larger than WithMaxSize (DefaultMaxSize by default) fail with ErrTooLarge
+// before their body is read; the stream cannot be resumed after that, nor
+// after any error other than ErrChecksum or a decode error of the body.
+// Checksums are verified whenever a frame carries one.
+func (c *Codec) ReadFrame(r io.Reader, v any) error {
+	body, err := c.readFrame(r)
+	if err != nil {
+		return err
+	}
+	return c.tb.decode(body, v)
+}
+
+// SkipFrame reads the next frame from r and discards it, checking its
+// checksum if it has one.
+func (c *Codec) SkipFrame(r io.Reader) error {
+	_, err := c.readFrame(r)
+	return err
+}
+
+// readFrame reads the body of the next frame.
+func (c *Codec) readFrame(r io.Reader) ([]byte, error) {
+	// Read the header a byte at a time so no bytes past the frame are
+	// consumed from readers that don't implement io.ByteReader.
+	sr := newStreamReader(frameByteReader{r})
+
+	head, err := sr.ReadUvarint()
+	if err != nil {
+		return nil, err
+	}
+	size := head >> 1
+	if size > uint64(c.tb.maxBody()) {
+		return nil, ErrTooLarge
+	}
+
+	var sum uint32
+	if head&1 == 1 {
+		var b [4]byte
+		if _, err := io.ReadFull(r, b[:]); err != nil {
+			return nil, unexpectedEOF(err)
+		}
+		sum = uint32(b[0]) | uint32(b[1])<<8 | uint32(b[2])<<16 | uint32(b[3])<<24
+	}
+
+	body := make([]byte, size)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	if head&1 == 1 && crc32.Checksum(body, castagnoli()) != sum {
+		return nil, ErrChecksum
+	}
+	return body, nil
+}
+
+// unexpectedEOF reports a stream that ended inside a frame.
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// frameByteReader adds io.ByteReader to r without buffering ahead of it.
+type frameByteReader struct {
+	io.Reader
+}
+
+func (r frameByteReader) ReadByte() (byte, error) {
+	if br, ok := r.Reader.(io.ByteReader); ok {
+		return br.ReadByte()
+	}
+	var b [1]byte
+	_, err := io.ReadFull(r.Reader, b[:])
+	return b[0], err
+}
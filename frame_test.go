@@ -0,0 +1,114 @@
+package binary
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+)
+
+type frameMsg struct {
+	ID   uint32
+	Text string
+}
+
+// onlyReader hides io.ByteReader so ReadFrame cannot rely on it.
+type onlyReader struct{ r io.Reader }
+
+func (o *onlyReader) Read(p []byte) (int, error) { return o.r.Read(p) }
+
+func TestFrames(t *testing.T) {
+	msgs := []frameMsg{{1, "one"}, {2, ""}, {3, "three"}}
+
+	for _, tc := range []struct {
+		name  string
+		codec *Codec
+	}{
+		{"Plain", New()},
+		{"Checksum", New(WithChecksum())},
+		{"Compressed", New(WithChecksum(), WithCompression(0))},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			for i := range msgs {
+				assertNoError(t, tc.codec.WriteFrame(&buf, &msgs[i]))
+			}
+			r := &onlyReader{bytes.NewReader(buf.Bytes())}
+			for _, want := range msgs {
+				var got frameMsg
+				assertNoError(t, tc.codec.ReadFrame(r, &got))
+				assertEqual(t, want, got)
+			}
+			var got frameMsg
+			if err := tc.codec.ReadFrame(r, &got); err != io.EOF {
+				t.Fatalf("expected io.EOF after the last frame, got %v", err)
+			}
+		})
+	}
+
+	t.Run("DefaultCodec", func(t *testing.T) {
+		var buf bytes.Buffer
+		assertNoError(t, WriteFrame(&buf, &msgs[0]))
+		var got frameMsg
+		assertNoError(t, ReadFrame(&buf, &got))
+		assertEqual(t, msgs[0], got)
+	})
+
+	t.Run("CorruptBodySkipsFrame", func(t *testing.T) {
+		c := New(WithChecksum())
+		var buf bytes.Buffer
+		assertNoError(t, c.WriteFrame(&buf, &msgs[0]))
+		assertNoError(t, c.WriteFrame(&buf, &msgs[2]))
+		data := buf.Bytes()
+		data[6] ^= 0xff // inside the first body, after the 1-byte length and the CRC
+
+		r := bytes.NewReader(data)
+		var got frameMsg
+		if err := c.ReadFrame(r, &got); !errors.Is(err, ErrChecksum) {
+			t.Fatalf("expected ErrChecksum, got %v", err)
+		}
+		assertNoError(t, c.ReadFrame(r, &got))
+		assertEqual(t, msgs[2], got)
+	})
+
+	t.Run("Truncated", func(t *testing.T) {
+		var buf bytes.Buffer
+		assertNoError(t, WriteFrame(&buf, &msgs[0]))
+		var got frameMsg
+		if err := ReadFrame(bytes.NewReader(buf.Bytes()[:buf.Len()-1]), &got); err != io.ErrUnexpectedEOF {
+			t.Fatalf("expected io.ErrUnexpectedEOF, got %v", err)
+		}
+	})
+
+	t.Run("MaxSize", func(t *testing.T) {
+		big := frameMsg{Text: string(make([]byte, 100))}
+		var buf bytes.Buffer
+		assertNoError(t, WriteFrame(&buf, &big))
+		var got frameMsg
+		if err := New(WithMaxSize(50)).ReadFrame(&buf, &got); !errors.Is(err, ErrTooLarge) {
+			t.Fatalf("expected ErrTooLarge, got %v", err)
+		}
+		if err := New(WithMaxSize(50)).WriteFrame(io.Discard, &big); !errors.Is(err, ErrTooLarge) {
+			t.Fatalf("expected ErrTooLarge on write, got %v", err)
+		}
+		// A corrupt length must not allocate the claimed size.
+		if err := ReadFrame(bytes.NewReader([]byte{0xff, 0xff, 0xff, 0xff, 0x7f}), &got); !errors.Is(err, ErrTooLarge) {
+			t.Fatalf("expected ErrTooLarge for a corrupt length, got %v", err)
+		}
+	})
+}
+
+func TestSkipFrame(t *testing.T) {
+	c := New(WithChecksum())
+	var buf bytes.Buffer
+	assertNoError(t, c.WriteFrame(&buf, &frameMsg{ID: 1, Text: "skipped"}))
+	assertNoError(t, c.WriteFrame(&buf, &frameMsg{ID: 2}))
+
+	assertNoError(t, c.SkipFrame(&buf))
+	var got frameMsg
+	assertNoError(t, c.ReadFrame(&buf, &got))
+	assertEqual(t, frameMsg{ID: 2}, got)
+	if err := c.SkipFrame(&buf); err != io.EOF {
+		t.Fatalf("expected io.EOF, got %v", err)
+	}
+}
@@ -0,0 +1,164 @@
+package binary
+
+import (
+	"reflect"
+
+	. "github.com/tinywasm/fmt"
+)
+
+// Schemas returns the descriptors of every type registered or encoded with
+// the default codec, in the order they were first seen.
+func Schemas() []Schema {
+	return defaultCodec().Schemas()
+}
+
+// Schemas returns the descriptors of every type cached by this codec.
+func (c *Codec) Schemas() []Schema {
+	c.tb.mu.RLock()
+	entries := make([]schemaEntry, len(c.tb.schemas))
+	copy(entries, c.tb.schemas)
+	c.tb.mu.RUnlock()
+
+	out := make([]Schema, 0, len(entries))
+	for _, entry := range entries {
+		out = append(out, DescribeType(reflect.New(entry.Type).Interface()))
+	}
+	return out
+}
+
+// genTypes names the structs reachable from a set of schemas, for the code
+// generators.
+type genTypes struct {
+	op       string   // generator name used in errors
+	reserved []string // names the generated code uses itself
+	list     []genType
+}
+
+// genType is a struct to generate.
+type genType struct {
+	name      string // generated type name
+	goType    string // Go type name from the schema
+	s         *Schema
+	node      int
+	root      bool // root of one of the schemas
+	handler   string
+	versioned bool
+	version   uint
+}
+
+// collectRoots collects every struct reachable from schemas, whose roots
+// must be structs.
+func (g *genTypes) collectRoots(schemas []Schema) error {
+	for i := range schemas {
+		s := &schemas[i]
+		if len(s.Nodes) == 0 || s.Nodes[0].Kind != KindStruct {
+			return Err(g.op, "schema", s.Name, "root is not a struct")
+		}
+		if err := g.collect(s, 0, ""); err != nil {
+			return err
+		}
+		t := g.byGoType(s.Nodes[0].Type)
+		t.root, t.handler = true, s.Name
+		if s.Versioned {
+			t.versioned, t.version = true, s.Version
+		}
+	}
+	return nil
+}
+
+// collect adds every struct reachable from node n. hint names anonymous
+// structs after the field that holds them.
+func (g *genTypes) collect(s *Schema, n int, hint string) error {
+	if n < 0 || n >= len(s.Nodes) {
+		return Err(g.op, "node", D.Out, D.Of, D.Range)
+	}
+	node := &s.Nodes[n]
+	switch node.Kind {
+	case KindInvalid:
+		return Err(g.op, node.Type, D.Type, D.Not, D.Supported)
+	case KindPointer, KindSlice, KindArray:
+		return g.collect(s, node.Elem, hint)
+	case KindMap:
+		if err := g.collect(s, node.Key, hint+"Key"); err != nil {
+			return err
+		}
+		return g.collect(s, node.Elem, hint)
+	case KindStruct:
+		if g.byGoType(node.Type) != nil {
+			return nil
+		}
+		name := genTypeName(node.Type, hint)
+		for g.taken(name) {
+			name += "_"
+		}
+		g.list = append(g.list, genType{name: name, goType: node.Type, s: s, node: n})
+		for _, f := range node.Fields {
+			if err := g.collect(s, f.Type, name+f.Name); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (g *genTypes) byGoType(goType string) *genType {
+	for i := range g.list {
+		if g.list[i].goType == goType {
+			return &g.list[i]
+		}
+	}
+	return nil
+}
+
+// taken reports whether name is used by a collected type or reserved.
+func (g *genTypes) taken(name string) bool {
+	for _, r := range g.reserved {
+		if r == name {
+			return true
+		}
+	}
+	for _, t := range g.list {
+		if t.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// genTypeName derives an exported type name from a Go type name such as
+// "main.User" or "pkg.Box[int]". Anonymous structs use hint.
+func genTypeName(goType, hint string) string {
+	if HasPrefix(goType, "struct") {
+		goType = hint
+	}
+	base, args := goType, ""
+	if i := Index(goType, "["); i >= 0 {
+		base, args = goType[:i], goType[i:]
+	}
+	if i := LastIndex(base, "."); i >= 0 {
+		base = base[i+1:]
+	}
+
+	out := make([]byte, 0, len(goType))
+	for _, c := range []byte(base + args) {
+		if isIdentByte(c, len(out) == 0) {
+			out = append(out, c)
+		} else if len(out) > 0 && out[len(out)-1] != '_' {
+			out = append(out, '_')
+		}
+	}
+	for len(out) > 0 && out[len(out)-1] == '_' {
+		out = out[:len(out)-1]
+	}
+	if len(out) == 0 {
+		return "Struct"
+	}
+	if out[0] >= 'a' && out[0] <= 'z' {
+		out[0] -= 'a' - 'A'
+	}
+	return string(out)
+}
+
+func isIdentByte(c byte, first bool) bool {
+	return c == '_' || c == '$' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (!first && c >= '0' && c <= '9')
+}
@@ -0,0 +1,23 @@
+package binary
+
+import "testing"
+
+func TestGenTypeName(t *testing.T) {
+	assertEqual(t, "User", genTypeName("main.User", ""))
+	assertEqual(t, "Box_int", genTypeName("pkg.Box[int]", ""))
+	assertEqual(t, "Box_other_pkg_T", genTypeName("pkg.Box[other/pkg.T]", ""))
+	assertEqual(t, "UserInline", genTypeName("struct { A uint8 }", "UserInline"))
+}
+
+func TestCodecSchemas(t *testing.T) {
+	c := New()
+	assertNoError(t, c.Register(&tsUser{}, &tsAddress{}))
+	schemas := c.Schemas()
+	assertEqual(t, 2, len(schemas))
+	assertEqual(t, true, schemas[0].Versioned)
+	assertEqual(t, uint(3), schemas[0].Version)
+	assertEqual(t, "binary.tsAddress", schemas[1].Name)
+
+	_, err := GenerateTypeScript(schemas...)
+	assertNoError(t, err)
+}
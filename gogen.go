@@ -0,0 +1,504 @@
+package binary
+
+import (
+	"bytes"
+	"strconv"
+
+	. "github.com/tinywasm/fmt"
+)
+
+// GoOptions configures GenerateGo.
+type GoOptions struct {
+	Package string // package clause of the generated file, "types" when empty
+	Codecs  bool   // also generate reflection-free BinaryAppend and BinaryRead methods
+}
+
+// GenerateGo returns gofmt-formatted Go source declaring a struct for every
+// struct reachable from the given schemas, with the same field order, types
+// and tags, so other services can decode the payloads without importing the
+// packages that own the types. Roots get a HandlerName method returning the
+// schema name, and a BinaryVersion method when they are versioned.
+//
+// Types the schema cannot describe are mapped to their wire equivalent:
+// named ints become the builtin of the same size and BinaryMarshaler fields
+// become []byte. Anonymous structs are named after the field that holds them.
+//
+// With Codecs, every struct also gets BinaryAppend(b []byte) []byte and
+// BinaryRead(data []byte) error, which write and read the same bytes as
+// Encode and Decode without reflection. Generate all the types of a package
+// in one call: the helpers they share are declared once per file.
+func GenerateGo(opts GoOptions, schemas ...Schema) ([]byte, error) {
+	g := &goGen{genTypes: genTypes{op: "GenerateGo", reserved: []string{"wireReader"}}, codecs: opts.Codecs}
+	if err := g.collectRoots(schemas); err != nil {
+		return nil, err
+	}
+
+	var body bytes.Buffer
+	for i := range g.list {
+		if err := g.writeType(&body, &g.list[i]); err != nil {
+			return nil, err
+		}
+	}
+	if g.codecs {
+		body.WriteString(goWireHelpers)
+	}
+
+	pkg := opts.Package
+	if pkg == "" {
+		pkg = "types"
+	}
+	var out bytes.Buffer
+	out.WriteString("// Code generated by github.com/tinywasm/binary. DO NOT EDIT.\n\npackage " + pkg + "\n")
+	switch {
+	case g.codecs && g.math:
+		out.WriteString("\nimport (\n\t\"errors\"\n\t\"math\"\n)\n")
+	case g.codecs:
+		out.WriteString("\nimport \"errors\"\n")
+	}
+	out.Write(body.Bytes())
+	return out.Bytes(), nil
+}
+
+// goGen writes the Go declarations of the collected types.
+type goGen struct {
+	genTypes
+	codecs bool
+	math   bool // generated code uses the math package
+	tmp    int  // counter for temporaries in readFields
+}
+
+// goBuiltins are the Go type names kept as they are in the schema.
+var goBuiltins = []string{"int", "int8", "int16", "int32", "int64", "uint", "uint8", "uint16", "uint32", "uint64", "uintptr"}
+
+// goTypeOf returns the Go type expression of node n.
+func (g *goGen) goTypeOf(s *Schema, n int) (string, error) {
+	node := &s.Nodes[n]
+	switch node.Kind {
+	case KindBool:
+		return "bool", nil
+	case KindInt, KindUint:
+		for _, b := range goBuiltins {
+			if node.Type == b {
+				return b, nil
+			}
+		}
+		if node.Kind == KindInt {
+			return "int" + strconv.Itoa(node.Bits), nil
+		}
+		return "uint" + strconv.Itoa(node.Bits), nil
+	case KindFloat32:
+		return "float32", nil
+	case KindFloat64:
+		return "float64", nil
+	case KindString:
+		return "string", nil
+	case KindBytes, KindMarshaler:
+		return "[]byte", nil
+	case KindPointer:
+		elem, err := g.goTypeOf(s, node.Elem)
+		return "*" + elem, err
+	case KindSlice:
+		elem, err := g.goTypeOf(s, node.Elem)
+		return "[]" + elem, err
+	case KindArray:
+		elem, err := g.goTypeOf(s, node.Elem)
+		return "[" + strconv.Itoa(node.Len) + "]" + elem, err
+	case KindMap:
+		key, err := g.goTypeOf(s, node.Key)
+		if err != nil {
+			return "", err
+		}
+		elem, err := g.goTypeOf(s, node.Elem)
+		return "map[" + key + "]" + elem, err
+	case KindStruct:
+		return g.byGoType(node.Type).name, nil
+	}
+	return "", Err("GenerateGo", node.Type, D.Type, D.Not, D.Supported)
+}
+
+// writeType writes the declaration and methods of t.
+func (g *goGen) writeType(w *bytes.Buffer, t *genType) error {
+	node := &t.s.Nodes[t.node]
+
+	// Align fields the way gofmt does: names in one column, and types in a
+	// column shared by each run of consecutive tagged fields.
+	types := make([]string, len(node.Fields))
+	nameWidth := 0
+	for i, f := range node.Fields {
+		typ, err := g.goTypeOf(t.s, f.Type)
+		if err != nil {
+			return err
+		}
+		types[i] = typ
+		if len(f.Name) > nameWidth {
+			nameWidth = len(f.Name)
+		}
+	}
+
+	w.WriteString("\n// " + t.name + " mirrors " + t.goType + ".\ntype " + t.name + " struct {\n")
+	for i := 0; i < len(node.Fields); {
+		end, typeWidth := i+1, len(types[i])
+		if node.Fields[i].Tag != "" {
+			for end < len(node.Fields) && node.Fields[end].Tag != "" {
+				if len(types[end]) > typeWidth {
+					typeWidth = len(types[end])
+				}
+				end++
+			}
+		}
+		for ; i < end; i++ {
+			f := node.Fields[i]
+			w.WriteString("\t" + f.Name + spaces(nameWidth-len(f.Name)+1) + types[i])
+			if f.Tag != "" {
+				w.WriteString(spaces(typeWidth-len(types[i])+1) + goTagLiteral(f.Tag))
+			}
+			w.WriteByte('\n')
+		}
+	}
+	w.WriteString("}\n")
+
+	if t.root {
+		w.WriteString("\n// HandlerName returns the name " + t.name + " is registered under.\n")
+		w.WriteString("func (*" + t.name + ") HandlerName() string { return " + strconv.Quote(t.handler) + " }\n")
+	}
+	if t.versioned {
+		w.WriteString("\n// BinaryVersion returns the version written before " + t.name + " payloads.\n")
+		w.WriteString("func (*" + t.name + ") BinaryVersion() uint { return " + strconv.FormatUint(uint64(t.version), 10) + " }\n")
+	}
+	if g.codecs {
+		g.writeCodecs(w, t)
+	}
+	return nil
+}
+
+// goTagLiteral quotes a struct tag as a raw string when possible.
+func goTagLiteral(tag string) string {
+	if Contains(tag, "`") {
+		return strconv.Quote(tag)
+	}
+	return "`" + tag + "`"
+}
+
+func spaces(n int) string {
+	return Convert(" ").Repeat(n).String()
+}
+
+// writeCodecs writes the reflection-free methods of t.
+func (g *goGen) writeCodecs(w *bytes.Buffer, t *genType) {
+	node := &t.s.Nodes[t.node]
+	version := strconv.FormatUint(uint64(t.version), 10)
+
+	w.WriteString("\n// BinaryAppend appends the encoding of v to b, as Encode writes it.\n")
+	w.WriteString("func (v *" + t.name + ") BinaryAppend(b []byte) []byte {\n")
+	if t.versioned {
+		w.WriteString("\tb = wireAppendUvarint(b, " + version + ")\n")
+	}
+	w.WriteString("\treturn v.appendFields(b)\n}\n")
+
+	w.WriteString("\n// BinaryRead decodes data written by Encode into v.\n")
+	w.WriteString("func (v *" + t.name + ") BinaryRead(data []byte) error {\n\tr := wireReader{data: data}\n")
+	if t.versioned {
+		w.WriteString("\tif version := r.uvarint(); r.err == nil && version != " + version + " {\n")
+		w.WriteString("\t\treturn errors.New(\"binary: " + t.name + " version mismatch\")\n\t}\n")
+	}
+	w.WriteString("\tv.readFields(&r)\n\treturn r.err\n}\n")
+
+	w.WriteString("\nfunc (v *" + t.name + ") appendFields(b []byte) []byte {\n")
+	for _, f := range node.Fields {
+		g.encodeNode(w, t.s, f.Type, "v."+f.Name, "\t", 0)
+	}
+	w.WriteString("\treturn b\n}\n")
+
+	g.tmp = 0
+	w.WriteString("\nfunc (v *" + t.name + ") readFields(r *wireReader) {\n")
+	for _, f := range node.Fields {
+		g.decodeNode(w, t.s, f.Type, "v."+f.Name, "\t")
+	}
+	w.WriteString("}\n")
+}
+
+// encodeNode writes the statements that append expr, of node n, to b.
+func (g *goGen) encodeNode(w *bytes.Buffer, s *Schema, n int, expr, indent string, depth int) {
+	node := &s.Nodes[n]
+	d := strconv.Itoa(depth)
+	switch node.Kind {
+	case KindBool:
+		w.WriteString(indent + "b = wireAppendBool(b, " + expr + ")\n")
+	case KindInt, KindUint:
+		enc, _ := node.intEncoding()
+		switch {
+		case enc.size > 0:
+			fn := "wireAppendFixed"
+			if enc.bigEndian {
+				fn = "wireAppendFixedBE"
+			}
+			w.WriteString(indent + "b = " + fn + "(b, uint64(" + expr + "), " + strconv.Itoa(enc.size) + ")\n")
+		case node.Kind == KindInt && !enc.plain:
+			w.WriteString(indent + "b = wireAppendVarint(b, int64(" + expr + "))\n")
+		default:
+			w.WriteString(indent + "b = wireAppendUvarint(b, uint64(" + expr + "))\n")
+		}
+	case KindFloat32:
+		g.math = true
+		w.WriteString(indent + "b = wireAppendFixed(b, uint64(math.Float32bits(" + expr + ")), 4)\n")
+	case KindFloat64:
+		g.math = true
+		w.WriteString(indent + "b = wireAppendFixed(b, math.Float64bits(" + expr + "), 8)\n")
+	case KindString:
+		w.WriteString(indent + "b = wireAppendString(b, " + expr + ")\n")
+	case KindBytes, KindMarshaler:
+		w.WriteString(indent + "b = wireAppendBytes(b, " + expr + ")\n")
+	case KindPointer:
+		w.WriteString(indent + "if " + expr + " == nil {\n" + indent + "\tb = append(b, 1)\n" + indent + "} else {\n" + indent + "\tb = append(b, 0)\n")
+		g.encodeNode(w, s, node.Elem, "(*"+expr+")", indent+"\t", depth)
+		w.WriteString(indent + "}\n")
+	case KindSlice, KindArray:
+		if node.Kind == KindSlice {
+			w.WriteString(indent + "b = wireAppendUvarint(b, uint64(len(" + expr + ")))\n")
+		}
+		w.WriteString(indent + "for i" + d + " := range " + expr + " {\n")
+		g.encodeNode(w, s, node.Elem, expr+"[i"+d+"]", indent+"\t", depth+1)
+		w.WriteString(indent + "}\n")
+	case KindMap:
+		w.WriteString(indent + "b = wireAppendUvarint(b, uint64(len(" + expr + ")))\n")
+		w.WriteString(indent + "for k" + d + ", x" + d + " := range " + expr + " {\n")
+		g.encodeNode(w, s, node.Key, "k"+d, indent+"\t", depth+1)
+		g.encodeNode(w, s, node.Elem, "x"+d, indent+"\t", depth+1)
+		w.WriteString(indent + "}\n")
+	case KindStruct:
+		w.WriteString(indent + "b = " + expr + ".appendFields(b)\n")
+	}
+}
+
+// decodeNode writes the statements that read node n into the addressable
+// expression target.
+func (g *goGen) decodeNode(w *bytes.Buffer, s *Schema, n int, target, indent string) {
+	node := &s.Nodes[n]
+	typ, _ := g.goTypeOf(s, n)
+	switch node.Kind {
+	case KindBool:
+		w.WriteString(indent + target + " = r.bool()\n")
+	case KindInt, KindUint:
+		enc, _ := node.intEncoding()
+		read := "r.uvarint()"
+		switch {
+		case enc.size > 0 && enc.bigEndian:
+			read = "r.fixedBE(" + strconv.Itoa(enc.size) + ")"
+		case enc.size > 0:
+			read = "r.fixed(" + strconv.Itoa(enc.size) + ")"
+		case node.Kind == KindInt && !enc.plain:
+			read = "r.varint()"
+		}
+		if node.Kind == KindInt && read != "r.varint()" {
+			// Sign-extend from the width on the wire.
+			inner := "int" + strconv.Itoa(8*enc.size)
+			if enc.size == 0 {
+				inner = "int64"
+			}
+			if typ == inner {
+				read = inner + "(" + read + ")"
+			} else {
+				read = typ + "(" + inner + "(" + read + "))"
+			}
+			w.WriteString(indent + target + " = " + read + "\n")
+			return
+		}
+		w.WriteString(indent + target + " = " + goConvert(typ, read) + "\n")
+	case KindFloat32:
+		w.WriteString(indent + target + " = math.Float32frombits(uint32(r.fixed(4)))\n")
+	case KindFloat64:
+		w.WriteString(indent + target + " = math.Float64frombits(r.fixed(8))\n")
+	case KindString:
+		w.WriteString(indent + target + " = r.string()\n")
+	case KindBytes, KindMarshaler:
+		w.WriteString(indent + target + " = r.bytes()\n")
+	case KindPointer:
+		w.WriteString(indent + "if r.bool() {\n" + indent + "\t" + target + " = nil\n" + indent + "} else {\n")
+		w.WriteString(indent + "\t" + target + " = new(" + typ[1:] + ")\n")
+		g.decodeNode(w, s, node.Elem, "(*"+target+")", indent+"\t")
+		w.WriteString(indent + "}\n")
+	case KindSlice:
+		d := g.temp()
+		elem, _ := g.goTypeOf(s, node.Elem)
+		w.WriteString(indent + "n" + d + " := r.uvarint()\n")
+		w.WriteString(indent + target + " = make(" + typ + ", 0, r.capHint(n" + d + "))\n")
+		w.WriteString(indent + "for i" + d + " := uint64(0); i" + d + " < n" + d + " && r.err == nil; i" + d + "++ {\n")
+		w.WriteString(indent + "\tvar x" + d + " " + elem + "\n")
+		g.decodeNode(w, s, node.Elem, "x"+d, indent+"\t")
+		w.WriteString(indent + "\t" + target + " = append(" + target + ", x" + d + ")\n" + indent + "}\n")
+	case KindArray:
+		d := g.temp()
+		w.WriteString(indent + "for i" + d + " := range " + target + " {\n")
+		g.decodeNode(w, s, node.Elem, target+"[i"+d+"]", indent+"\t")
+		w.WriteString(indent + "}\n")
+	case KindMap:
+		d := g.temp()
+		key, _ := g.goTypeOf(s, node.Key)
+		elem, _ := g.goTypeOf(s, node.Elem)
+		w.WriteString(indent + "n" + d + " := r.uvarint()\n")
+		w.WriteString(indent + target + " = make(" + typ + ", r.capHint(n" + d + "))\n")
+		w.WriteString(indent + "for i" + d + " := uint64(0); i" + d + " < n" + d + " && r.err == nil; i" + d + "++ {\n")
+		w.WriteString(indent + "\tvar k" + d + " " + key + "\n")
+		w.WriteString(indent + "\tvar x" + d + " " + elem + "\n")
+		g.decodeNode(w, s, node.Key, "k"+d, indent+"\t")
+		g.decodeNode(w, s, node.Elem, "x"+d, indent+"\t")
+		w.WriteString(indent + "\t" + target + "[k" + d + "] = x" + d + "\n" + indent + "}\n")
+	case KindStruct:
+		w.WriteString(indent + target + ".readFields(r)\n")
+	}
+}
+
+// temp returns a new suffix for temporaries of the current readFields.
+func (g *goGen) temp() string {
+	g.tmp++
+	return strconv.Itoa(g.tmp - 1)
+}
+
+// goConvert converts the int64 or uint64 expression expr to typ.
+func goConvert(typ, expr string) string {
+	if typ == "int64" || typ == "uint64" {
+		return expr
+	}
+	return typ + "(" + expr + ")"
+}
+
+// goWireHelpers implements the native format for the generated codecs.
+const goWireHelpers = `
+var (
+	errWireEOF      = errors.New("binary: unexpected end of data")
+	errWireOverflow = errors.New("binary: varint overflows a 64-bit integer")
+)
+
+func wireAppendUvarint(b []byte, x uint64) []byte {
+	for x >= 0x80 {
+		b = append(b, byte(x)|0x80)
+		x >>= 7
+	}
+	return append(b, byte(x))
+}
+
+func wireAppendVarint(b []byte, v int64) []byte {
+	x := uint64(v) << 1
+	if v < 0 {
+		x = ^x
+	}
+	return wireAppendUvarint(b, x)
+}
+
+func wireAppendBool(b []byte, v bool) []byte {
+	if v {
+		return append(b, 1)
+	}
+	return append(b, 0)
+}
+
+func wireAppendFixed(b []byte, v uint64, n int) []byte {
+	for i := 0; i < n; i++ {
+		b = append(b, byte(v>>(8*i)))
+	}
+	return b
+}
+
+func wireAppendFixedBE(b []byte, v uint64, n int) []byte {
+	for i := n - 1; i >= 0; i-- {
+		b = append(b, byte(v>>(8*i)))
+	}
+	return b
+}
+
+func wireAppendString(b []byte, s string) []byte {
+	return append(wireAppendUvarint(b, uint64(len(s))), s...)
+}
+
+func wireAppendBytes(b []byte, v []byte) []byte {
+	return append(wireAppendUvarint(b, uint64(len(v))), v...)
+}
+
+// wireReader reads the native format. The first error is kept in err and
+// later reads return zero values.
+type wireReader struct {
+	data []byte
+	err  error
+}
+
+func (r *wireReader) take(n uint64) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if n > uint64(len(r.data)) {
+		r.err = errWireEOF
+		return nil
+	}
+	b := r.data[:n]
+	r.data = r.data[n:]
+	return b
+}
+
+func (r *wireReader) uvarint() uint64 {
+	var x uint64
+	for s := uint(0); s < 64; s += 7 {
+		b := r.take(1)
+		if b == nil {
+			return 0
+		}
+		if b[0] < 0x80 {
+			if s == 63 && b[0] > 1 {
+				break
+			}
+			return x | uint64(b[0])<<s
+		}
+		x |= uint64(b[0]&0x7f) << s
+	}
+	r.err = errWireOverflow
+	return 0
+}
+
+func (r *wireReader) varint() int64 {
+	u := r.uvarint()
+	x := int64(u >> 1)
+	if u&1 != 0 {
+		x = ^x
+	}
+	return x
+}
+
+func (r *wireReader) bool() bool {
+	b := r.take(1)
+	return b != nil && b[0] == 1
+}
+
+func (r *wireReader) fixed(n int) (v uint64) {
+	b := r.take(uint64(n))
+	for i := len(b) - 1; i >= 0; i-- {
+		v = v<<8 | uint64(b[i])
+	}
+	return v
+}
+
+func (r *wireReader) fixedBE(n int) (v uint64) {
+	for _, c := range r.take(uint64(n)) {
+		v = v<<8 | uint64(c)
+	}
+	return v
+}
+
+func (r *wireReader) string() string {
+	return string(r.take(r.uvarint()))
+}
+
+func (r *wireReader) bytes() []byte {
+	b := r.take(r.uvarint())
+	if b == nil {
+		return nil
+	}
+	return append([]byte{}, b...)
+}
+
+// capHint bounds a length read from the data by the bytes left.
+func (r *wireReader) capHint(n uint64) int {
+	if n > uint64(len(r.data)) {
+		return len(r.data)
+	}
+	return int(n)
+}
+`
@@ -0,0 +1,131 @@
+package binary
+
+import (
+	"encoding/hex"
+	"go/format"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGenerateGo(t *testing.T) {
+	src, err := GenerateGo(GoOptions{Package: "users"}, DescribeType(&tsUser{}))
+	assertNoError(t, err)
+
+	formatted, err := format.Source(src)
+	assertNoError(t, err)
+	assertEqual(t, string(formatted), string(src))
+
+	out := string(src)
+	for _, want := range []string{
+		"package users\n",
+		"type TsUser struct {\n\tID     int64  `json:\"id\"`\n\tName   string `json:\"name\"`\n\tAge    int32\n",
+		"\tAddr   *TsAddress\n",
+		"\tCounts map[string]uint64\n",
+		"\tInline TsUserInline\n",
+		"\tOdd    int     `json:\"odd-name\"`\n",
+		"\tSeq    []int16 `binary:\"fixed32,be\"`\n",
+		"type TsUserInline struct {\n\tA uint8\n}\n",
+		"func (*TsUser) HandlerName() string { return \"binary.tsUser\" }\n",
+		"func (*TsUser) BinaryVersion() uint { return 3 }\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("missing %q in:\n%s", want, out)
+		}
+	}
+	for _, absent := range []string{"Skip", "import", "BinaryAppend", "func (*TsAddress) HandlerName"} {
+		if strings.Contains(out, absent) {
+			t.Errorf("unexpected %q in:\n%s", absent, out)
+		}
+	}
+
+	src, err = GenerateGo(GoOptions{Codecs: true}, DescribeType(&tsUser{}))
+	assertNoError(t, err)
+	formatted, err = format.Source(src)
+	assertNoError(t, err)
+	assertEqual(t, string(formatted), string(src))
+	assertEqual(t, true, strings.Contains(string(src), "package types\n\nimport (\n\t\"errors\"\n\t\"math\"\n)\n"))
+	assertEqual(t, true, strings.Contains(string(src), "func (v *TsAddress) BinaryRead(data []byte) error {"))
+}
+
+// TestGeneratedGoGolden builds the generated codecs in a scratch module and
+// checks they read and write the same bytes as Encode.
+func TestGeneratedGoGolden(t *testing.T) {
+	if testing.Short() {
+		t.Skip("builds a scratch module")
+	}
+	goBin, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("go not installed")
+	}
+
+	values := []tsUser{
+		{},
+		{
+			ID: -1 << 62, Name: "Zoë", Age: -2147483648, Score: -0.1, Ratio: 3.25,
+			Admin: true, Tags: []string{"a", ""}, Addr: &tsAddress{City: "Lima", Zip: 65535},
+			Home: tsAddress{City: "x"}, Raw: []byte{0, 255}, Counts: map[string]uint64{"k": 1<<64 - 1},
+			Grid: [2]int8{-128, 127}, Nested: []*tsAddress{nil, {Zip: 1}}, Big: 300,
+			Hash: 0xdeadbeef, Port: 8080, Delta: -5, Seq: []int16{-1, 2}, Odd: -5,
+		},
+	}
+	values[1].Inline.A = 200
+
+	var golden []string
+	for i := range values {
+		var data []byte
+		assertNoError(t, Encode(&values[i], &data))
+		golden = append(golden, hex.EncodeToString(data))
+	}
+
+	src, err := GenerateGo(GoOptions{Package: "main", Codecs: true}, DescribeType(&tsUser{}))
+	assertNoError(t, err)
+
+	dir := t.TempDir()
+	main := `package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"os"
+)
+
+func main() {
+	for _, h := range os.Args[1:] {
+		data, _ := hex.DecodeString(h)
+		var u TsUser
+		if err := u.BinaryRead(data); err != nil {
+			fmt.Println(err)
+			continue
+		}
+		fmt.Println(hex.EncodeToString(u.BinaryAppend(nil)))
+	}
+	var u TsUser
+	fmt.Println(u.BinaryRead([]byte{1}))
+	fmt.Println(u.BinaryRead([]byte{3, 2}))
+}
+`
+	assertNoError(t, os.WriteFile(filepath.Join(dir, "go.mod"), []byte("module gen\n\ngo 1.21\n"), 0o644))
+	assertNoError(t, os.WriteFile(filepath.Join(dir, "gen.go"), src, 0o644))
+	assertNoError(t, os.WriteFile(filepath.Join(dir, "main.go"), []byte(main), 0o644))
+
+	cmd := exec.Command(goBin, append([]string{"run", "."}, golden...)...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GOFLAGS=-mod=mod", "GOWORK=off")
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("go run: %v\n%s", err, out)
+	}
+
+	lines := strings.Split(strings.TrimSpace(string(out)), "\n")
+	want := append(golden,
+		"binary: TsUser version mismatch",
+		"binary: unexpected end of data",
+	)
+	assertEqual(t, len(want), len(lines))
+	for i := range want {
+		assertEqual(t, want[i], lines[i])
+	}
+}
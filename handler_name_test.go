@@ -0,0 +1,89 @@
+package binary
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type collideA struct{ A string }
+
+func (*collideA) HandlerName() string { return "collide" }
+
+type collideB struct{ B int }
+
+func (*collideB) HandlerName() string { return "collide" }
+
+type namedLater struct{ V string }
+
+func (*namedLater) HandlerName() string { return "named.later" }
+
+func TestHandlerNameCollision(t *testing.T) {
+	var logged []string
+	inst := newInstance(func(msg ...any) {
+		for _, m := range msg {
+			if s, ok := m.(string); ok {
+				logged = append(logged, s)
+			}
+		}
+	})
+
+	var buf []byte
+	if err := inst.encodeTo(&collideA{A: "a"}, &byteSliceWriter{&buf}); err != nil {
+		t.Fatalf("first type should encode: %v", err)
+	}
+
+	err := inst.encodeTo(&collideB{B: 1}, &byteSliceWriter{&buf})
+	if err == nil || !strings.Contains(err.Error(), `HandlerName "collide" already used by binary.collideA`) {
+		t.Fatalf("expected collision error on encode, got %v", err)
+	}
+
+	err = inst.decode([]byte{2}, &collideB{})
+	if err == nil {
+		t.Fatal("expected collision error on decode")
+	}
+
+	if len(logged) == 0 || !strings.Contains(logged[0], "collide") {
+		t.Errorf("expected collision to be logged, got %v", logged)
+	}
+
+	// The name stays bound to the first type.
+	_, typ, found := inst.findSchemaByName("collide")
+	if !found || typ != reflect.TypeOf(collideA{}) {
+		t.Errorf("expected name bound to collideA, got %v", typ)
+	}
+	if _, found := inst.findSchema(reflect.TypeOf(collideB{})); found {
+		t.Error("colliding type should not be cached")
+	}
+}
+
+func TestHandlerNameBoundAfterUnnamedScan(t *testing.T) {
+	inst := newInstance()
+	typ := reflect.TypeOf(namedLater{})
+
+	// A value receiver does not expose HandlerName, so the type is cached unnamed.
+	if _, err := inst.scanToCache(typ, ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, found := inst.findSchemaByName("named.later"); found {
+		t.Fatal("name should not be bound yet")
+	}
+
+	var buf []byte
+	if err := inst.encodeTo(&namedLater{V: "x"}, &byteSliceWriter{&buf}); err != nil {
+		t.Fatal(err)
+	}
+	if _, got, found := inst.findSchemaByName("named.later"); !found || got != typ {
+		t.Error("expected name to be bound to the cached type")
+	}
+}
+
+// byteSliceWriter appends writes to a byte slice.
+type byteSliceWriter struct {
+	b *[]byte
+}
+
+func (w *byteSliceWriter) Write(p []byte) (int, error) {
+	*w.b = append(*w.b, p...)
+	return len(p), nil
+}
@@ -0,0 +1,49 @@
+package binary
+
+import (
+	"reflect"
+)
+
+// encodeHeader writes the top-level headers of a value of type t before it is
+// encoded: the BinaryVersion when t is versioned, then the schema fingerprint
+// when enabled on the instance.
+func (e *encoder) encodeHeader(t reflect.Type) error {
+	if version, ok := e.tb.versionOf(t); ok {
+		e.writeUvarint(uint64(version))
+	}
+	if e.tb.fingerprint {
+		e.writeUint64(e.tb.fingerprintOf(t))
+	}
+	return e.err
+}
+
+// decodeHeader reads and checks the top-level headers written by encodeHeader
+// before the value rv is decoded. When the payload holds an older version,
+// the old value is decoded and migrated into rv and done is true.
+func (d *decoder) decodeHeader(rv reflect.Value) (done bool, err error) {
+	if v, ok := d.tb.versionOf(rv.Type()); ok {
+		var version uint64
+		if version, err = d.readUvarint(); err != nil {
+			return false, err
+		}
+		if current := uint64(v); version != current {
+			return true, d.migrate(uint(version), uint(current), rv)
+		}
+	}
+	return false, d.checkFingerprint(rv.Type())
+}
+
+// checkFingerprint reads the fingerprint header, when enabled, and compares
+// it with the fingerprint of t.
+func (d *decoder) checkFingerprint(t reflect.Type) error {
+	if d.tb.fingerprint {
+		got, err := d.readUint64()
+		if err != nil {
+			return err
+		}
+		if want := d.tb.fingerprintOf(t); got != want {
+			return &SchemaMismatchError{Type: t.String(), Expected: want, Got: got}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,301 @@
+package binary
+
+import (
+	"reflect"
+	"strconv"
+
+	. "github.com/tinywasm/fmt"
+)
+
+// intEncoding is the wire form of an integer, chosen with the options of a
+// `binary` struct tag:
+//
+//	fixed32, fixed64  fixed-width little-endian two's complement
+//	be                big-endian; the type's own width unless fixed32/64 is given
+//	uvarint           varint of the two's complement bits, without zigzag
+//
+// The options apply to the integers of the field: the field itself, the
+// value it points to and the elements of its slices, arrays and map values.
+// The zero intEncoding is the default zigzag varint (varint for unsigned).
+type intEncoding struct {
+	size      int  // bytes of a fixed-width integer, 0 for varints
+	bigEndian bool // fixed-width bytes are most significant first
+	plain     bool // signed varint without zigzag
+}
+
+// parseIntEncoding reads the integer options of a comma-separated list, as
+// written in a binary tag or in Node.Encoding. Unknown options are an error.
+func parseIntEncoding(opts string) (intEncoding, error) {
+	var enc intEncoding
+	be := false
+	for _, opt := range Convert(opts).Split(",") {
+		switch opt {
+		case "uvarint":
+			enc.plain = true
+		case "be":
+			be = true
+		case "fixed8", "fixed16", "fixed32", "fixed64":
+			if enc.size != 0 {
+				return intEncoding{}, Err("binary tag", opts, "sets two widths")
+			}
+			bits, _ := strconv.Atoi(opt[len("fixed"):])
+			enc.size = bits / 8
+		default:
+			if opt != "" {
+				return intEncoding{}, Err("integer encoding", opt, D.Not, D.Supported)
+			}
+		}
+	}
+	if enc.plain && (be || enc.size != 0) {
+		return intEncoding{}, Err("binary tag", opts, "mixes uvarint with a fixed width")
+	}
+	if be {
+		enc.bigEndian = true
+		if enc.size == 0 {
+			enc.size = -1 // the width of the type, see forType
+		}
+	}
+	return enc, nil
+}
+
+// fieldIntEncoding returns the integer encoding set by the binary tag of f.
+// Options of other features are skipped: protobuf field numbers and "sint",
+// the "len=" and "pad=" sizes of layouts and "-". Any other unknown option,
+// such as a misspelled width, is an error.
+func fieldIntEncoding(f reflect.StructField) (intEncoding, error) {
+	tag, _ := Convert(string(f.Tag)).TagValue("binary")
+	opts := make([]string, 0, 2)
+	for _, opt := range Convert(tag).Split(",") {
+		if _, err := strconv.ParseUint(opt, 10, 32); err == nil {
+			continue
+		}
+		if opt == "" || opt == "-" || opt == "sint" || HasPrefix(opt, "len=") || HasPrefix(opt, "pad=") {
+			continue
+		}
+		opts = append(opts, opt)
+	}
+	enc, err := parseIntEncoding(Convert(opts).Join(",").String())
+	if err != nil {
+		return intEncoding{}, Err(f.Name, err.Error())
+	}
+	return enc, nil
+}
+
+// isDefault reports whether enc writes the default varints.
+func (enc intEncoding) isDefault() bool {
+	return enc == intEncoding{}
+}
+
+// forType resolves enc for an integer of type t: a bare "be" takes the size
+// of t (8 bytes for int and uint, whatever the platform) and uvarint is
+// already the encoding of unsigned integers.
+func (enc intEncoding) forType(t reflect.Type) intEncoding {
+	if enc.size < 0 {
+		enc.size = 8
+		if k := t.Kind(); k != reflect.Int && k != reflect.Uint {
+			enc.size = t.Bits() / 8
+		}
+	}
+	if t.Kind() >= reflect.Uint && t.Kind() <= reflect.Uint64 {
+		enc.plain = false
+	}
+	return enc
+}
+
+// String returns enc in the form stored in Node.Encoding, e.g. "fixed32,be".
+func (enc intEncoding) String() string {
+	switch {
+	case enc.plain:
+		return "uvarint"
+	case enc.size < 0:
+		return "be"
+	case enc.size == 0:
+		return ""
+	case enc.bigEndian:
+		return "fixed" + strconv.Itoa(enc.size*8) + ",be"
+	}
+	return "fixed" + strconv.Itoa(enc.size*8)
+}
+
+func (enc intEncoding) rangeError(v string) error {
+	return Err(enc.String(), v, D.Out, D.Of, D.Range)
+}
+
+// intEncoding returns the encoding of an integer node.
+func (n *Node) intEncoding() (intEncoding, error) {
+	return parseIntEncoding(n.Encoding)
+}
+
+// ------------------------------------------------------------------------------
+
+// writeIntAs writes the signed integer v with encoding enc.
+func (e *encoder) writeIntAs(enc intEncoding, v int64) error {
+	switch {
+	case enc.size > 0:
+		if bits := 8 * enc.size; bits < 64 && (v < -1<<(bits-1) || v >= 1<<(bits-1)) {
+			return enc.rangeError(strconv.FormatInt(v, 10))
+		}
+		e.writeFixed(enc, uint64(v))
+	case enc.plain:
+		e.writeUvarint(uint64(v))
+	default:
+		e.writeVarint(v)
+	}
+	return e.err
+}
+
+// writeUintAs writes the unsigned integer v with encoding enc.
+func (e *encoder) writeUintAs(enc intEncoding, v uint64) error {
+	if enc.size > 0 {
+		if bits := 8 * enc.size; bits < 64 && v >= 1<<bits {
+			return enc.rangeError(strconv.FormatUint(v, 10))
+		}
+		e.writeFixed(enc, v)
+		return e.err
+	}
+	e.writeUvarint(v)
+	return e.err
+}
+
+// writeFixed writes the low enc.size bytes of v.
+func (e *encoder) writeFixed(enc intEncoding, v uint64) {
+	b := e.scratch[:enc.size]
+	for i := range b {
+		if enc.bigEndian {
+			b[len(b)-1-i] = byte(v >> (8 * i))
+		} else {
+			b[i] = byte(v >> (8 * i))
+		}
+	}
+	e.write(b)
+}
+
+// readIntAs reads a signed integer written with encoding enc.
+func (d *decoder) readIntAs(enc intEncoding) (int64, error) {
+	switch {
+	case enc.size > 0:
+		u, err := d.readFixed(enc)
+		shift := 64 - 8*enc.size
+		return int64(u<<shift) >> shift, err
+	case enc.plain:
+		u, err := d.readUvarint()
+		return int64(u), err
+	}
+	return d.readVarint()
+}
+
+// readUintAs reads an unsigned integer written with encoding enc.
+func (d *decoder) readUintAs(enc intEncoding) (uint64, error) {
+	if enc.size > 0 {
+		return d.readFixed(enc)
+	}
+	return d.readUvarint()
+}
+
+// readFixed reads an enc.size byte integer.
+func (d *decoder) readFixed(enc intEncoding) (uint64, error) {
+	b, err := d.reader.Slice(enc.size)
+	if err != nil {
+		return 0, err
+	}
+	if enc.bigEndian {
+		return readBigEndian(b), nil
+	}
+	var v uint64
+	for i := len(b) - 1; i >= 0; i-- {
+		v = v<<8 | uint64(b[i])
+	}
+	return v, nil
+}
+
+// ------------------------------------------------------------------------------
+
+// intcodec encodes integers with the encoding chosen by their binary tag.
+type intcodec struct {
+	enc    intEncoding
+	signed bool
+}
+
+// Encode encodes a value into the encoder.
+func (c *intcodec) encodeTo(e *encoder, rv reflect.Value) error {
+	if c.signed {
+		return e.writeIntAs(c.enc, rv.Int())
+	}
+	return e.writeUintAs(c.enc, rv.Uint())
+}
+
+// Decode decodes into a reflect value from the decoder.
+func (c *intcodec) decodeTo(d *decoder, rv reflect.Value) error {
+	if c.signed {
+		v, err := d.readIntAs(c.enc)
+		if err == nil && rv.OverflowInt(v) {
+			return Err(rv.Type().String(), strconv.FormatInt(v, 10), D.Out, D.Of, D.Range)
+		}
+		rv.SetInt(v)
+		return err
+	}
+	v, err := d.readUintAs(c.enc)
+	if err == nil && rv.OverflowUint(v) {
+		return Err(rv.Type().String(), strconv.FormatUint(v, 10), D.Out, D.Of, D.Range)
+	}
+	rv.SetUint(v)
+	return err
+}
+
+// scanEncodedType is scanType for a field with integer options: the
+// integers reached through pointers, slices, arrays and map values use enc.
+func scanEncodedType(t reflect.Type, enc intEncoding) (codec, error) {
+	pt := reflect.PointerTo(t)
+	if t.Implements(binaryMarshalerType) || pt.Implements(binaryMarshalerType) {
+		return nil, Err("binary tag", enc.String(), D.Not, D.Supported, "for", t.String())
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		elem, err := scanEncodedType(t.Elem(), enc)
+		if err != nil {
+			return nil, err
+		}
+		return &reflectPointercodec{elemcodec: elem}, nil
+	case reflect.Array:
+		elem, err := scanEncodedType(t.Elem(), enc)
+		if err != nil {
+			return nil, err
+		}
+		return &reflectArraycodec{elemcodec: elem}, nil
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			break // []byte is written as bytes
+		}
+		if t.Elem().Kind() == reflect.Ptr {
+			elem, err := scanEncodedType(t.Elem().Elem(), enc)
+			if err != nil {
+				return nil, err
+			}
+			return &reflectSliceOfPtrcodec{elemType: t.Elem().Elem(), elemcodec: elem}, nil
+		}
+		elem, err := scanEncodedType(t.Elem(), enc)
+		if err != nil {
+			return nil, err
+		}
+		return &reflectSlicecodec{elemcodec: elem}, nil
+	case reflect.Map:
+		key, err := scanType(t.Key())
+		if err != nil {
+			return nil, err
+		}
+		elem, err := scanEncodedType(t.Elem(), enc)
+		if err != nil {
+			return nil, err
+		}
+		return &mapcodec{keycodec: key, valuecodec: elem}, nil
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int, reflect.Int64:
+		return &intcodec{enc: enc.forType(t), signed: true}, nil
+	case reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint, reflect.Uint64:
+		if enc = enc.forType(t); enc.isDefault() {
+			return new(varuintcodec), nil
+		}
+		return &intcodec{enc: enc}, nil
+	}
+	return nil, Err("binary tag", enc.String(), D.Not, D.Supported, "for", t.String())
+}
@@ -0,0 +1,185 @@
+package binary
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type hintRecord struct {
+	Hash   uint32           `binary:"fixed32"`
+	Port   uint16           `binary:"be"`
+	ID     int64            `binary:"fixed64,be"`
+	Delta  int32            `binary:"uvarint"`
+	Seq    []int16          `binary:"fixed32"`
+	Opt    *uint32          `binary:"be"`
+	Counts map[string]int64 `binary:"fixed64"`
+	Plain  int32
+	Number int32 `binary:"3"` // protobuf field numbers leave the encoding alone
+}
+
+func TestIntEncodingVectors(t *testing.T) {
+	seven := uint32(7)
+	in := hintRecord{
+		Hash: 0xdeadbeef, Port: 8080, ID: -2, Delta: -1, Seq: []int16{1, -1},
+		Opt: &seven, Counts: map[string]int64{"a": 1}, Plain: -1, Number: 3,
+	}
+	var data []byte
+	assertNoError(t, Encode(&in, &data))
+	assertEqualBytes(t, []byte{
+		0xef, 0xbe, 0xad, 0xde, // Hash
+		0x1f, 0x90, // Port
+		0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xfe, // ID
+		0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x01, // Delta
+		0x02, 0x01, 0x00, 0x00, 0x00, 0xff, 0xff, 0xff, 0xff, // Seq
+		0x00, 0x00, 0x00, 0x00, 0x07, // Opt
+		0x01, 0x01, 'a', 0x01, 0, 0, 0, 0, 0, 0, 0, // Counts
+		0x01, // Plain
+		0x06, // Number
+	}, data)
+
+	size, err := EncodedSize(&in)
+	assertNoError(t, err)
+	assertEqual(t, len(data), size)
+
+	var out hintRecord
+	assertNoError(t, Decode(data, &out))
+	if !reflect.DeepEqual(in, out) {
+		t.Fatalf("round trip: got %+v, want %+v", out, in)
+	}
+}
+
+func TestIntEncodingErrors(t *testing.T) {
+	var data []byte
+	err := Encode(&struct {
+		A int64 `binary:"fixed32"`
+	}{A: 1 << 40}, &data)
+	if err == nil || !strings.Contains(err.Error(), "fixed32") {
+		t.Fatalf("out of range value: %v", err)
+	}
+
+	assertNoError(t, Encode(&struct {
+		A uint32 `binary:"fixed32"`
+	}{A: 300}, &data))
+	var narrow struct {
+		A uint8 `binary:"fixed32"`
+	}
+	if err := Decode(data, &narrow); err == nil {
+		t.Fatal("decoding 300 into a uint8 should fail")
+	}
+
+	for _, v := range []any{
+		&struct {
+			A int32 `binary:"uvarint,fixed32"`
+		}{},
+		&struct {
+			A int32 `binary:"fixed32,fixed64"`
+		}{},
+		&struct {
+			A string `binary:"fixed32"`
+		}{},
+		&struct {
+			A []byte `binary:"be"`
+		}{},
+		&struct {
+			A int32 `binary:"fixd32"`
+		}{},
+	} {
+		if err := Encode(v, &data); err == nil {
+			t.Errorf("%T: expected an error", v)
+		}
+	}
+
+	// A misspelled option fails at registration instead of falling back to
+	// varints, while the options of other features are accepted.
+	type typo struct {
+		Hash uint32 `binary:"fixd32"`
+	}
+	if err := New().Register(&typo{}); err == nil || !strings.Contains(err.Error(), "fixd32") {
+		t.Errorf("expected an error for the unknown option, got %v", err)
+	}
+	type mixed struct {
+		A int32  `binary:"1,sint"`
+		B uint32 `binary:"2,fixed32"`
+		S string `binary:"len=4"`
+		P uint8  `binary:"pad=1"`
+		N int    `binary:"-"`
+	}
+	assertNoError(t, New().Register(&mixed{}))
+}
+
+func TestIntEncodingSchema(t *testing.T) {
+	s := DescribeType(&hintRecord{})
+	encodings := map[string]string{}
+	for _, f := range s.Root().Fields {
+		n := f.Type
+		for s.Nodes[n].Kind == KindPointer || s.Nodes[n].Kind == KindSlice || s.Nodes[n].Kind == KindMap {
+			n = s.Nodes[n].Elem
+		}
+		encodings[f.Name] = s.Nodes[n].Encoding
+	}
+	assertEqual(t, "fixed32", encodings["Hash"])
+	assertEqual(t, "fixed16,be", encodings["Port"])
+	assertEqual(t, "fixed64,be", encodings["ID"])
+	assertEqual(t, "uvarint", encodings["Delta"])
+	assertEqual(t, "fixed32", encodings["Seq"])
+	assertEqual(t, "fixed32,be", encodings["Opt"])
+	assertEqual(t, "fixed64", encodings["Counts"])
+	assertEqual(t, "", encodings["Plain"])
+	assertEqual(t, "", encodings["Number"])
+
+	in := hintRecord{Hash: 1, Port: 2, ID: -3, Delta: -4, Seq: []int16{5}, Counts: map[string]int64{"k": -6}, Plain: 7}
+	var data []byte
+	assertNoError(t, Encode(&in, &data))
+	assertNoError(t, s.Validate(data))
+
+	v, err := DecodeDynamic(data, s)
+	assertNoError(t, err)
+	fields := v.(map[string]Value)
+	assertEqual(t, int64(-3), fields["ID"])
+	assertEqual(t, uint64(2), fields["Port"])
+	assertEqual(t, int64(-4), fields["Delta"])
+
+	js, err := s.ToJSON(data)
+	assertNoError(t, err)
+	back, err := s.FromJSON(js)
+	assertNoError(t, err)
+	assertEqualBytes(t, data, back)
+
+	out := s.Dump(data)
+	for _, want := range []string{
+		"Hash (uint uint32 fixed32) 1 [01 00 00 00]",
+		"Port (uint uint16 fixed16,be) 2 [00 02]",
+		"Delta (int int32 uvarint) -4 [fc ff ff ff ff ff ff ff ff 01]",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("missing %q in:\n%s", want, out)
+		}
+	}
+
+	plain := DescribeType(&struct{ Hash uint32 }{})
+	hinted := DescribeType(&struct {
+		Hash uint32 `binary:"fixed32"`
+	}{})
+	if plain.Fingerprint(false) == hinted.Fingerprint(false) {
+		t.Error("fingerprint should include the integer encoding")
+	}
+	changes := CheckCompatibility(plain, hinted)
+	assertEqual(t, 1, len(changes))
+	assertEqual(t, ChangeIntEncoding, changes[0].Change)
+	assertEqual(t, true, changes[0].Breaking())
+}
+
+func TestIntEncodingFormats(t *testing.T) {
+	in := hintRecord{Hash: 9, ID: -1 << 40, Seq: []int16{-7}, Counts: map[string]int64{}}
+	for _, f := range []Format{FormatCBOR, FormatMsgPack} {
+		c := New(WithFormat(f))
+		var data []byte
+		assertNoError(t, c.Encode(&in, &data))
+		var out hintRecord
+		assertNoError(t, c.Decode(data, &out))
+		if !reflect.DeepEqual(in, out) {
+			t.Fatalf("%v: got %+v, want %+v", f, out, in)
+		}
+	}
+}
@@ -158,15 +158,15 @@ func TestIntegrationCoverage(t *testing.T) {
 
 		var buf bytes.Buffer
 		enc := &encoder{out: &buf, tb: inst}
-		// This should NOT hit the fast path because Type() != typ
-		if err := enc.encode(v); err != nil {
-			t.Fatalf("encode failed: %v", err)
+		// The name is already bound to another type: the collision is reported
+		if err := enc.encode(v); err == nil {
+			t.Fatal("expected HandlerName collision error on encode")
 		}
 
 		dec := &decoder{reader: newSliceReader(buf.Bytes()), tb: inst}
 		v2 := &namedMsg{}
-		if err := dec.decode(v2); err != nil {
-			t.Fatalf("decode failed: %v", err)
+		if err := dec.decode(v2); err == nil {
+			t.Fatal("expected HandlerName collision error on decode")
 		}
 	})
 
@@ -0,0 +1,922 @@
+package binary
+
+import (
+	"bytes"
+	"math"
+	"strconv"
+	"unicode/utf8"
+
+	. "github.com/tinywasm/fmt"
+)
+
+// ToJSON decodes data with the layout of typ and returns it as JSON. Field
+// names follow `json` tags; []byte and BinaryMarshaler payloads are base64
+// strings; non-finite floats are the strings "NaN", "+Inf" and "-Inf".
+func ToJSON(data []byte, typ any) ([]byte, error) {
+	return DescribeType(typ).ToJSON(data)
+}
+
+// FromJSON encodes JSON produced by ToJSON, or hand-edited from it, back into
+// the exact wire bytes of typ. Missing fields are encoded as zero values.
+func FromJSON(jsonData []byte, typ any) ([]byte, error) {
+	return DescribeType(typ).FromJSON(jsonData)
+}
+
+// ToJSON transcodes a payload described by the schema into JSON.
+func (s Schema) ToJSON(data []byte) ([]byte, error) {
+	v, err := DecodeDynamic(data, s)
+	if err != nil {
+		return nil, err
+	}
+	return s.appendJSON(nil, v, 0)
+}
+
+// FromJSON transcodes JSON into a payload described by the schema.
+func (s Schema) FromJSON(jsonData []byte) ([]byte, error) {
+	if len(s.Nodes) == 0 {
+		return nil, Err("FromJSON", "schema", D.Empty)
+	}
+
+	p := jsonParser{data: jsonData}
+	v, err := p.parse()
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	e := newEncoder(&buf)
+	if s.Versioned {
+		e.writeUvarint(uint64(s.Version))
+	}
+	if err = e.encodeJSON(&s, 0, v); err == nil {
+		err = e.err
+	}
+	return buf.Bytes(), err
+}
+
+// jsonName returns the name of a field in JSON, honouring the `json` tag.
+func (f Field) jsonName() string {
+	if name, ok := Convert(f.Tag).TagValue("json"); ok {
+		if i := Index(name, ","); i >= 0 {
+			name = name[:i]
+		}
+		if name != "" && name != "-" {
+			return name
+		}
+	}
+	return f.Name
+}
+
+// appendJSON appends the dynamic value v of node n as JSON.
+func (s Schema) appendJSON(b []byte, v Value, n int) ([]byte, error) {
+	node := &s.Nodes[n]
+	if v == nil {
+		return append(b, "null"...), nil
+	}
+
+	switch node.Kind {
+	case KindBool:
+		if v.(bool) {
+			return append(b, "true"...), nil
+		}
+		return append(b, "false"...), nil
+	case KindInt:
+		return appendJSONInt(b, v.(int64)), nil
+	case KindUint:
+		return appendJSONUint(b, v.(uint64)), nil
+	case KindFloat32:
+		return appendJSONFloat(b, float64(v.(float32)), 32), nil
+	case KindFloat64:
+		return appendJSONFloat(b, v.(float64), 64), nil
+	case KindString:
+		return appendJSONString(b, v.(string)), nil
+	case KindBytes, KindMarshaler:
+		b = append(b, '"')
+		b = appendBase64(b, v.([]byte))
+		return append(b, '"'), nil
+	case KindPointer:
+		return s.appendJSON(b, v, node.Elem)
+	case KindSlice, KindArray:
+		var err error
+		b = append(b, '[')
+		for i, e := range v.([]Value) {
+			if i > 0 {
+				b = append(b, ',')
+			}
+			if b, err = s.appendJSON(b, e, node.Elem); err != nil {
+				return nil, err
+			}
+		}
+		return append(b, ']'), nil
+	case KindMap:
+		return s.appendJSONMap(b, v.(map[Value]Value), node)
+	case KindStruct:
+		var err error
+		m := v.(map[string]Value)
+		b = append(b, '{')
+		for i, f := range node.Fields {
+			if i > 0 {
+				b = append(b, ',')
+			}
+			b = appendJSONString(b, f.jsonName())
+			b = append(b, ':')
+			if b, err = s.appendJSON(b, m[f.Name], f.Type); err != nil {
+				return nil, err
+			}
+		}
+		return append(b, '}'), nil
+	}
+
+	return nil, Err("ToJSON", node.Type, D.Type, D.Not, D.Supported)
+}
+
+// appendJSONMap appends a map as a JSON object with string keys. Entries are
+// ordered by the native encoding of their key, as WithCanonical orders them,
+// so the output is stable and FromJSON gives canonical bytes back.
+func (s Schema) appendJSONMap(b []byte, m map[Value]Value, node *Node) ([]byte, error) {
+	type entry struct {
+		wire []byte
+		key  Value
+	}
+	entries := make([]entry, 0, len(m))
+
+	if node.Key < 0 || node.Key >= len(s.Nodes) {
+		return nil, Err("ToJSON", "map key node", D.Out, D.Of, D.Range)
+	}
+	var buf bytes.Buffer
+	e := encoder{out: &buf}
+	for k := range m {
+		buf.Reset()
+		if err := e.encodeDynamicKey(&s.Nodes[node.Key], k); err != nil {
+			return nil, err
+		}
+		en := entry{append([]byte(nil), buf.Bytes()...), k}
+		// Insertion sort: maps in payloads are small and this keeps sort out
+		// of TinyGo builds.
+		i := len(entries)
+		entries = append(entries, en)
+		for ; i > 0 && bytes.Compare(entries[i-1].wire, en.wire) > 0; i-- {
+			entries[i] = entries[i-1]
+		}
+		entries[i] = en
+	}
+
+	var err error
+	b = append(b, '{')
+	for i, en := range entries {
+		if i > 0 {
+			b = append(b, ',')
+		}
+
+		var key []byte
+		if key, err = s.appendJSON(nil, en.key, node.Key); err != nil {
+			return nil, err
+		}
+		if key[0] == '"' {
+			b = append(b, key...)
+		} else {
+			b = appendJSONString(b, string(key))
+		}
+		b = append(b, ':')
+		if b, err = s.appendJSON(b, m[en.key], node.Elem); err != nil {
+			return nil, err
+		}
+	}
+	return append(b, '}'), nil
+}
+
+// encodeDynamicKey writes the dynamic map key v of node in the native
+// encoding, as DecodeDynamic read it.
+func (e *encoder) encodeDynamicKey(node *Node, v Value) error {
+	switch k := v.(type) {
+	case bool:
+		e.writeBool(k)
+	case int64, uint64:
+		enc, err := node.intEncoding()
+		if err != nil {
+			return err
+		}
+		if i, ok := k.(int64); ok {
+			return e.writeIntAs(enc, i)
+		}
+		return e.writeUintAs(enc, k.(uint64))
+	case float32:
+		e.writeFloat32(k)
+	case float64:
+		e.writeFloat64(k)
+	case string:
+		e.writeString(k)
+	default:
+		return Err("ToJSON", "map key", node.Kind.String(), D.Not, D.Supported)
+	}
+	return e.err
+}
+
+func appendJSONFloat(b []byte, f float64, bits int) []byte {
+	switch {
+	case math.IsNaN(f):
+		return append(b, `"NaN"`...)
+	case math.IsInf(f, 1):
+		return append(b, `"+Inf"`...)
+	case math.IsInf(f, -1):
+		return append(b, `"-Inf"`...)
+	}
+	// strconv keeps floats exact: the fmt conversions round them.
+	return strconv.AppendFloat(b, f, 'g', -1, bits)
+}
+
+// appendJSONInt appends the decimal form of v.
+func appendJSONInt(b []byte, v int64) []byte {
+	if v < 0 {
+		return appendJSONUint(append(b, '-'), -uint64(v))
+	}
+	return appendJSONUint(b, uint64(v))
+}
+
+// appendJSONUint appends the decimal form of u.
+func appendJSONUint(b []byte, u uint64) []byte {
+	var digits [20]byte
+	i := len(digits)
+	for {
+		i--
+		digits[i] = byte('0' + u%10)
+		if u /= 10; u == 0 {
+			return append(b, digits[i:]...)
+		}
+	}
+}
+
+const base64Alphabet = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789+/"
+
+// appendBase64 appends src in padded standard base64 (RFC 4648).
+func appendBase64(b, src []byte) []byte {
+	for len(src) > 0 {
+		n := min(len(src), 3)
+		var v uint32
+		for i := 0; i < 3; i++ {
+			v <<= 8
+			if i < n {
+				v |= uint32(src[i])
+			}
+		}
+		quad := [4]byte{base64Alphabet[v>>18&63], base64Alphabet[v>>12&63], base64Alphabet[v>>6&63], base64Alphabet[v&63]}
+		for i := n + 1; i < 4; i++ {
+			quad[i] = '='
+		}
+		b = append(b, quad[:]...)
+		src = src[n:]
+	}
+	return b
+}
+
+// decodeBase64 decodes padded standard base64 and reports whether s was
+// well formed.
+func decodeBase64(s string) ([]byte, bool) {
+	if len(s)%4 != 0 {
+		return nil, false
+	}
+	out := make([]byte, 0, len(s)/4*3)
+	for i := 0; i < len(s); i += 4 {
+		var v uint32
+		pad := 0
+		for j := 0; j < 4; j++ {
+			c := s[i+j]
+			d := base64Value(c)
+			switch {
+			case c == '=' && j >= 2 && i+4 == len(s):
+				pad++
+				d = 0
+			case d < 0 || pad > 0:
+				return nil, false
+			}
+			v = v<<6 | uint32(d)
+		}
+		out = append(out, byte(v>>16), byte(v>>8), byte(v))
+		out = out[:len(out)-pad]
+	}
+	return out, true
+}
+
+func base64Value(c byte) int {
+	switch {
+	case c >= 'A' && c <= 'Z':
+		return int(c - 'A')
+	case c >= 'a' && c <= 'z':
+		return int(c-'a') + 26
+	case c >= '0' && c <= '9':
+		return int(c-'0') + 52
+	case c == '+':
+		return 62
+	case c == '/':
+		return 63
+	}
+	return -1
+}
+
+func appendJSONString(b []byte, s string) []byte {
+	const hex = "0123456789abcdef"
+	b = append(b, '"')
+	for i := 0; i < len(s); {
+		c := s[i]
+		if c < utf8.RuneSelf {
+			switch {
+			case c == '"' || c == '\\':
+				b = append(b, '\\', c)
+			case c == '\n':
+				b = append(b, '\\', 'n')
+			case c == '\r':
+				b = append(b, '\\', 'r')
+			case c == '\t':
+				b = append(b, '\\', 't')
+			case c < 0x20:
+				b = append(b, '\\', 'u', '0', '0', hex[c>>4], hex[c&0xf])
+			default:
+				b = append(b, c)
+			}
+			i++
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if r == utf8.RuneError && size == 1 {
+			b = append(b, "\ufffd"...)
+		} else {
+			b = append(b, s[i:i+size]...)
+		}
+		i += size
+	}
+	return append(b, '"')
+}
+
+// ------------------------------------------------------------------------------
+
+// encodeJSON encodes the parsed JSON value v as node n of the schema.
+func (e *encoder) encodeJSON(s *Schema, n int, v *jsonValue) error {
+	if n < 0 || n >= len(s.Nodes) {
+		return Err("FromJSON", "node", D.Out, D.Of, D.Range)
+	}
+	node := &s.Nodes[n]
+
+	if v == nil || v.kind == jsonNull {
+		return e.encodeJSONZero(s, n, v != nil, 0)
+	}
+
+	switch node.Kind {
+	case KindBool:
+		if v.kind != jsonBool {
+			return jsonTypeError(node, v)
+		}
+		e.writeBool(v.boolean)
+	case KindInt:
+		if v.kind != jsonNumber && v.kind != jsonString {
+			return jsonTypeError(node, v)
+		}
+		i, err := parseJSONInt(node, v)
+		if err != nil {
+			return err
+		}
+		enc, err := node.intEncoding()
+		if err != nil {
+			return err
+		}
+		return e.writeIntAs(enc, int64(i))
+	case KindUint:
+		if v.kind != jsonNumber && v.kind != jsonString {
+			return jsonTypeError(node, v)
+		}
+		u, err := parseJSONInt(node, v)
+		if err != nil {
+			return err
+		}
+		enc, err := node.intEncoding()
+		if err != nil {
+			return err
+		}
+		return e.writeUintAs(enc, u)
+	case KindFloat32, KindFloat64:
+		f, err := parseJSONFloat(v, node.Bits)
+		if err != nil {
+			return jsonTypeError(node, v)
+		}
+		if node.Kind == KindFloat32 {
+			e.writeFloat32(float32(f))
+		} else {
+			e.writeFloat64(f)
+		}
+	case KindString:
+		if v.kind != jsonString {
+			return jsonTypeError(node, v)
+		}
+		e.writeString(v.text)
+	case KindBytes, KindMarshaler:
+		if v.kind != jsonString {
+			return jsonTypeError(node, v)
+		}
+		raw, ok := decodeBase64(v.text)
+		if !ok {
+			return Err("FromJSON", node.Type, "base64", D.Invalid)
+		}
+		e.writeUvarint(uint64(len(raw)))
+		e.write(raw)
+	case KindPointer:
+		e.writeBool(false)
+		return e.encodeJSON(s, node.Elem, v)
+	case KindSlice, KindArray:
+		if v.kind != jsonArray {
+			return jsonTypeError(node, v)
+		}
+		if node.Kind == KindSlice {
+			e.writeUvarint(uint64(len(v.items)))
+		} else if len(v.items) != node.Len {
+			return Err("FromJSON", node.Type, "expects", Convert(node.Len).String(), "elements")
+		}
+		for i := range v.items {
+			if err := e.encodeJSON(s, node.Elem, &v.items[i]); err != nil {
+				return err
+			}
+		}
+	case KindMap:
+		if v.kind != jsonObject {
+			return jsonTypeError(node, v)
+		}
+		keyKind := s.kindOf(node.Key)
+		if keyKind < KindBool || keyKind > KindString {
+			return Err("FromJSON", "map key", keyKind.String(), D.Not, D.Supported)
+		}
+		e.writeUvarint(uint64(len(v.members)))
+		for i := range v.members {
+			key := jsonValue{kind: jsonString, text: v.members[i].name}
+			switch keyKind {
+			case KindBool:
+				if key.text != "true" && key.text != "false" {
+					return Err("FromJSON", "map key", key.text, D.Invalid, "for bool")
+				}
+				key = jsonValue{kind: jsonBool, boolean: key.text == "true"}
+			case KindFloat32, KindFloat64:
+				key.kind = jsonNumber
+			}
+			if err := e.encodeJSON(s, node.Key, &key); err != nil {
+				return err
+			}
+			if err := e.encodeJSON(s, node.Elem, &v.members[i].value); err != nil {
+				return err
+			}
+		}
+	case KindStruct:
+		if v.kind != jsonObject {
+			return jsonTypeError(node, v)
+		}
+		for _, m := range v.members {
+			if fieldByJSONName(node.Fields, m.name) < 0 {
+				return Err("FromJSON", node.Type, "unknown field", m.name)
+			}
+		}
+		for _, f := range node.Fields {
+			if err := e.encodeJSON(s, f.Type, v.member(f.jsonName())); err != nil {
+				return err
+			}
+		}
+	default:
+		return Err("FromJSON", node.Type, D.Type, D.Not, D.Supported)
+	}
+	return e.err
+}
+
+// encodeJSONZero encodes the zero value of node n, used for missing fields
+// and JSON nulls. null is only accepted by pointers, slices, maps and bytes.
+// depth guards against cyclic descriptors.
+func (e *encoder) encodeJSONZero(s *Schema, n int, null bool, depth int) error {
+	if n < 0 || n >= len(s.Nodes) || depth > len(s.Nodes) {
+		return Err("FromJSON", "node", D.Out, D.Of, D.Range)
+	}
+	node := &s.Nodes[n]
+	switch node.Kind {
+	case KindPointer:
+		e.writeBool(true)
+	case KindSlice, KindMap, KindBytes, KindMarshaler:
+		e.writeUvarint(0)
+	case KindBool, KindInt, KindUint, KindFloat32, KindFloat64, KindString, KindArray, KindStruct:
+		if null {
+			return Err("FromJSON", node.Type, "cannot be null")
+		}
+		switch node.Kind {
+		case KindBool:
+			e.writeBool(false)
+		case KindInt, KindUint:
+			enc, err := node.intEncoding()
+			if err != nil {
+				return err
+			}
+			return e.writeUintAs(enc, 0)
+		case KindFloat32:
+			e.writeFloat32(0)
+		case KindFloat64:
+			e.writeFloat64(0)
+		case KindString:
+			e.writeString("")
+		case KindArray:
+			for i := 0; i < node.Len; i++ {
+				if err := e.encodeJSONZero(s, node.Elem, false, depth+1); err != nil {
+					return err
+				}
+			}
+		case KindStruct:
+			for _, f := range node.Fields {
+				if err := e.encodeJSONZero(s, f.Type, false, depth+1); err != nil {
+					return err
+				}
+			}
+		}
+	default:
+		return Err("FromJSON", node.Type, D.Type, D.Not, D.Supported)
+	}
+	return e.err
+}
+
+func fieldByJSONName(fields []Field, name string) int {
+	for i, f := range fields {
+		if f.jsonName() == name {
+			return i
+		}
+	}
+	return -1
+}
+
+func parseJSONFloat(v *jsonValue, bits int) (float64, error) {
+	if v.kind == jsonString {
+		switch v.text {
+		case "NaN":
+			return math.NaN(), nil
+		case "+Inf", "Inf":
+			return math.Inf(1), nil
+		case "-Inf":
+			return math.Inf(-1), nil
+		}
+	}
+	if v.kind != jsonNumber {
+		return 0, errJSONSyntax
+	}
+	if bits != 32 {
+		bits = 64
+	}
+	return strconv.ParseFloat(v.text, bits) // exact, see appendJSONFloat
+}
+
+func jsonTypeError(node *Node, v *jsonValue) error {
+	return Err("FromJSON", "cannot use JSON", jsonKindNames[v.kind], "as", node.Kind.String(), "("+node.Type+")")
+}
+
+// parseJSONInt parses the decimal text of v as the int or uint node, within
+// the range of its Bits, and returns the two's complement bits of the value.
+func parseJSONInt(node *Node, v *jsonValue) (uint64, error) {
+	text := v.text
+	neg := HasPrefix(text, "-")
+	if neg && node.Kind == KindUint {
+		return 0, jsonTypeError(node, v)
+	}
+	if neg || HasPrefix(text, "+") {
+		text = text[1:]
+	}
+	if text == "" {
+		return 0, jsonTypeError(node, v)
+	}
+	rangeErr := Err("FromJSON", "value", v.text, D.Out, D.Of, D.Range, "for", node.Type)
+
+	var u uint64
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		if c < '0' || c > '9' {
+			return 0, jsonTypeError(node, v)
+		}
+		if u > (math.MaxUint64-uint64(c-'0'))/10 {
+			return 0, rangeErr
+		}
+		u = u*10 + uint64(c-'0')
+	}
+
+	bits := node.Bits
+	if bits <= 0 || bits > 64 {
+		bits = 64
+	}
+	if node.Kind == KindUint {
+		if bits < 64 && u >= 1<<bits {
+			return 0, rangeErr
+		}
+		return u, nil
+	}
+	if limit := uint64(1) << (bits - 1); u > limit || (!neg && u == limit) {
+		return 0, rangeErr
+	}
+	if neg {
+		return -u, nil
+	}
+	return u, nil
+}
+
+// ------------------------------------------------------------------------------
+
+var errJSONSyntax = Err("JSON", "syntax", D.Invalid)
+
+type jsonKind uint8
+
+const (
+	jsonNull jsonKind = iota
+	jsonBool
+	jsonNumber
+	jsonString
+	jsonArray
+	jsonObject
+)
+
+var jsonKindNames = [...]string{"null", "bool", "number", "string", "array", "object"}
+
+// jsonValue is a parsed JSON value. Objects keep their members in order.
+type jsonValue struct {
+	kind    jsonKind
+	boolean bool
+	text    string // raw number or unescaped string
+	items   []jsonValue
+	members []jsonMember
+}
+
+type jsonMember struct {
+	name  string
+	value jsonValue
+}
+
+// member returns the last member with the given name, or nil.
+func (v *jsonValue) member(name string) *jsonValue {
+	for i := len(v.members) - 1; i >= 0; i-- {
+		if v.members[i].name == name {
+			return &v.members[i].value
+		}
+	}
+	return nil
+}
+
+// jsonParser is a small RFC 8259 parser, used instead of encoding/json to
+// keep TinyGo builds small.
+type jsonParser struct {
+	data  []byte
+	pos   int
+	depth int
+}
+
+func (p *jsonParser) parse() (*jsonValue, error) {
+	v, err := p.value()
+	if err != nil {
+		return nil, err
+	}
+	p.skipSpace()
+	if p.pos != len(p.data) {
+		return nil, p.errorf("unexpected trailing data")
+	}
+	return &v, nil
+}
+
+func (p *jsonParser) errorf(msg string) error {
+	return Err("JSON", msg, "at offset", Convert(p.pos).String())
+}
+
+func (p *jsonParser) skipSpace() {
+	for p.pos < len(p.data) {
+		switch p.data[p.pos] {
+		case ' ', '\t', '\n', '\r':
+			p.pos++
+		default:
+			return
+		}
+	}
+}
+
+func (p *jsonParser) value() (jsonValue, error) {
+	p.skipSpace()
+	if p.pos >= len(p.data) {
+		return jsonValue{}, p.errorf("unexpected end of input")
+	}
+
+	switch c := p.data[p.pos]; {
+	case c == '{':
+		return p.object()
+	case c == '[':
+		return p.array()
+	case c == '"':
+		s, err := p.str()
+		return jsonValue{kind: jsonString, text: s}, err
+	case c == 't':
+		return jsonValue{kind: jsonBool, boolean: true}, p.literal("true")
+	case c == 'f':
+		return jsonValue{kind: jsonBool}, p.literal("false")
+	case c == 'n':
+		return jsonValue{kind: jsonNull}, p.literal("null")
+	case c == '-' || (c >= '0' && c <= '9'):
+		return p.number()
+	}
+	return jsonValue{}, p.errorf("unexpected character")
+}
+
+func (p *jsonParser) literal(word string) error {
+	if !bytes.HasPrefix(p.data[p.pos:], []byte(word)) {
+		return p.errorf("invalid literal")
+	}
+	p.pos += len(word)
+	return nil
+}
+
+func (p *jsonParser) number() (jsonValue, error) {
+	start := p.pos
+	if p.data[p.pos] == '-' {
+		p.pos++
+	}
+	digits := func() int {
+		n := 0
+		for p.pos < len(p.data) && p.data[p.pos] >= '0' && p.data[p.pos] <= '9' {
+			p.pos++
+			n++
+		}
+		return n
+	}
+	if digits() == 0 {
+		return jsonValue{}, p.errorf("invalid number")
+	}
+	if p.pos < len(p.data) && p.data[p.pos] == '.' {
+		p.pos++
+		if digits() == 0 {
+			return jsonValue{}, p.errorf("invalid number")
+		}
+	}
+	if p.pos < len(p.data) && (p.data[p.pos] == 'e' || p.data[p.pos] == 'E') {
+		p.pos++
+		if p.pos < len(p.data) && (p.data[p.pos] == '+' || p.data[p.pos] == '-') {
+			p.pos++
+		}
+		if digits() == 0 {
+			return jsonValue{}, p.errorf("invalid number")
+		}
+	}
+	return jsonValue{kind: jsonNumber, text: string(p.data[start:p.pos])}, nil
+}
+
+func (p *jsonParser) str() (string, error) {
+	p.pos++ // opening quote
+	var out []byte
+	for p.pos < len(p.data) {
+		c := p.data[p.pos]
+		switch {
+		case c == '"':
+			p.pos++
+			return string(out), nil
+		case c == '\\':
+			if p.pos+1 >= len(p.data) {
+				return "", p.errorf("unterminated string")
+			}
+			p.pos++
+			switch esc := p.data[p.pos]; esc {
+			case '"', '\\', '/':
+				out = append(out, esc)
+			case 'b':
+				out = append(out, '\b')
+			case 'f':
+				out = append(out, '\f')
+			case 'n':
+				out = append(out, '\n')
+			case 'r':
+				out = append(out, '\r')
+			case 't':
+				out = append(out, '\t')
+			case 'u':
+				r, ok := p.hex4(p.pos + 1)
+				if !ok {
+					return "", p.errorf("invalid unicode escape")
+				}
+				p.pos += 4
+				if r >= 0xd800 && r < 0xdc00 {
+					// Surrogate pair
+					if lo, ok := p.hex4(p.pos + 3); ok && p.data[p.pos+1] == '\\' && p.data[p.pos+2] == 'u' && lo >= 0xdc00 && lo < 0xe000 {
+						r = (r-0xd800)<<10 | (lo - 0xdc00) + 0x10000
+						p.pos += 6
+					} else {
+						r = utf8.RuneError
+					}
+				}
+				out = utf8.AppendRune(out, r)
+			default:
+				return "", p.errorf("invalid escape")
+			}
+			p.pos++
+		case c < 0x20:
+			return "", p.errorf("control character in string")
+		default:
+			out = append(out, c)
+			p.pos++
+		}
+	}
+	return "", p.errorf("unterminated string")
+}
+
+// hex4 parses four hexadecimal digits starting at i.
+func (p *jsonParser) hex4(i int) (rune, bool) {
+	if i+4 > len(p.data) {
+		return 0, false
+	}
+	var r rune
+	for _, c := range p.data[i : i+4] {
+		r <<= 4
+		switch {
+		case c >= '0' && c <= '9':
+			r |= rune(c - '0')
+		case c >= 'a' && c <= 'f':
+			r |= rune(c - 'a' + 10)
+		case c >= 'A' && c <= 'F':
+			r |= rune(c - 'A' + 10)
+		default:
+			return 0, false
+		}
+	}
+	return r, true
+}
+
+func (p *jsonParser) array() (jsonValue, error) {
+	if p.depth++; p.depth > maxJSONDepth {
+		return jsonValue{}, p.errorf("nesting too deep")
+	}
+	defer func() { p.depth-- }()
+
+	v := jsonValue{kind: jsonArray}
+	p.pos++ // '['
+	p.skipSpace()
+	if p.pos < len(p.data) && p.data[p.pos] == ']' {
+		p.pos++
+		return v, nil
+	}
+	for {
+		item, err := p.value()
+		if err != nil {
+			return v, err
+		}
+		v.items = append(v.items, item)
+		p.skipSpace()
+		if p.pos >= len(p.data) {
+			return v, p.errorf("unterminated array")
+		}
+		switch p.data[p.pos] {
+		case ',':
+			p.pos++
+		case ']':
+			p.pos++
+			return v, nil
+		default:
+			return v, p.errorf("expected , or ]")
+		}
+	}
+}
+
+func (p *jsonParser) object() (jsonValue, error) {
+	if p.depth++; p.depth > maxJSONDepth {
+		return jsonValue{}, p.errorf("nesting too deep")
+	}
+	defer func() { p.depth-- }()
+
+	v := jsonValue{kind: jsonObject}
+	p.pos++ // '{'
+	p.skipSpace()
+	if p.pos < len(p.data) && p.data[p.pos] == '}' {
+		p.pos++
+		return v, nil
+	}
+	for {
+		p.skipSpace()
+		if p.pos >= len(p.data) || p.data[p.pos] != '"' {
+			return v, p.errorf("expected string key")
+		}
+		name, err := p.str()
+		if err != nil {
+			return v, err
+		}
+		p.skipSpace()
+		if p.pos >= len(p.data) || p.data[p.pos] != ':' {
+			return v, p.errorf("expected :")
+		}
+		p.pos++
+		item, err := p.value()
+		if err != nil {
+			return v, err
+		}
+		v.members = append(v.members, jsonMember{name: name, value: item})
+		p.skipSpace()
+		if p.pos >= len(p.data) {
+			return v, p.errorf("unterminated object")
+		}
+		switch p.data[p.pos] {
+		case ',':
+			p.pos++
+		case '}':
+			p.pos++
+			return v, nil
+		default:
+			return v, p.errorf("expected , or }")
+		}
+	}
+}
+
+// maxJSONDepth bounds nesting so hostile input cannot exhaust the stack.
+const maxJSONDepth = 1000
@@ -0,0 +1,296 @@
+package binary
+
+import (
+	"bytes"
+	"encoding/base64"
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+type jsonAddress struct {
+	City string `json:"city"`
+	Zip  uint16 `json:"zip,omitempty"`
+}
+
+type jsonUser struct {
+	Name    string            `json:"name"`
+	Age     int8              `json:"age"`
+	Balance float64           `json:"balance"`
+	Ratio   float32           `json:"ratio"`
+	Admin   bool              `json:"admin"`
+	Avatar  []byte            `json:"avatar"`
+	Home    *jsonAddress      `json:"home"`
+	Work    *jsonAddress      `json:"work"`
+	Scores  []int32           `json:"scores"`
+	Pair    [2]string         `json:"pair"`
+	Labels  map[string]string `json:"labels"`
+	ByID    map[int]bool      `json:"by_id"`
+	Created time.Time         `json:"created"`
+	Note    string
+	Skipped string `json:"-"`
+}
+
+func TestToJSON(t *testing.T) {
+	in := &jsonUser{
+		Name:    "Al \"Bo\"\n",
+		Age:     -5,
+		Balance: 12.5,
+		Ratio:   0.1,
+		Admin:   true,
+		Avatar:  []byte{0xde, 0xad},
+		Home:    &jsonAddress{City: "Paris", Zip: 7500},
+		Scores:  []int32{1, -2},
+		Pair:    [2]string{"a", "b"},
+		Labels:  map[string]string{"k": "v"},
+		ByID:    map[int]bool{7: true},
+		Created: time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC),
+		Note:    "ñ",
+	}
+
+	var b []byte
+	if err := Encode(in, &b); err != nil {
+		t.Fatal(err)
+	}
+
+	js, err := ToJSON(b, in)
+	if err != nil {
+		t.Fatalf("ToJSON: %v", err)
+	}
+
+	created, _ := in.Created.MarshalBinary()
+	var want []byte
+	want = append(want, `{"name":"Al \"Bo\"\n","age":-5,"balance":12.5,"ratio":0.1,"admin":true,"avatar":"3q0=",`...)
+	want = append(want, `"home":{"city":"Paris","zip":7500},"work":null,"scores":[1,-2],"pair":["a","b"],`...)
+	want = append(want, `"labels":{"k":"v"},"by_id":{"7":true},"created":"`...)
+	want = base64.StdEncoding.AppendEncode(want, created)
+	want = append(want, `","Note":"ñ"}`...)
+	if string(js) != string(want) {
+		t.Fatalf("unexpected JSON:\nwant %s\ngot  %s", want, js)
+	}
+
+	back, err := FromJSON(js, in)
+	if err != nil {
+		t.Fatalf("FromJSON: %v", err)
+	}
+	if !bytes.Equal(back, b) {
+		t.Errorf("round trip bytes differ:\nwant %v\ngot  %v", b, back)
+	}
+
+	var out jsonUser
+	if err := Decode(back, &out); err != nil {
+		t.Fatal(err)
+	}
+	if out.Name != in.Name || out.Home.Zip != 7500 || !out.Created.Equal(in.Created) || !out.ByID[7] {
+		t.Errorf("unexpected decoded value %+v", out)
+	}
+}
+
+func TestJSONNumbersAndBase64(t *testing.T) {
+	type extremes struct {
+		Min   int64
+		Max   int64
+		UMax  uint64
+		Small int8
+		Raw   []byte
+	}
+	for n := 0; n < 8; n++ {
+		raw := []byte("\x00\xffabcdefg")[:n]
+		in := extremes{Min: math.MinInt64, Max: math.MaxInt64, UMax: math.MaxUint64, Small: -128, Raw: raw}
+		var b []byte
+		if err := Encode(&in, &b); err != nil {
+			t.Fatal(err)
+		}
+		js, err := ToJSON(b, &in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := `{"Min":-9223372036854775808,"Max":9223372036854775807,"UMax":18446744073709551615,"Small":-128,"Raw":"` +
+			base64.StdEncoding.EncodeToString(raw) + `"}`
+		if string(js) != want {
+			t.Fatalf("unexpected JSON:\nwant %s\ngot  %s", want, js)
+		}
+		back, err := FromJSON(js, &in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(back, b) {
+			t.Errorf("round trip bytes differ for %d bytes", n)
+		}
+	}
+
+	for _, bad := range []string{`{"Max":9223372036854775808}`, `{"UMax":18446744073709551616}`, `{"Small":-129}`} {
+		if _, err := FromJSON([]byte(bad), &extremes{}); err == nil || !strings.Contains(err.Error(), "Range") {
+			t.Errorf("%s: expected a range error, got %v", bad, err)
+		}
+	}
+	for _, bad := range []string{`{"Raw":"QQ="}`, `{"Raw":"Q=Q="}`, `{"Raw":"QQ=A"}`, `{"Raw":"Q!=="}`} {
+		if _, err := FromJSON([]byte(bad), &extremes{}); err == nil || !strings.Contains(err.Error(), "base64") {
+			t.Errorf("%s: expected a base64 error, got %v", bad, err)
+		}
+	}
+}
+
+func TestJSONMapKeys(t *testing.T) {
+	if _, err := FromJSON([]byte(`{"yes":1}`), map[bool]int{}); err == nil {
+		t.Error("expected an error for a bool key that is not true or false")
+	}
+	b, err := FromJSON([]byte(`{"false":1,"true":2}`), map[bool]int{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var m map[bool]int
+	if err := Decode(b, &m); err != nil || m[false] != 1 || m[true] != 2 {
+		t.Errorf("unexpected map %v %v", m, err)
+	}
+
+	bad := Schema{Nodes: []Node{{Kind: KindMap, Key: 5, Elem: 1}, {Kind: KindBool}}}
+	if _, err := bad.FromJSON([]byte(`{"a":true}`)); err == nil {
+		t.Error("expected an error for an out of range key node")
+	}
+	if _, err := bad.ToJSON([]byte{1, 0, 0}); err == nil {
+		t.Error("expected an error for an out of range key node")
+	}
+	cyclic := Schema{Nodes: []Node{{Kind: KindStruct, Fields: []Field{{Name: "Self", Type: 0}}}}}
+	if _, err := cyclic.FromJSON([]byte(`{}`)); err == nil {
+		t.Error("expected an error for a cyclic schema")
+	}
+}
+
+func TestToJSONMapOrder(t *testing.T) {
+	in := map[int]string{2: "c", -1: "a", 0: "z", 1: "b", -3: "d"}
+	var canonical []byte
+	if err := New(WithCanonical()).Encode(in, &canonical); err != nil {
+		t.Fatal(err)
+	}
+	var plain []byte
+	if err := Encode(in, &plain); err != nil {
+		t.Fatal(err)
+	}
+
+	// Keys follow their zigzag varint encoding, whatever the payload order.
+	const want = `{"0":"z","-1":"a","1":"b","2":"c","-3":"d"}`
+	for i := 0; i < 5; i++ {
+		js, err := ToJSON(plain, in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(js) != want {
+			t.Fatalf("unexpected JSON:\nwant %s\ngot  %s", want, js)
+		}
+	}
+
+	back, err := FromJSON([]byte(want), in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(back, canonical) {
+		t.Errorf("FromJSON should give the canonical bytes:\nwant %v\ngot  %v", canonical, back)
+	}
+}
+
+func TestFromJSONHandEdited(t *testing.T) {
+	// Fields out of order, whitespace, escapes and missing fields.
+	js := []byte(` {
+		"work": {"zip": 1, "city": "Rome"},
+		"name": "café 🚀",
+		"scores": [3],
+		"pair": ["x", "y"],
+		"ratio": 1e-3,
+		"balance": "+Inf"
+	}`)
+
+	b, err := FromJSON(js, &jsonUser{})
+	if err != nil {
+		t.Fatalf("FromJSON: %v", err)
+	}
+
+	// time.Time cannot unmarshal an empty payload, so compare dynamically.
+	v, err := DecodeDynamic(b, DescribeType(&jsonUser{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := v.(map[string]Value)
+	if m["name"] != nil || m["Name"] != "café 🚀" {
+		t.Errorf("unexpected name %v", m["Name"])
+	}
+	if m["Home"] != nil || m["Work"].(map[string]Value)["City"] != "Rome" {
+		t.Errorf("unexpected addresses %v %v", m["Home"], m["Work"])
+	}
+	if !math.IsInf(m["Balance"].(float64), 1) || m["Ratio"] != float32(0.001) || m["Age"] != int64(0) {
+		t.Errorf("unexpected numbers %v %v %v", m["Balance"], m["Ratio"], m["Age"])
+	}
+}
+
+func TestJSONNonFinite(t *testing.T) {
+	type floats struct{ A, B, C float64 }
+	var b []byte
+	if err := Encode(&floats{math.NaN(), math.Inf(1), math.Inf(-1)}, &b); err != nil {
+		t.Fatal(err)
+	}
+	js, err := ToJSON(b, floats{})
+	if err != nil || string(js) != `{"A":"NaN","B":"+Inf","C":"-Inf"}` {
+		t.Fatalf("unexpected JSON %s %v", js, err)
+	}
+	back, err := FromJSON(js, floats{})
+	if err != nil || !bytes.Equal(back, b) {
+		t.Errorf("non-finite round trip failed: %v", err)
+	}
+}
+
+func TestJSONVersioned(t *testing.T) {
+	var b []byte
+	if err := Encode(&verUser{First: "a"}, &b); err != nil {
+		t.Fatal(err)
+	}
+	js, err := ToJSON(b, &verUser{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	back, err := FromJSON(js, &verUser{})
+	if err != nil || !bytes.Equal(back, b) {
+		t.Errorf("versioned round trip failed: %v %v %v", err, back, b)
+	}
+}
+
+func TestFromJSONErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		json string
+		typ  any
+		msg  string
+	}{
+		{"UnknownField", `{"nope":1}`, &jsonAddress{}, "unknown field nope"},
+		{"WrongType", `{"city":1}`, &jsonAddress{}, "cannot use JSON number as string"},
+		{"NullValue", `{"city":null}`, &jsonAddress{}, "cannot be null"},
+		{"Overflow", `{"zip":-1}`, &jsonAddress{}, "number as uint"},
+		{"IntRange", `{"age":300}`, &jsonUser{}, "value 300 Out of Range for int8"},
+		{"UintRange", `{"zip":70000}`, &jsonAddress{}, "value 70000 Out of Range for uint16"},
+		{"ArrayLength", `{"pair":["a"]}`, &jsonUser{}, "expects 2 elements"},
+		{"Base64", `{"avatar":"!!"}`, &jsonUser{}, "base64"},
+		{"Trailing", `{} x`, &jsonAddress{}, "trailing"},
+		{"Unterminated", `{"city":"a`, &jsonAddress{}, "unterminated string"},
+		{"BadEscape", `{"city":"\q"}`, &jsonAddress{}, "invalid escape"},
+		{"BadNumber", `{"zip":1.}`, &jsonAddress{}, "invalid number"},
+		{"BadLiteral", `{"admin":tru}`, &jsonUser{}, "invalid literal"},
+		{"MissingColon", `{"city" "a"}`, &jsonAddress{}, "expected :"},
+		{"Empty", ``, &jsonAddress{}, "unexpected end"},
+		{"Deep", strings.Repeat("[", 2000), []int{}, "too deep"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := FromJSON([]byte(tt.json), tt.typ)
+			if err == nil || !strings.Contains(err.Error(), tt.msg) {
+				t.Errorf("expected error containing %q, got %v", tt.msg, err)
+			}
+		})
+	}
+
+	if _, err := (Schema{}).FromJSON([]byte(`{}`)); err == nil {
+		t.Error("expected error for empty schema")
+	}
+	if _, err := ToJSON([]byte{1}, &jsonUser{}); err == nil {
+		t.Error("expected error for truncated payload")
+	}
+}
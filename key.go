@@ -0,0 +1,249 @@
+package binary
+
+import (
+	"math"
+	"reflect"
+
+	. "github.com/tinywasm/fmt"
+)
+
+// Key encoding is a separate, order-preserving format: bytes.Compare of two
+// encoded keys matches the natural order of the values.
+//
+//   - bool: one byte, 0 or 1
+//   - uints: big-endian, at the width of the Go type; 8 bytes for uint and
+//     uintptr on every platform
+//   - ints: big-endian with the sign bit flipped, at the width of the Go
+//     type; 8 bytes for int on every platform
+//   - floats: big-endian IEEE 754 bits, with the sign bit flipped for
+//     positive numbers and every bit flipped for negative ones
+//   - strings and []byte: the bytes with 0x00 escaped as 0x00 0xff, then the
+//     terminator 0x00 0x01, so a prefix sorts before its extensions
+//   - structs and arrays: their fields or elements in order, as a tuple
+//
+// Floats sort as -Inf < negative < -0 < +0 < positive < +Inf < NaN; a NaN
+// with the sign bit set sorts before -Inf.
+const (
+	keyEscape     = 0x00
+	keyEscaped00  = 0xff
+	keyTerminator = 0x01
+)
+
+// EncodeKey returns the order-preserving key encoding of v, for use as a key
+// in ordered stores. v may be a bool, int, uint, float, string, []byte, or a
+// struct or array of those. int, uint and uintptr are always written as 8
+// bytes, so keys sort and decode the same on 32 and 64-bit platforms.
+func EncodeKey(v any) ([]byte, error) {
+	if v == nil {
+		return nil, Err("EncodeKey", "nil value")
+	}
+	return appendKey(nil, reflect.Indirect(reflect.ValueOf(v)))
+}
+
+// DecodeKey decodes a key produced by EncodeKey into the value pointed to by v.
+func DecodeKey(data []byte, v any) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return Err("DecodeKey", D.Required, D.Type, D.Pointer)
+	}
+	rest, err := decodeKey(data, rv.Elem())
+	if err == nil && len(rest) > 0 {
+		err = Err("DecodeKey", Convert(len(rest)).String(), "trailing bytes")
+	}
+	return err
+}
+
+func appendKey(b []byte, rv reflect.Value) ([]byte, error) {
+	switch rv.Kind() {
+	case reflect.Bool:
+		if rv.Bool() {
+			return append(b, 1), nil
+		}
+		return append(b, 0), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return appendBigEndian(b, rv.Uint(), keyBits(rv.Type())/8), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		bits := keyBits(rv.Type())
+		return appendBigEndian(b, uint64(rv.Int())^(1<<(bits-1)), bits/8), nil
+	case reflect.Float32:
+		u := uint64(math.Float32bits(float32(rv.Float())))
+		return appendBigEndian(b, orderFloat(u, 32), 4), nil
+	case reflect.Float64:
+		return appendBigEndian(b, orderFloat(math.Float64bits(rv.Float()), 64), 8), nil
+	case reflect.String:
+		return appendKeyBytes(b, rv.String()), nil
+	case reflect.Slice:
+		if rv.Type().Elem().Kind() == reflect.Uint8 {
+			return appendKeyBytes(b, string(rv.Bytes())), nil
+		}
+	case reflect.Array:
+		var err error
+		for i := 0; i < rv.Len() && err == nil; i++ {
+			b, err = appendKey(b, rv.Index(i))
+		}
+		return b, err
+	case reflect.Struct:
+		var err error
+		for _, i := range scanStruct(rv.Type()).fields {
+			if b, err = appendKey(b, rv.Field(i)); err != nil {
+				return nil, err
+			}
+		}
+		return b, nil
+	}
+	return nil, Err("EncodeKey", rv.Type().String(), D.Type, D.Not, D.Supported)
+}
+
+func decodeKey(data []byte, rv reflect.Value) ([]byte, error) {
+	switch rv.Kind() {
+	case reflect.Bool:
+		if len(data) < 1 || data[0] > 1 {
+			return nil, errKey
+		}
+		rv.SetBool(data[0] == 1)
+		return data[1:], nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		n := keyBits(rv.Type()) / 8
+		if len(data) < n {
+			return nil, errKey
+		}
+		u := readBigEndian(data[:n])
+		if rv.OverflowUint(u) {
+			return nil, Err("DecodeKey", rv.Type().String(), D.Out, D.Of, D.Range)
+		}
+		rv.SetUint(u)
+		return data[n:], nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		bits := keyBits(rv.Type())
+		if len(data) < bits/8 {
+			return nil, errKey
+		}
+		u := readBigEndian(data[:bits/8]) ^ (1 << (bits - 1))
+		i := int64(u<<(64-bits)) >> (64 - bits) // sign-extend
+		if rv.OverflowInt(i) {
+			return nil, Err("DecodeKey", rv.Type().String(), D.Out, D.Of, D.Range)
+		}
+		rv.SetInt(i)
+		return data[bits/8:], nil
+	case reflect.Float32:
+		if len(data) < 4 {
+			return nil, errKey
+		}
+		rv.SetFloat(float64(math.Float32frombits(uint32(unorderFloat(readBigEndian(data[:4]), 32)))))
+		return data[4:], nil
+	case reflect.Float64:
+		if len(data) < 8 {
+			return nil, errKey
+		}
+		rv.SetFloat(math.Float64frombits(unorderFloat(readBigEndian(data[:8]), 64)))
+		return data[8:], nil
+	case reflect.String:
+		s, rest, err := readKeyBytes(data)
+		if err == nil {
+			rv.SetString(string(s))
+		}
+		return rest, err
+	case reflect.Slice:
+		if rv.Type().Elem().Kind() == reflect.Uint8 {
+			s, rest, err := readKeyBytes(data)
+			if err == nil {
+				rv.SetBytes(s)
+			}
+			return rest, err
+		}
+	case reflect.Array:
+		var err error
+		for i := 0; i < rv.Len() && err == nil; i++ {
+			data, err = decodeKey(data, rv.Index(i))
+		}
+		return data, err
+	case reflect.Struct:
+		var err error
+		for _, i := range scanStruct(rv.Type()).fields {
+			if data, err = decodeKey(data, rv.Field(i)); err != nil {
+				return nil, err
+			}
+		}
+		return data, nil
+	}
+	return nil, Err("DecodeKey", rv.Type().String(), D.Type, D.Not, D.Supported)
+}
+
+var errKey = Err("DecodeKey", "key", D.Invalid)
+
+// keyBits returns the key width of an integer type: 64 for the
+// platform-sized int, uint and uintptr, as intEncoding.forType does.
+func keyBits(t reflect.Type) int {
+	switch t.Kind() {
+	case reflect.Int, reflect.Uint, reflect.Uintptr:
+		return 64
+	}
+	return t.Bits()
+}
+
+// orderFloat maps IEEE 754 bits to an unsigned integer with the same order.
+func orderFloat(u uint64, bits int) uint64 {
+	sign := uint64(1) << (bits - 1)
+	if u&sign != 0 {
+		return ^u & (sign<<1 - 1)
+	}
+	return u | sign
+}
+
+// unorderFloat reverses orderFloat.
+func unorderFloat(u uint64, bits int) uint64 {
+	sign := uint64(1) << (bits - 1)
+	if u&sign != 0 {
+		return u &^ sign
+	}
+	return ^u & (sign<<1 - 1)
+}
+
+func appendBigEndian(b []byte, v uint64, n int) []byte {
+	for i := n - 1; i >= 0; i-- {
+		b = append(b, byte(v>>(8*i)))
+	}
+	return b
+}
+
+func readBigEndian(b []byte) (v uint64) {
+	for _, c := range b {
+		v = v<<8 | uint64(c)
+	}
+	return v
+}
+
+func appendKeyBytes(b []byte, s string) []byte {
+	for i := 0; i < len(s); i++ {
+		if s[i] == keyEscape {
+			b = append(b, keyEscape, keyEscaped00)
+		} else {
+			b = append(b, s[i])
+		}
+	}
+	return append(b, keyEscape, keyTerminator)
+}
+
+// readKeyBytes unescapes a string or []byte key and returns the bytes after it.
+func readKeyBytes(data []byte) (out, rest []byte, err error) {
+	out = make([]byte, 0, len(data))
+	for i := 0; i < len(data); i++ {
+		if data[i] != keyEscape {
+			out = append(out, data[i])
+			continue
+		}
+		if i+1 == len(data) {
+			break
+		}
+		switch data[i+1] {
+		case keyTerminator:
+			return out, data[i+2:], nil
+		case keyEscaped00:
+			out = append(out, 0)
+			i++
+		default:
+			return nil, nil, errKey
+		}
+	}
+	return nil, nil, errKey
+}
@@ -0,0 +1,197 @@
+package binary
+
+import (
+	"bytes"
+	"math"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+type keyTuple struct {
+	Tenant uint16
+	Name   string
+	Active bool
+	Score  float32
+	Rank   int8
+}
+
+func compareTuple(a, b keyTuple) int {
+	switch {
+	case a.Tenant != b.Tenant:
+		return cmpOrdered(a.Tenant, b.Tenant)
+	case a.Name != b.Name:
+		return strings.Compare(a.Name, b.Name)
+	case a.Active != b.Active:
+		if b.Active {
+			return -1
+		}
+		return 1
+	case a.Score != b.Score:
+		return cmpOrdered(a.Score, b.Score)
+	}
+	return cmpOrdered(a.Rank, b.Rank)
+}
+
+func cmpOrdered[T int8 | int64 | uint16 | uint64 | float32 | float64](a, b T) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func sign(n int) int {
+	switch {
+	case n < 0:
+		return -1
+	case n > 0:
+		return 1
+	}
+	return 0
+}
+
+func mustKey(t *testing.T, v any) []byte {
+	t.Helper()
+	b, err := EncodeKey(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// checkKeyOrder encodes every pair of values and compares bytes.Compare of
+// the keys with cmp, then decodes each key back.
+func checkKeyOrder[T any](t *testing.T, values []T, cmp func(a, b T) int, eq func(a, b T) bool) {
+	t.Helper()
+	keys := make([][]byte, len(values))
+	for i, v := range values {
+		keys[i] = mustKey(t, v)
+		var back T
+		if err := DecodeKey(keys[i], &back); err != nil || !eq(back, v) {
+			t.Fatalf("round trip of %v: got %v, %v", v, back, err)
+		}
+	}
+	for i := range values {
+		for j := range values {
+			if got, want := sign(bytes.Compare(keys[i], keys[j])), cmp(values[i], values[j]); got != want {
+				t.Fatalf("order of %v and %v: keys compare %d, values %d", values[i], values[j], got, want)
+			}
+		}
+	}
+}
+
+func TestKeyOrder(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	eq := func(a, b int64) bool { return a == b }
+
+	t.Run("Int64", func(t *testing.T) {
+		values := []int64{math.MinInt64, -1 << 40, -300, -1, 0, 1, 127, 128, 300, math.MaxInt64}
+		for i := 0; i < 100; i++ {
+			values = append(values, rng.Int63()-rng.Int63())
+		}
+		checkKeyOrder(t, values, cmpOrdered[int64], eq)
+	})
+
+	t.Run("Int8", func(t *testing.T) {
+		var values []int8
+		for i := math.MinInt8; i <= math.MaxInt8; i++ {
+			values = append(values, int8(i))
+		}
+		checkKeyOrder(t, values, cmpOrdered[int8], func(a, b int8) bool { return a == b })
+	})
+
+	t.Run("Uint64", func(t *testing.T) {
+		values := []uint64{0, 1, 255, 256, math.MaxUint32, math.MaxUint64}
+		for i := 0; i < 100; i++ {
+			values = append(values, rng.Uint64())
+		}
+		checkKeyOrder(t, values, cmpOrdered[uint64], func(a, b uint64) bool { return a == b })
+	})
+
+	t.Run("Float64", func(t *testing.T) {
+		values := []float64{math.Inf(-1), -math.MaxFloat64, -1.5, -math.SmallestNonzeroFloat64, 0, math.SmallestNonzeroFloat64, 1, 1.5, math.MaxFloat64, math.Inf(1)}
+		for i := 0; i < 100; i++ {
+			values = append(values, (rng.Float64()-0.5)*math.Pow(10, float64(rng.Intn(40)-20)))
+		}
+		checkKeyOrder(t, values, cmpOrdered[float64], func(a, b float64) bool { return a == b })
+
+		nan, negZero := mustKey(t, math.NaN()), mustKey(t, math.Copysign(0, -1))
+		if bytes.Compare(nan, mustKey(t, math.Inf(1))) <= 0 {
+			t.Error("NaN should sort after +Inf")
+		}
+		if bytes.Compare(negZero, mustKey(t, 0.0)) >= 0 {
+			t.Error("-0 should sort before +0")
+		}
+	})
+
+	t.Run("String", func(t *testing.T) {
+		values := []string{"", "\x00", "\x00\x00", "\x00\x01", "\x01", "a", "a\x00", "a\x00b", "ab", "b", "\xff"}
+		for i := 0; i < 100; i++ {
+			b := make([]byte, rng.Intn(6))
+			for j := range b {
+				b[j] = []byte{0, 1, 'a', 0xff}[rng.Intn(4)]
+			}
+			values = append(values, string(b))
+		}
+		checkKeyOrder(t, values, strings.Compare, func(a, b string) bool { return a == b })
+	})
+
+	t.Run("Tuple", func(t *testing.T) {
+		var values []keyTuple
+		for i := 0; i < 150; i++ {
+			values = append(values, keyTuple{
+				Tenant: uint16(rng.Intn(3)),
+				Name:   []string{"", "a", "a\x00", "ab", "b"}[rng.Intn(5)],
+				Active: rng.Intn(2) == 1,
+				Score:  float32(rng.Intn(5) - 2),
+				Rank:   int8(rng.Intn(5) - 2),
+			})
+		}
+		checkKeyOrder(t, values, compareTuple, func(a, b keyTuple) bool { return a == b })
+	})
+}
+
+func TestKeyPlatformInts(t *testing.T) {
+	// int, uint and uintptr keys are 8 bytes whatever the platform word size.
+	assertEqualBytes(t, []byte{0x7f, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}, mustKey(t, int(-1)))
+	assertEqualBytes(t, mustKey(t, int64(-1)), mustKey(t, int(-1)))
+	assertEqualBytes(t, mustKey(t, uint64(7)), mustKey(t, uint(7)))
+	assertEqualBytes(t, mustKey(t, uint64(7)), mustKey(t, uintptr(7)))
+
+	var i int
+	assertNoError(t, DecodeKey(mustKey(t, int64(-42)), &i))
+	assertEqual(t, -42, i)
+	var u uint
+	assertNoError(t, DecodeKey(mustKey(t, uint64(42)), &u))
+	assertEqual(t, uint(42), u)
+}
+
+func TestKeyErrors(t *testing.T) {
+	if _, err := EncodeKey(map[string]int{}); err == nil {
+		t.Error("expected error for a map")
+	}
+	if _, err := EncodeKey(nil); err == nil {
+		t.Error("expected error for nil")
+	}
+
+	var s string
+	if err := DecodeKey([]byte("abc"), &s); err == nil {
+		t.Error("expected error for a missing terminator")
+	}
+	if err := DecodeKey([]byte{'a', 0x00, 0x07}, &s); err == nil {
+		t.Error("expected error for a bad escape")
+	}
+	var n int32
+	if err := DecodeKey([]byte{0, 0}, &n); err == nil {
+		t.Error("expected error for a short int")
+	}
+	if err := DecodeKey(append(mustKey(t, int32(1)), 0), &n); err == nil {
+		t.Error("expected error for trailing bytes")
+	}
+	if err := DecodeKey(mustKey(t, int32(1)), n); err == nil {
+		t.Error("expected error for a non-pointer")
+	}
+}
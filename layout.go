@@ -0,0 +1,466 @@
+package binary
+
+import (
+	"io"
+	"math"
+	"reflect"
+	"strconv"
+
+	. "github.com/tinywasm/fmt"
+)
+
+// Layout selects a fixed binary layout, the one encoding/binary.Write uses
+// for C-style structs, file headers and device packets.
+type Layout uint8
+
+const (
+	LayoutNone         Layout = iota // the native, self-describing format
+	LayoutLittleEndian               // fixed layout, least significant byte first
+	LayoutBigEndian                  // fixed layout, most significant byte first
+)
+
+// layoutHandler is implemented by types that are always encoded in a fixed
+// layout, whatever the codec options.
+type layoutHandler interface {
+	BinaryLayout() Layout
+}
+
+// WithLayout makes the codec encode and decode values in layout l, unless
+// their type has a BinaryLayout() Layout method, which always wins. A layout
+// takes precedence over WithFormat; the compression envelope and frames
+// still wrap it.
+//
+// In a fixed layout nothing is length-prefixed and no header is written:
+// bools are one byte, ints, uints and floats are written at their size in the
+// layout's byte order, and arrays and structs are their elements in order.
+// int and uint need a fixed32 or fixed64 tag, and a field tagged be is
+// big-endian in either layout. Struct tags add what a fixed layout needs:
+//
+//   - len=N: strings and []byte are N bytes, zero-padded (trailing zero bytes
+//     are trimmed from decoded strings); other slices are N elements
+//   - pad=N: N zero bytes before the field, skipped when decoding
+//
+// Blank fields (_) are padding of their size, as in encoding/binary. Pointers,
+// maps, marshalers and untagged strings and slices have no fixed size and are
+// rejected, as are unexported fields and fields tagged "-", which would shift
+// the offsets after them. Decoding reads exactly the size of the value and ignores any
+// bytes after it, like a header followed by a body.
+func WithLayout(l Layout) Option {
+	return func(tb *instance) {
+		tb.layout = l
+	}
+}
+
+var layoutHandlerType = reflect.TypeOf((*layoutHandler)(nil)).Elem()
+
+// layoutOf returns the layout v is encoded in. BinaryLayout may have a
+// pointer receiver, so values passed by value are checked through *T.
+func (tb *instance) layoutOf(v any) Layout {
+	if lh, ok := v.(layoutHandler); ok {
+		return lh.BinaryLayout()
+	}
+	if t := reflect.TypeOf(v); t != nil && t.Kind() != reflect.Ptr && reflect.PointerTo(t).Implements(layoutHandlerType) {
+		return reflect.New(t).Interface().(layoutHandler).BinaryLayout()
+	}
+	return tb.layout
+}
+
+// layoutEntry caches the layout codec of a type.
+type layoutEntry struct {
+	Type   reflect.Type
+	layout Layout
+	codec  codec
+	err    error
+}
+
+// layoutCodecOf returns the cached codec of t in layout l, scanning it on
+// first use.
+func (tb *instance) layoutCodecOf(t reflect.Type, l Layout) (codec, error) {
+	tb.mu.RLock()
+	for _, entry := range tb.layouts {
+		if entry.Type == t && entry.layout == l {
+			tb.mu.RUnlock()
+			return entry.codec, entry.err
+		}
+	}
+	tb.mu.RUnlock()
+
+	c, err := scanLayout(t, layoutTag{}, l == LayoutBigEndian)
+	tb.mu.Lock()
+	tb.layouts = append(tb.layouts, layoutEntry{t, l, c, err})
+	tb.mu.Unlock()
+	return c, err
+}
+
+// encodeLayout encodes data in layout l.
+func (tb *instance) encodeLayout(data any, l Layout, dst io.Writer) error {
+	if data == nil {
+		return Err("Encode", "nil value")
+	}
+	rv := reflect.Indirect(reflect.ValueOf(data))
+	c, err := tb.layoutCodecOf(rv.Type(), l)
+	if err != nil {
+		return err
+	}
+
+	e := tb.encoders.Get().(*encoder)
+	e.reset(dst, tb)
+	if err = c.encodeTo(e, rv); err == nil {
+		err = e.err
+	}
+	tb.encoders.Put(e)
+	return err
+}
+
+// decodeLayout decodes a value in layout l from d into target.
+func (tb *instance) decodeLayout(d *decoder, target any, l Layout) error {
+	rv := reflect.ValueOf(target)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return Err(D.Binary, "decoder", D.Required, D.Type, D.Pointer)
+	}
+	c, err := tb.layoutCodecOf(rv.Elem().Type(), l)
+	if err != nil {
+		return err
+	}
+	return c.decodeTo(d, rv.Elem())
+}
+
+// ------------------------------------------------------------------------------
+
+// layoutTag holds the binary tag options of a field that matter in a layout.
+type layoutTag struct {
+	enc intEncoding
+	n   int // len=N
+	pad int // pad=N
+}
+
+// parseLayoutTag reads the layout options of a struct field.
+func parseLayoutTag(f reflect.StructField) (layoutTag, error) {
+	enc, err := fieldIntEncoding(f)
+	if err != nil {
+		return layoutTag{}, err
+	}
+	tag := layoutTag{enc: enc}
+	opts, _ := Convert(string(f.Tag)).TagValue("binary")
+	for _, opt := range Convert(opts).Split(",") {
+		var dst *int
+		switch {
+		case HasPrefix(opt, "len="):
+			dst = &tag.n
+		case HasPrefix(opt, "pad="):
+			dst = &tag.pad
+		default:
+			continue
+		}
+		n, err := strconv.Atoi(opt[4:])
+		if err != nil || n < 0 {
+			return layoutTag{}, Err("binary tag", opt, D.Invalid)
+		}
+		*dst = n
+	}
+	return tag, nil
+}
+
+// scanLayout builds the codec of t in a fixed layout, big-endian when big is
+// set. tag holds the options of the field t belongs to; like integer
+// encodings they apply to the elements of arrays and slices too.
+func scanLayout(t reflect.Type, tag layoutTag, big bool) (codec, error) {
+	pt := reflect.PointerTo(t)
+	if t.Implements(binaryMarshalerType) || pt.Implements(binaryMarshalerType) {
+		return nil, errNoFixedSize(t)
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return new(boolcodec), nil
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int, reflect.Int64,
+		reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint, reflect.Uint64:
+		enc := tag.enc.forType(t)
+		if enc.plain {
+			return nil, Err("binary tag", "uvarint", D.Not, D.Supported, "in a fixed layout")
+		}
+		if enc.size == 0 {
+			if k := t.Kind(); k == reflect.Int || k == reflect.Uint {
+				return nil, Err(t.String(), "has no fixed size, tag it fixed32 or fixed64")
+			}
+			enc.size = t.Bits() / 8
+		}
+		enc.bigEndian = enc.bigEndian || big
+		signed := t.Kind() >= reflect.Int && t.Kind() <= reflect.Int64
+		return &intcodec{enc: enc, signed: signed}, nil
+	case reflect.Float32, reflect.Float64:
+		return &layoutFloatcodec{size: t.Bits() / 8, big: big}, nil
+	case reflect.Array:
+		elem, err := scanLayout(t.Elem(), tag, big)
+		if err != nil {
+			return nil, err
+		}
+		return &reflectArraycodec{elemcodec: elem}, nil
+	case reflect.String:
+		if tag.n > 0 {
+			return &fixedStringcodec{n: tag.n}, nil
+		}
+	case reflect.Slice:
+		if tag.n == 0 {
+			break
+		}
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &fixedStringcodec{n: tag.n, bytes: true}, nil
+		}
+		elem, err := scanLayout(t.Elem(), tag, big)
+		if err != nil {
+			return nil, err
+		}
+		return &fixedSlicecodec{n: tag.n, elemcodec: elem}, nil
+	case reflect.Struct:
+		return scanLayoutStruct(t, big)
+	}
+	return nil, errNoFixedSize(t)
+}
+
+func errNoFixedSize(t reflect.Type) error {
+	return Err(t.String(), "has no fixed size in a binary layout")
+}
+
+// scanLayoutStruct builds the codec of the struct t in a fixed layout.
+func scanLayoutStruct(t reflect.Type, big bool) (codec, error) {
+	encoded := scanStruct(t).fields
+	var c layoutStructcodec
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.Name == "_" {
+			size, ok := layoutSize(field.Type)
+			if !ok {
+				return nil, errNoFixedSize(field.Type)
+			}
+			c = append(c, layoutField{index: -1, pad: size})
+			continue
+		}
+		if len(encoded) == 0 || encoded[0] != i {
+			// Leaving it out would shift every later offset.
+			return nil, Err(t.String()+"."+field.Name+":", "unexported and skipped fields are not supported in a binary layout, use _ for padding")
+		}
+		encoded = encoded[1:]
+
+		tag, err := parseLayoutTag(field)
+		if err != nil {
+			return nil, err
+		}
+		fc, err := scanLayout(field.Type, tag, big)
+		if err != nil {
+			return nil, Err(t.String()+"."+field.Name+":", err)
+		}
+		c = append(c, layoutField{index: i, pad: tag.pad, codec: fc})
+	}
+	return &c, nil
+}
+
+// layoutSize returns the encoded size of a blank field of type t, the way
+// encoding/binary computes it.
+func layoutSize(t reflect.Type) (int, bool) {
+	switch t.Kind() {
+	case reflect.Bool, reflect.Int8, reflect.Uint8:
+		return 1, true
+	case reflect.Int16, reflect.Int32, reflect.Int64, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return t.Bits() / 8, true
+	case reflect.Array:
+		size, ok := layoutSize(t.Elem())
+		return size * t.Len(), ok
+	case reflect.Struct:
+		total := 0
+		for i := 0; i < t.NumField(); i++ {
+			size, ok := layoutSize(t.Field(i).Type)
+			if !ok {
+				return 0, false
+			}
+			total += size
+		}
+		return total, true
+	}
+	return 0, false
+}
+
+// ------------------------------------------------------------------------------
+
+// layoutZeros is written in chunks for padding.
+var layoutZeros [64]byte
+
+// writeZeros writes n zero bytes.
+func (e *encoder) writeZeros(n int) {
+	for n > 0 {
+		chunk := n
+		if chunk > len(layoutZeros) {
+			chunk = len(layoutZeros)
+		}
+		e.write(layoutZeros[:chunk])
+		n -= chunk
+	}
+}
+
+// skip discards n bytes.
+func (d *decoder) skip(n int) error {
+	for n > 0 {
+		chunk := n
+		if chunk > len(layoutZeros) {
+			chunk = len(layoutZeros)
+		}
+		if _, err := d.reader.Slice(chunk); err != nil {
+			return err
+		}
+		n -= chunk
+	}
+	return nil
+}
+
+type layoutField struct {
+	index int // field index, -1 for a blank field
+	pad   int // zero bytes before the field
+	codec codec
+}
+
+type layoutStructcodec []layoutField
+
+// Encode encodes a value into the encoder.
+func (c *layoutStructcodec) encodeTo(e *encoder, rv reflect.Value) error {
+	for _, f := range *c {
+		e.writeZeros(f.pad)
+		if f.index >= 0 {
+			if err := f.codec.encodeTo(e, rv.Field(f.index)); err != nil {
+				return err
+			}
+		}
+	}
+	return e.err
+}
+
+// Decode decodes into a reflect value from the decoder.
+func (c *layoutStructcodec) decodeTo(d *decoder, rv reflect.Value) error {
+	for _, f := range *c {
+		if err := d.skip(f.pad); err != nil {
+			return err
+		}
+		if f.index >= 0 {
+			if err := f.codec.decodeTo(d, rv.Field(f.index)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// ------------------------------------------------------------------------------
+
+type layoutFloatcodec struct {
+	size int
+	big  bool
+}
+
+// Encode encodes a value into the encoder.
+func (c *layoutFloatcodec) encodeTo(e *encoder, rv reflect.Value) error {
+	enc := intEncoding{size: c.size, bigEndian: c.big}
+	if c.size == 4 {
+		e.writeFixed(enc, uint64(math.Float32bits(float32(rv.Float()))))
+	} else {
+		e.writeFixed(enc, math.Float64bits(rv.Float()))
+	}
+	return e.err
+}
+
+// Decode decodes into a reflect value from the decoder.
+func (c *layoutFloatcodec) decodeTo(d *decoder, rv reflect.Value) error {
+	bits, err := d.readFixed(intEncoding{size: c.size, bigEndian: c.big})
+	if err != nil {
+		return err
+	}
+	if c.size == 4 {
+		rv.SetFloat(float64(math.Float32frombits(uint32(bits))))
+	} else {
+		rv.SetFloat(math.Float64frombits(bits))
+	}
+	return nil
+}
+
+// ------------------------------------------------------------------------------
+
+// fixedStringcodec writes strings, or []byte when bytes is set, as n
+// zero-padded bytes.
+type fixedStringcodec struct {
+	n     int
+	bytes bool
+}
+
+// Encode encodes a value into the encoder.
+func (c *fixedStringcodec) encodeTo(e *encoder, rv reflect.Value) error {
+	var b []byte
+	if c.bytes {
+		b = rv.Bytes()
+	} else {
+		b = toBytes(rv.String())
+	}
+	if len(b) > c.n {
+		return Err(rv.Type().String(), "of", Convert(len(b)).String(), "bytes exceeds len="+strconv.Itoa(c.n))
+	}
+	e.write(b)
+	e.writeZeros(c.n - len(b))
+	return e.err
+}
+
+// Decode decodes into a reflect value from the decoder.
+func (c *fixedStringcodec) decodeTo(d *decoder, rv reflect.Value) error {
+	b, err := d.reader.Slice(c.n)
+	if err != nil {
+		return err
+	}
+	if c.bytes {
+		rv.SetBytes(append([]byte(nil), b...))
+		return nil
+	}
+	end := len(b)
+	for end > 0 && b[end-1] == 0 {
+		end--
+	}
+	rv.SetString(string(b[:end]))
+	return nil
+}
+
+// ------------------------------------------------------------------------------
+
+// fixedSlicecodec writes slices as n elements, padded with zero values.
+type fixedSlicecodec struct {
+	n         int
+	elemcodec codec
+}
+
+// Encode encodes a value into the encoder.
+func (c *fixedSlicecodec) encodeTo(e *encoder, rv reflect.Value) error {
+	l := rv.Len()
+	if l > c.n {
+		return Err(rv.Type().String(), "of", Convert(l).String(), "elements exceeds len="+strconv.Itoa(c.n))
+	}
+	for i := 0; i < l; i++ {
+		if err := c.elemcodec.encodeTo(e, rv.Index(i)); err != nil {
+			return err
+		}
+	}
+	if l < c.n {
+		zero := reflect.New(rv.Type().Elem()).Elem()
+		for i := l; i < c.n; i++ {
+			if err := c.elemcodec.encodeTo(e, zero); err != nil {
+				return err
+			}
+		}
+	}
+	return e.err
+}
+
+// Decode decodes into a reflect value from the decoder.
+func (c *fixedSlicecodec) decodeTo(d *decoder, rv reflect.Value) error {
+	rv.Set(reflect.MakeSlice(rv.Type(), c.n, c.n))
+	for i := 0; i < c.n; i++ {
+		if err := c.elemcodec.decodeTo(d, rv.Index(i)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,174 @@
+package binary
+
+import (
+	"bytes"
+	stdbinary "encoding/binary"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type layoutHeader struct {
+	Magic   [4]byte
+	Version uint16
+	Flags   uint8
+	_       [1]byte
+	Size    uint32
+	Offset  int64
+	Scale   float32
+	Ratio   float64
+	Ok      bool
+	Points  [2]struct{ X, Y int16 }
+}
+
+type layoutPacket struct {
+	ID    uint16
+	Name  string  `binary:"len=8"`
+	Raw   []byte  `binary:"len=3"`
+	Temps []int16 `binary:"len=2"`
+	Count int     `binary:"fixed32,pad=2"`
+	CRC   uint32  `binary:"be"`
+}
+
+// layoutFrame is always big-endian, whatever the codec options.
+type layoutFrame struct {
+	Kind uint8
+	Len  uint16
+}
+
+func (layoutFrame) BinaryLayout() Layout { return LayoutBigEndian }
+
+// layoutPtrFrame declares its layout on the pointer receiver.
+type layoutPtrFrame struct {
+	Len uint16
+}
+
+func (*layoutPtrFrame) BinaryLayout() Layout { return LayoutBigEndian }
+
+func TestLayoutMatchesEncodingBinary(t *testing.T) {
+	in := layoutHeader{
+		Magic: [4]byte{'T', 'W', 'B', 'N'}, Version: 0x0102, Flags: 0x80, Size: 1 << 20,
+		Offset: -3, Scale: 1.5, Ratio: -0.25, Ok: true,
+	}
+	in.Points[1].Y = -7
+
+	for _, order := range []struct {
+		layout Layout
+		std    stdbinary.ByteOrder
+	}{
+		{LayoutLittleEndian, stdbinary.LittleEndian},
+		{LayoutBigEndian, stdbinary.BigEndian},
+	} {
+		var want bytes.Buffer
+		assertNoError(t, stdbinary.Write(&want, order.std, &in))
+
+		c := New(WithLayout(order.layout))
+		var data []byte
+		assertNoError(t, c.Encode(&in, &data))
+		assertEqualBytes(t, want.Bytes(), data)
+
+		size, err := c.EncodedSize(&in)
+		assertNoError(t, err)
+		assertEqual(t, stdbinary.Size(&in), size)
+
+		var out layoutHeader
+		assertNoError(t, c.Decode(data, &out))
+		if !reflect.DeepEqual(in, out) {
+			t.Fatalf("round trip: got %+v, want %+v", out, in)
+		}
+	}
+}
+
+func TestLayoutTags(t *testing.T) {
+	c := New(WithLayout(LayoutLittleEndian))
+	in := layoutPacket{ID: 0x0102, Name: "abc", Raw: []byte{9}, Temps: []int16{-2}, Count: 7, CRC: 0x11223344}
+	var data []byte
+	assertNoError(t, c.Encode(&in, &data))
+	assertEqualBytes(t, []byte{
+		0x02, 0x01, // ID
+		'a', 'b', 'c', 0, 0, 0, 0, 0, // Name
+		9, 0, 0, // Raw
+		0xfe, 0xff, 0, 0, // Temps
+		0, 0, // pad
+		7, 0, 0, 0, // Count
+		0x11, 0x22, 0x33, 0x44, // CRC
+	}, data)
+
+	var out layoutPacket
+	assertNoError(t, c.Decode(append(data, 0xaa), &out))
+	assertEqual(t, "abc", out.Name)
+	assertEqualBytes(t, []byte{9, 0, 0}, out.Raw)
+	assertEqual(t, 2, len(out.Temps))
+	assertEqual(t, int16(-2), out.Temps[0])
+	assertEqual(t, 7, out.Count)
+	assertEqual(t, uint32(0x11223344), out.CRC)
+
+	in.Name = "too long!"
+	if err := c.Encode(&in, &data); err == nil || !strings.Contains(err.Error(), "len=8") {
+		t.Fatalf("long string: %v", err)
+	}
+}
+
+func TestLayoutPerType(t *testing.T) {
+	var data []byte
+	assertNoError(t, Encode(layoutFrame{Kind: 1, Len: 0x0203}, &data))
+	assertEqualBytes(t, []byte{1, 2, 3}, data)
+
+	// Values follow each other in a stream without length prefixes.
+	stream := bytes.NewReader([]byte{1, 0, 5, 2, 0, 6})
+	for _, want := range []layoutFrame{{1, 5}, {2, 6}} {
+		var f layoutFrame
+		assertNoError(t, Decode(stream, &f))
+		assertEqual(t, want, f)
+	}
+
+	// The type's layout wins over the codec's format.
+	c := New(WithFormat(FormatCBOR))
+	assertNoError(t, c.Encode(&layoutFrame{Kind: 9}, &data))
+	assertEqualBytes(t, []byte{9, 0, 0}, data)
+
+	// A pointer receiver applies to values passed by value too.
+	assertNoError(t, Encode(layoutPtrFrame{Len: 0x0102}, &data))
+	assertEqualBytes(t, []byte{1, 2}, data)
+	var pf layoutPtrFrame
+	assertNoError(t, Decode(data, &pf))
+	assertEqual(t, uint16(0x0102), pf.Len)
+}
+
+func TestLayoutErrors(t *testing.T) {
+	c := New(WithLayout(LayoutBigEndian))
+	var data []byte
+	for _, v := range []any{
+		&struct{ N int }{},
+		&struct{ S string }{},
+		&struct{ B []byte }{},
+		&struct{ P *uint8 }{},
+		&struct{ M map[uint8]uint8 }{},
+		&struct {
+			N int32 `binary:"uvarint"`
+		}{},
+		&struct {
+			S string `binary:"len=x"`
+		}{},
+		&struct {
+			A uint8
+			b uint8
+		}{},
+		&struct {
+			A uint8
+			B uint8 `binary:"-"`
+		}{},
+		&struct {
+			A uint8 `json:"-"`
+		}{},
+	} {
+		if err := c.Encode(v, &data); err == nil {
+			t.Errorf("%T: expected an error", v)
+		}
+	}
+
+	var h layoutHeader
+	if err := c.Decode([]byte{1, 2, 3}, &h); err == nil {
+		t.Error("short input should fail")
+	}
+}
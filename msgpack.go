@@ -0,0 +1,232 @@
+package binary
+
+import (
+	"math"
+
+	. "github.com/tinywasm/fmt"
+)
+
+// MessagePack format bytes (https://github.com/msgpack/msgpack/blob/master/spec.md).
+const (
+	msgpackNil      = 0xc0
+	msgpackFalse    = 0xc2
+	msgpackTrue     = 0xc3
+	msgpackBin8     = 0xc4
+	msgpackBin16    = 0xc5
+	msgpackBin32    = 0xc6
+	msgpackFloat32  = 0xca
+	msgpackFloat64  = 0xcb
+	msgpackUint8    = 0xcc
+	msgpackUint16   = 0xcd
+	msgpackUint32   = 0xce
+	msgpackUint64   = 0xcf
+	msgpackInt8     = 0xd0
+	msgpackInt16    = 0xd1
+	msgpackInt32    = 0xd2
+	msgpackInt64    = 0xd3
+	msgpackStr8     = 0xd9
+	msgpackStr16    = 0xda
+	msgpackStr32    = 0xdb
+	msgpackArray16  = 0xdc
+	msgpackArray32  = 0xdd
+	msgpackMap16    = 0xde
+	msgpackMap32    = 0xdf
+	msgpackFixMap   = 0x80
+	msgpackFixArray = 0x90
+	msgpackFixStr   = 0xa0
+)
+
+// msgpackWriter writes MessagePack items in their shortest form.
+type msgpackWriter struct{}
+
+func (msgpackWriter) appendNil(b []byte) []byte { return append(b, msgpackNil) }
+
+func (msgpackWriter) appendBool(b []byte, v bool) []byte {
+	if v {
+		return append(b, msgpackTrue)
+	}
+	return append(b, msgpackFalse)
+}
+
+func (w msgpackWriter) appendInt(b []byte, v int64) []byte {
+	switch {
+	case v >= 0:
+		return w.appendUint(b, uint64(v))
+	case v >= -32:
+		return append(b, byte(v)) // negative fixint
+	case v >= math.MinInt8:
+		return append(b, msgpackInt8, byte(v))
+	case v >= math.MinInt16:
+		return appendBigEndian(append(b, msgpackInt16), uint64(v), 2)
+	case v >= math.MinInt32:
+		return appendBigEndian(append(b, msgpackInt32), uint64(v), 4)
+	}
+	return appendBigEndian(append(b, msgpackInt64), uint64(v), 8)
+}
+
+func (msgpackWriter) appendUint(b []byte, v uint64) []byte {
+	switch {
+	case v < 0x80:
+		return append(b, byte(v)) // positive fixint
+	case v <= math.MaxUint8:
+		return append(b, msgpackUint8, byte(v))
+	case v <= math.MaxUint16:
+		return appendBigEndian(append(b, msgpackUint16), v, 2)
+	case v <= math.MaxUint32:
+		return appendBigEndian(append(b, msgpackUint32), v, 4)
+	}
+	return appendBigEndian(append(b, msgpackUint64), v, 8)
+}
+
+func (msgpackWriter) appendFloat32(b []byte, v float32) []byte {
+	return appendBigEndian(append(b, msgpackFloat32), uint64(math.Float32bits(v)), 4)
+}
+
+func (msgpackWriter) appendFloat64(b []byte, v float64) []byte {
+	return appendBigEndian(append(b, msgpackFloat64), math.Float64bits(v), 8)
+}
+
+func (msgpackWriter) appendString(b []byte, s string) []byte {
+	l := uint64(len(s))
+	switch {
+	case l < 32:
+		b = append(b, msgpackFixStr|byte(l))
+	case l <= math.MaxUint8:
+		b = append(b, msgpackStr8, byte(l))
+	case l <= math.MaxUint16:
+		b = appendBigEndian(append(b, msgpackStr16), l, 2)
+	default:
+		b = appendBigEndian(append(b, msgpackStr32), l, 4)
+	}
+	return append(b, s...)
+}
+
+func (msgpackWriter) appendBytes(b []byte, v []byte) []byte {
+	l := uint64(len(v))
+	switch {
+	case l <= math.MaxUint8:
+		b = append(b, msgpackBin8, byte(l))
+	case l <= math.MaxUint16:
+		b = appendBigEndian(append(b, msgpackBin16), l, 2)
+	default:
+		b = appendBigEndian(append(b, msgpackBin32), l, 4)
+	}
+	return append(b, v...)
+}
+
+func (msgpackWriter) appendArray(b []byte, n int) []byte {
+	return appendMsgpackHead(b, msgpackFixArray, msgpackArray16, uint64(n))
+}
+
+func (msgpackWriter) appendMap(b []byte, n int) []byte {
+	return appendMsgpackHead(b, msgpackFixMap, msgpackMap16, uint64(n))
+}
+
+// appendMsgpackHead appends an array or map head: fix is the fix format
+// byte and head16 the 16-bit one, followed by its 32-bit variant.
+func appendMsgpackHead(b []byte, fix, head16 byte, n uint64) []byte {
+	switch {
+	case n < 16:
+		return append(b, fix|byte(n))
+	case n <= math.MaxUint16:
+		return appendBigEndian(append(b, head16), n, 2)
+	}
+	return appendBigEndian(append(b, head16+1), n, 4)
+}
+
+// msgpackReader reads MessagePack items. Extension types are rejected.
+type msgpackReader struct{}
+
+func (msgpackReader) next(r *sliceReader) (item, error) {
+	head, err := r.ReadByte()
+	if err != nil {
+		return item{}, errItemTruncated(FormatMsgPack)
+	}
+
+	switch {
+	case head < 0x80:
+		return item{kind: itemUint, u: uint64(head)}, nil
+	case head >= 0xe0:
+		return item{kind: itemInt, i: int64(int8(head))}, nil
+	case head&0xf0 == msgpackFixMap:
+		return readMsgpackContainer(r, itemMap, uint64(head&0x0f))
+	case head&0xf0 == msgpackFixArray:
+		return readMsgpackContainer(r, itemArray, uint64(head&0x0f))
+	case head&0xe0 == msgpackFixStr:
+		return readMsgpackData(r, itemString, uint64(head&0x1f))
+	}
+
+	switch head {
+	case msgpackNil:
+		return item{kind: itemNil}, nil
+	case msgpackFalse, msgpackTrue:
+		return item{kind: itemBool, b: head == msgpackTrue}, nil
+	}
+
+	// Every other format has a fixed-size argument after the head.
+	var size int
+	switch head {
+	case msgpackBin8, msgpackUint8, msgpackInt8, msgpackStr8:
+		size = 1
+	case msgpackBin16, msgpackUint16, msgpackInt16, msgpackStr16, msgpackArray16, msgpackMap16:
+		size = 2
+	case msgpackBin32, msgpackFloat32, msgpackUint32, msgpackInt32, msgpackStr32, msgpackArray32, msgpackMap32:
+		size = 4
+	case msgpackFloat64, msgpackUint64, msgpackInt64:
+		size = 8
+	default:
+		return item{}, Err("MessagePack", "format", "0x"+hexByte(head), D.Not, D.Supported)
+	}
+	b, err := r.Slice(size)
+	if err != nil {
+		return item{}, errItemTruncated(FormatMsgPack)
+	}
+	arg := readBigEndian(b)
+
+	switch head {
+	case msgpackUint8, msgpackUint16, msgpackUint32, msgpackUint64:
+		return item{kind: itemUint, u: arg}, nil
+	case msgpackInt8, msgpackInt16, msgpackInt32, msgpackInt64:
+		// Sign-extend from the argument's width.
+		shift := 64 - 8*size
+		v := int64(arg<<shift) >> shift
+		if v >= 0 {
+			return item{kind: itemUint, u: uint64(v)}, nil
+		}
+		return item{kind: itemInt, i: v}, nil
+	case msgpackFloat32:
+		return item{kind: itemFloat, f: float64(math.Float32frombits(uint32(arg)))}, nil
+	case msgpackFloat64:
+		return item{kind: itemFloat, f: math.Float64frombits(arg)}, nil
+	case msgpackBin8, msgpackBin16, msgpackBin32:
+		return readMsgpackData(r, itemBytes, arg)
+	case msgpackStr8, msgpackStr16, msgpackStr32:
+		return readMsgpackData(r, itemString, arg)
+	case msgpackArray16, msgpackArray32:
+		return readMsgpackContainer(r, itemArray, arg)
+	}
+	return readMsgpackContainer(r, itemMap, arg)
+}
+
+// readMsgpackData reads the l bytes of a string or binary item.
+func readMsgpackData(r *sliceReader, kind itemKind, l uint64) (item, error) {
+	n, err := readItemLength(r, l, FormatMsgPack)
+	if err != nil {
+		return item{}, err
+	}
+	data, _ := r.Slice(n)
+	return item{kind: kind, data: data}, nil
+}
+
+// readMsgpackContainer checks the size of an array or map against the bytes
+// left in r.
+func readMsgpackContainer(r *sliceReader, kind itemKind, l uint64) (item, error) {
+	if kind == itemMap {
+		l *= 2
+	}
+	n, err := readItemLength(r, l, FormatMsgPack)
+	if kind == itemMap {
+		n /= 2
+	}
+	return item{kind: kind, n: n}, err
+}
@@ -0,0 +1,114 @@
+package binary
+
+import (
+	"bytes"
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestMsgPackVectors(t *testing.T) {
+	c := New(WithFormat(FormatMsgPack))
+
+	ints := []struct {
+		v    int64
+		want []byte
+	}{
+		{0, []byte{0x00}},
+		{127, []byte{0x7f}},
+		{128, []byte{0xcc, 0x80}},
+		{256, []byte{0xcd, 0x01, 0x00}},
+		{65536, []byte{0xce, 0x00, 0x01, 0x00, 0x00}},
+		{1 << 32, []byte{0xcf, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x00}},
+		{-1, []byte{0xff}},
+		{-32, []byte{0xe0}},
+		{-33, []byte{0xd0, 0xdf}},
+		{-129, []byte{0xd1, 0xff, 0x7f}},
+		{-32769, []byte{0xd2, 0xff, 0xff, 0x7f, 0xff}},
+		{math.MinInt64, []byte{0xd3, 0x80, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00}},
+	}
+	for _, tt := range ints {
+		got, err := formatEncode(c, &tt.v)
+		assertNoError(t, err)
+		assertEqualBytes(t, tt.want, got)
+
+		var back int64
+		assertNoError(t, c.Decode(got, &back))
+		assertEqual(t, tt.v, back)
+	}
+
+	s := strings.Repeat("a", 31)
+	got, err := formatEncode(c, &s)
+	assertNoError(t, err)
+	assertEqualBytes(t, append([]byte{0xbf}, s...), got)
+
+	s = strings.Repeat("a", 32)
+	got, err = formatEncode(c, &s)
+	assertNoError(t, err)
+	assertEqualBytes(t, append([]byte{0xd9, 0x20}, s...), got)
+
+	list := make([]bool, 16)
+	got, err = formatEncode(c, &list)
+	assertNoError(t, err)
+	assertEqualBytes(t, append([]byte{0xdc, 0x00, 0x10}, bytes.Repeat([]byte{0xc2}, 16)...), got)
+
+	f := float32(1.5)
+	got, err = formatEncode(c, &f)
+	assertNoError(t, err)
+	assertEqualBytes(t, []byte{0xca, 0x3f, 0xc0, 0x00, 0x00}, got)
+
+	got, err = formatEncode(c, &itemPoint{X: -1, Y: 9, Z: 500})
+	assertNoError(t, err)
+	assertEqualBytes(t, []byte{0x82, 0xa1, 'x', 0xff, 0xa1, 'Z', 0xcd, 0x01, 0xf4}, got)
+
+	got, err = formatEncode(c, &itemRecord{Raw: []byte{1, 2}})
+	assertNoError(t, err)
+	if !strings.Contains(string(got), "\xa3raw\xc4\x02\x01\x02") {
+		t.Fatalf("raw bytes not encoded as bin 8: % x", got)
+	}
+	if !strings.Contains(string(got), "\xa6parent\xc0") {
+		t.Fatalf("nil pointer not encoded as nil: % x", got)
+	}
+}
+
+func TestMsgPackDecodeCompat(t *testing.T) {
+	c := New(WithFormat(FormatMsgPack))
+
+	// Wider integer formats than needed, and a signed format holding a
+	// positive value, are accepted.
+	var p itemPoint
+	data := []byte{0x82, 0xa1, 'x', 0xd3, 0, 0, 0, 0, 0, 0, 0, 7, 0xa1, 'Z', 0xd1, 0x00, 0x10}
+	assertNoError(t, c.Decode(data, &p))
+	assertEqual(t, 7, p.X)
+	assertEqual(t, uint16(16), p.Z)
+
+	// Binary data sent as a string.
+	var r itemRecord
+	data = []byte{0x81, 0xa3, 'r', 'a', 'w', 0xa2, 'h', 'i'}
+	assertNoError(t, c.Decode(data, &r))
+	assertEqualBytes(t, []byte("hi"), r.Raw)
+
+	// Unknown keys with nested maps are skipped.
+	data = []byte{0x82, 0xa1, 'q', 0x81, 0x01, 0x92, 0x01, 0x02, 0xa1, 'x', 0x05}
+	p = itemPoint{}
+	assertNoError(t, c.Decode(data, &p))
+	assertEqual(t, 5, p.X)
+}
+
+func TestMsgPackErrors(t *testing.T) {
+	c := New(WithFormat(FormatMsgPack))
+	var p itemPoint
+	for _, data := range [][]byte{
+		{0x81, 0xa1, 'Z', 0xff},                         // negative into uint
+		{0x81, 0xa1, 'Z', 0xce, 0x00, 0x01, 0x00, 0x00}, // 65536 overflows uint16
+		{0x81, 0xa1, 'x', 0xd4, 0x01, 0x00},             // fixext is not supported
+		{0x81, 0xa1, 'x'},                               // missing value
+		{0xdf, 0xff, 0xff, 0xff, 0xff},                  // map larger than the input
+		{0xdb, 0x00, 0x00, 0x00, 0x05, 'a'},             // string larger than the input
+		{0x80, 0x00},                                    // trailing bytes
+	} {
+		if err := c.Decode(data, &p); err == nil {
+			t.Fatalf("Decode(% x): expected error", data)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package binary
+
+// Option configures a Codec created with New.
+type Option func(*instance)
+
+// WithFingerprint prefixes every encoded value with the 64-bit fingerprint of
+// its schema and makes Decode reject payloads whose fingerprint differs from
+// the target type's with a *SchemaMismatchError. Field names are only part of
+// the fingerprint when includeNames is true.
+func WithFingerprint(includeNames bool) Option {
+	return func(tb *instance) {
+		tb.fingerprint = true
+		tb.fingerprintNames = includeNames
+	}
+}
+
+// WithCompression prefixes every encoded value with a one-byte flag and
+// DEFLATE-compresses values whose encoding reaches threshold bytes; smaller
+// ones are written raw after the flag. Decode reads the flag and inflates
+// within the WithMaxSize limit, so both sides must use this option.
+func WithCompression(threshold int) Option {
+	return func(tb *instance) {
+		tb.compress = true
+		tb.compressAt = threshold
+	}
+}
+
+// WithMaxSize bounds the size of a body Decode accepts: larger []byte inputs,
+// and compressed payloads that inflate past n bytes, fail with ErrTooLarge.
+// With compression enabled it defaults to DefaultMaxSize.
+func WithMaxSize(n int) Option {
+	return func(tb *instance) {
+		tb.maxSize = n
+	}
+}
+
+// WithCanonical makes the encoding of a value deterministic by writing map
+// entries sorted by their encoded key instead of in Go's random map order.
+// Equal values then always encode to the same bytes, e.g. for hashing or
+// signing; Sign always encodes canonically.
+func WithCanonical() Option {
+	return func(tb *instance) {
+		tb.canonical = true
+	}
+}
+
+// WithChecksum makes WriteFrame add a CRC32C of the body to every frame, so
+// ReadFrame detects corrupted frames with ErrChecksum.
+func WithChecksum() Option {
+	return func(tb *instance) {
+		tb.checksum = true
+	}
+}
+
+// newWithOptions is New for callers that only accept Option values.
+func newWithOptions(opts []Option) *Codec {
+	args := make([]any, len(opts))
+	for i, o := range opts {
+		args[i] = o
+	}
+	return New(args...)
+}
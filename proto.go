@@ -0,0 +1,540 @@
+package binary
+
+import (
+	"bytes"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+
+	. "github.com/tinywasm/fmt"
+)
+
+// Protobuf wire types.
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+// Per-field integer encodings selected by binary tag options.
+const (
+	protoVarint uint8 = iota
+	protoZigzag
+	protoFixed32
+	protoFixed64
+)
+
+// protoField is a struct field with its protobuf field number.
+type protoField struct {
+	num   uint64
+	index int
+	name  string
+	enc   uint8 // protoVarint, protoZigzag, protoFixed32 or protoFixed64
+}
+
+// protoMessage is the protobuf layout of a struct type.
+type protoMessage struct {
+	fields []protoField
+}
+
+type protoEntry struct {
+	t   reflect.Type
+	msg *protoMessage
+	err error
+}
+
+// protoMessageOf returns the cached protobuf layout of struct type t.
+func (tb *instance) protoMessageOf(t reflect.Type) (*protoMessage, error) {
+	tb.mu.RLock()
+	for _, e := range tb.protoMessages {
+		if e.t == t {
+			tb.mu.RUnlock()
+			return e.msg, e.err
+		}
+	}
+	tb.mu.RUnlock()
+
+	msg, err := scanProtoMessage(t)
+	tb.mu.Lock()
+	tb.protoMessages = append(tb.protoMessages, protoEntry{t, msg, err})
+	tb.mu.Unlock()
+	return msg, err
+}
+
+// scanProtoMessage reads the field numbers and options of the encoded
+// fields of t from their binary tags.
+func scanProtoMessage(t reflect.Type) (*protoMessage, error) {
+	msg := &protoMessage{}
+	for _, i := range scanStruct(t).fields {
+		field := t.Field(i)
+		tag, _ := Convert(string(field.Tag)).TagValue("binary")
+		opts := Convert(tag).Split(",")
+		num, err := strconv.ParseUint(opts[0], 10, 32)
+		if err != nil || num == 0 || num > 1<<29-1 {
+			return nil, Err("protobuf:", t.String()+"."+field.Name, "needs a field number tag, e.g. `binary:\"1\"`")
+		}
+		f := protoField{num: num, index: i, name: field.Name}
+		for _, opt := range opts[1:] {
+			switch opt {
+			case "sint":
+				f.enc = protoZigzag
+			case "fixed32":
+				f.enc = protoFixed32
+			case "fixed64":
+				f.enc = protoFixed64
+			default:
+				return nil, Err("protobuf:", t.String()+"."+field.Name, "option", opt, D.Not, D.Supported)
+			}
+		}
+		for _, other := range msg.fields {
+			if other.num == num {
+				return nil, Err("protobuf:", t.String()+"."+field.Name, "field number", opts[0], "already used by", other.name)
+			}
+		}
+		msg.fields = append(msg.fields, f)
+	}
+	return msg, nil
+}
+
+// ------------------------------------------------------------------------------
+
+// encodeProto encodes the struct rv as a protobuf message.
+func (tb *instance) encodeProto(rv reflect.Value) ([]byte, error) {
+	if rv.Kind() != reflect.Struct {
+		return nil, Err("protobuf:", rv.Type().String(), "is not a struct")
+	}
+	return tb.appendProtoMessage(nil, rv)
+}
+
+func (tb *instance) appendProtoMessage(b []byte, rv reflect.Value) ([]byte, error) {
+	msg, err := tb.protoMessageOf(rv.Type())
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range msg.fields {
+		if b, err = tb.appendProtoField(b, f, rv.Field(f.index)); err != nil {
+			return nil, err
+		}
+	}
+	return b, nil
+}
+
+func (tb *instance) appendProtoField(b []byte, f protoField, fv reflect.Value) ([]byte, error) {
+	switch fv.Kind() {
+	case reflect.Ptr:
+		if fv.IsNil() {
+			return b, nil
+		}
+		// A set pointer is written even when it points to a zero value.
+		return tb.appendProtoValue(b, f, fv.Elem())
+	case reflect.Slice:
+		if fv.Type().Elem().Kind() == reflect.Uint8 {
+			break
+		}
+		if fv.Len() == 0 {
+			return b, nil
+		}
+		if isProtoPackable(fv.Type().Elem()) {
+			var packed []byte
+			var err error
+			for i := 0; i < fv.Len(); i++ {
+				if packed, _, err = appendProtoScalar(packed, f.enc, fv.Index(i)); err != nil {
+					return nil, err
+				}
+			}
+			b = appendProtoKey(b, f.num, wireBytes)
+			b = appendUvarint(b, uint64(len(packed)))
+			return append(b, packed...), nil
+		}
+		var err error
+		for i := 0; i < fv.Len(); i++ {
+			if b, err = tb.appendProtoValue(b, f, fv.Index(i)); err != nil {
+				return nil, err
+			}
+		}
+		return b, nil
+	case reflect.Map:
+		// Entries are sorted by their encoding so equal maps encode equally.
+		entries := make([][]byte, 0, fv.Len())
+		iter := fv.MapRange()
+		for iter.Next() {
+			entry, err := tb.appendProtoValue(nil, protoField{num: 1, enc: f.enc}, iter.Key())
+			if err != nil {
+				return nil, err
+			}
+			if entry, err = tb.appendProtoValue(entry, protoField{num: 2, enc: f.enc}, iter.Value()); err != nil {
+				return nil, err
+			}
+			entries = append(entries, entry)
+		}
+		sort.Slice(entries, func(i, j int) bool { return bytes.Compare(entries[i], entries[j]) < 0 })
+		for _, entry := range entries {
+			b = appendProtoKey(b, f.num, wireBytes)
+			b = appendUvarint(b, uint64(len(entry)))
+			b = append(b, entry...)
+		}
+		return b, nil
+	}
+	if fv.IsZero() {
+		return b, nil
+	}
+	return tb.appendProtoValue(b, f, fv)
+}
+
+// appendProtoValue writes one occurrence of field f holding v.
+func (tb *instance) appendProtoValue(b []byte, f protoField, v reflect.Value) ([]byte, error) {
+	switch {
+	case v.Kind() == reflect.Ptr:
+		if v.IsNil() {
+			return nil, Err("protobuf:", "nil element in", f.name)
+		}
+		return tb.appendProtoValue(b, f, v.Elem())
+	case v.Kind() == reflect.Struct:
+		sub, err := tb.appendProtoMessage(nil, v)
+		if err != nil {
+			return nil, err
+		}
+		b = appendProtoKey(b, f.num, wireBytes)
+		b = appendUvarint(b, uint64(len(sub)))
+		return append(b, sub...), nil
+	case v.Kind() == reflect.String:
+		b = appendProtoKey(b, f.num, wireBytes)
+		b = appendUvarint(b, uint64(v.Len()))
+		return append(b, v.String()...), nil
+	case v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8:
+		b = appendProtoKey(b, f.num, wireBytes)
+		b = appendUvarint(b, uint64(v.Len()))
+		return append(b, v.Bytes()...), nil
+	}
+
+	scalar, wire, err := appendProtoScalar(nil, f.enc, v)
+	if err != nil {
+		return nil, err
+	}
+	b = appendProtoKey(b, f.num, wire)
+	return append(b, scalar...), nil
+}
+
+// isProtoPackable reports whether repeated values of t are written packed.
+func isProtoPackable(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+// appendProtoScalar writes a number or bool without its key and returns the
+// wire type it used.
+func appendProtoScalar(b []byte, enc uint8, v reflect.Value) ([]byte, int, error) {
+	switch v.Kind() {
+	case reflect.Bool:
+		if v.Bool() {
+			return append(b, 1), wireVarint, nil
+		}
+		return append(b, 0), wireVarint, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		x := v.Int()
+		switch enc {
+		case protoZigzag:
+			return appendUvarint(b, uint64(x<<1)^uint64(x>>63)), wireVarint, nil
+		case protoFixed32:
+			return appendLittleEndian(b, uint64(x), 4), wireFixed32, nil
+		case protoFixed64:
+			return appendLittleEndian(b, uint64(x), 8), wireFixed64, nil
+		}
+		// Negative ints are sign-extended to 64 bits, as protobuf does.
+		return appendUvarint(b, uint64(x)), wireVarint, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		x := v.Uint()
+		switch enc {
+		case protoFixed32:
+			return appendLittleEndian(b, x, 4), wireFixed32, nil
+		case protoFixed64:
+			return appendLittleEndian(b, x, 8), wireFixed64, nil
+		}
+		return appendUvarint(b, x), wireVarint, nil
+	case reflect.Float32:
+		return appendLittleEndian(b, uint64(math.Float32bits(float32(v.Float()))), 4), wireFixed32, nil
+	case reflect.Float64:
+		return appendLittleEndian(b, math.Float64bits(v.Float()), 8), wireFixed64, nil
+	}
+	return nil, 0, Err("protobuf:", v.Type().String(), D.Type, D.Not, D.Supported)
+}
+
+func appendProtoKey(b []byte, num uint64, wire int) []byte {
+	return appendUvarint(b, num<<3|uint64(wire))
+}
+
+func appendUvarint(b []byte, x uint64) []byte {
+	for x >= 0x80 {
+		b = append(b, byte(x)|0x80)
+		x >>= 7
+	}
+	return append(b, byte(x))
+}
+
+func appendLittleEndian(b []byte, v uint64, n int) []byte {
+	for i := 0; i < n; i++ {
+		b = append(b, byte(v>>(8*i)))
+	}
+	return b
+}
+
+// ------------------------------------------------------------------------------
+
+var errProtoTruncated = Err("protobuf:", "truncated message")
+
+// decodeProto decodes a protobuf message into the struct rv.
+func (tb *instance) decodeProto(data []byte, rv reflect.Value) error {
+	if rv.Kind() != reflect.Struct {
+		return Err("protobuf:", rv.Type().String(), "is not a struct")
+	}
+	return tb.decodeProtoMessage(newSliceReader(data), rv, 0)
+}
+
+// decodeProtoMessage merges the fields read from r into the struct rv. depth
+// guards against deeply nested input.
+func (tb *instance) decodeProtoMessage(r *sliceReader, rv reflect.Value, depth int) error {
+	if depth > 100 {
+		return Err("protobuf:", "message nested too deeply")
+	}
+	msg, err := tb.protoMessageOf(rv.Type())
+	if err != nil {
+		return err
+	}
+	for r.Len() > 0 {
+		key, err := r.ReadUvarint()
+		if err != nil {
+			return errProtoTruncated
+		}
+		num, wire := key>>3, int(key&7)
+		var f *protoField
+		for i := range msg.fields {
+			if msg.fields[i].num == num {
+				f = &msg.fields[i]
+				break
+			}
+		}
+		if f == nil {
+			if err := skipProtoField(r, wire); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := tb.decodeProtoField(r, wire, f, rv.Field(f.index), depth); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (tb *instance) decodeProtoField(r *sliceReader, wire int, f *protoField, fv reflect.Value, depth int) error {
+	switch fv.Kind() {
+	case reflect.Slice:
+		if fv.Type().Elem().Kind() == reflect.Uint8 {
+			break
+		}
+		elemType := fv.Type().Elem()
+		if wire == wireBytes && isProtoPackable(elemType) {
+			packed, err := readProtoBytes(r)
+			if err != nil {
+				return err
+			}
+			pr := newSliceReader(packed)
+			elemWire := protoScalarWire(elemType.Kind(), f.enc)
+			for pr.Len() > 0 {
+				elem := reflect.New(elemType).Elem()
+				if err := readProtoScalar(pr, elemWire, f.enc, elem); err != nil {
+					return err
+				}
+				fv.Set(reflect.Append(fv, elem))
+			}
+			return nil
+		}
+		elem := reflect.New(elemType).Elem()
+		if err := tb.decodeProtoValue(r, wire, f, elem, depth); err != nil {
+			return err
+		}
+		fv.Set(reflect.Append(fv, elem))
+		return nil
+	case reflect.Map:
+		if wire != wireBytes {
+			return protoWireError(f, wire)
+		}
+		entry, err := readProtoBytes(r)
+		if err != nil {
+			return err
+		}
+		if fv.IsNil() {
+			fv.Set(reflect.MakeMap(fv.Type()))
+		}
+		key := reflect.New(fv.Type().Key()).Elem()
+		val := reflect.New(fv.Type().Elem()).Elem()
+		er := newSliceReader(entry)
+		for er.Len() > 0 {
+			k, err := er.ReadUvarint()
+			if err != nil {
+				return errProtoTruncated
+			}
+			sub := protoField{num: k >> 3, name: f.name, enc: f.enc}
+			switch sub.num {
+			case 1:
+				err = tb.decodeProtoValue(er, int(k&7), &sub, key, depth)
+			case 2:
+				err = tb.decodeProtoValue(er, int(k&7), &sub, val, depth)
+			default:
+				err = skipProtoField(er, int(k&7))
+			}
+			if err != nil {
+				return err
+			}
+		}
+		fv.SetMapIndex(key, val)
+		return nil
+	}
+	return tb.decodeProtoValue(r, wire, f, fv, depth)
+}
+
+// decodeProtoValue reads one occurrence of field f into v.
+func (tb *instance) decodeProtoValue(r *sliceReader, wire int, f *protoField, v reflect.Value, depth int) error {
+	switch {
+	case v.Kind() == reflect.Ptr:
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return tb.decodeProtoValue(r, wire, f, v.Elem(), depth)
+	case v.Kind() == reflect.Struct:
+		if wire != wireBytes {
+			return protoWireError(f, wire)
+		}
+		sub, err := readProtoBytes(r)
+		if err != nil {
+			return err
+		}
+		return tb.decodeProtoMessage(newSliceReader(sub), v, depth+1)
+	case v.Kind() == reflect.String:
+		if wire != wireBytes {
+			return protoWireError(f, wire)
+		}
+		b, err := readProtoBytes(r)
+		if err == nil {
+			v.SetString(string(b))
+		}
+		return err
+	case v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8:
+		if wire != wireBytes {
+			return protoWireError(f, wire)
+		}
+		b, err := readProtoBytes(r)
+		if err == nil {
+			v.SetBytes(append([]byte(nil), b...))
+		}
+		return err
+	}
+	if wire != protoScalarWire(v.Kind(), f.enc) {
+		return protoWireError(f, wire)
+	}
+	return readProtoScalar(r, wire, f.enc, v)
+}
+
+// protoScalarWire returns the wire type of a number or bool of kind k.
+func protoScalarWire(k reflect.Kind, enc uint8) int {
+	switch {
+	case k == reflect.Float32:
+		return wireFixed32
+	case k == reflect.Float64:
+		return wireFixed64
+	case k == reflect.Bool:
+		return wireVarint
+	case enc == protoFixed32:
+		return wireFixed32
+	case enc == protoFixed64:
+		return wireFixed64
+	}
+	return wireVarint
+}
+
+func readProtoScalar(r *sliceReader, wire int, enc uint8, v reflect.Value) error {
+	var x uint64
+	var err error
+	switch wire {
+	case wireVarint:
+		x, err = r.ReadUvarint()
+	case wireFixed32, wireFixed64:
+		n := 4
+		if wire == wireFixed64 {
+			n = 8
+		}
+		var b []byte
+		if b, err = r.Slice(n); err == nil {
+			for i := n - 1; i >= 0; i-- {
+				x = x<<8 | uint64(b[i])
+			}
+		}
+	}
+	if err != nil {
+		return errProtoTruncated
+	}
+
+	switch v.Kind() {
+	case reflect.Bool:
+		v.SetBool(x != 0)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		switch {
+		case enc == protoZigzag:
+			v.SetInt(int64(x>>1) ^ -int64(x&1))
+		case wire == wireFixed32:
+			v.SetInt(int64(int32(x)))
+		default:
+			v.SetInt(int64(x))
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		v.SetUint(x)
+	case reflect.Float32:
+		v.SetFloat(float64(math.Float32frombits(uint32(x))))
+	case reflect.Float64:
+		v.SetFloat(math.Float64frombits(x))
+	default:
+		return Err("protobuf:", v.Type().String(), D.Type, D.Not, D.Supported)
+	}
+	return nil
+}
+
+// readProtoBytes reads a length-delimited value without copying it.
+func readProtoBytes(r *sliceReader) ([]byte, error) {
+	l, err := r.ReadUvarint()
+	if err != nil || l > uint64(r.Len()) {
+		return nil, errProtoTruncated
+	}
+	return r.Slice(int(l))
+}
+
+// skipProtoField skips the value of an unknown field.
+func skipProtoField(r *sliceReader, wire int) error {
+	var err error
+	switch wire {
+	case wireVarint:
+		_, err = r.ReadUvarint()
+	case wireFixed64:
+		_, err = r.Slice(8)
+	case wireBytes:
+		_, err = readProtoBytes(r)
+	case wireFixed32:
+		_, err = r.Slice(4)
+	default:
+		return Err("protobuf:", "wire type", Convert(wire).String(), D.Not, D.Supported)
+	}
+	if err != nil {
+		return errProtoTruncated
+	}
+	return nil
+}
+
+func protoWireError(f *protoField, wire int) error {
+	return Err("protobuf:", f.name, "unexpected wire type", Convert(wire).String())
+}
@@ -0,0 +1,198 @@
+package binary
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+type protoScalars struct {
+	A int32  `binary:"1"`
+	B string `binary:"2"`
+	C int64  `binary:"3,sint"`
+	D []int  `binary:"4"`
+}
+
+type protoInner struct {
+	Name string `binary:"1"`
+}
+
+type protoOuter struct {
+	ID      uint64            `binary:"1"`
+	Inner   protoInner        `binary:"2"`
+	Items   []protoInner      `binary:"3"`
+	Tags    map[string]int32  `binary:"4"`
+	Hash    uint32            `binary:"5,fixed32"`
+	Offset  int64             `binary:"6,fixed64"`
+	Ratio   float64           `binary:"7"`
+	Score   float32           `binary:"8"`
+	Raw     []byte            `binary:"9"`
+	Enabled *bool             `binary:"10"`
+	Names   []string          `binary:"11"`
+	Skip    string            `binary:"-"`
+	Deltas  map[int32]float64 `binary:"12,sint"`
+}
+
+func protoCodec() *Codec {
+	return New(WithFormat(FormatProtobuf))
+}
+
+func protoEncode(c *Codec, v any) ([]byte, error) {
+	var data []byte
+	err := c.Encode(v, &data)
+	return data, err
+}
+
+func TestProtoVectors(t *testing.T) {
+	c := protoCodec()
+	tests := []struct {
+		in   any
+		want []byte
+	}{
+		{&protoScalars{A: 150}, []byte{0x08, 0x96, 0x01}},
+		{&protoScalars{B: "testing"}, []byte{0x12, 0x07, 't', 'e', 's', 't', 'i', 'n', 'g'}},
+		{&protoScalars{C: -1}, []byte{0x18, 0x01}},
+		{&protoScalars{C: 1}, []byte{0x18, 0x02}},
+		{&protoScalars{D: []int{3, 270, 86942}}, []byte{0x22, 0x06, 0x03, 0x8e, 0x02, 0x9e, 0xa7, 0x05}},
+		// int32 -1 is sign-extended to a 10-byte varint.
+		{&protoScalars{A: -1}, []byte{0x08, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x01}},
+		{&protoScalars{}, nil},
+		{&protoOuter{Inner: protoInner{Name: "a"}}, []byte{0x12, 0x03, 0x0a, 0x01, 'a'}},
+		{&protoOuter{Hash: 1}, []byte{0x2d, 0x01, 0x00, 0x00, 0x00}},
+		{&protoOuter{Offset: -2}, []byte{0x31, 0xfe, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}},
+		{&protoOuter{Score: 1}, []byte{0x45, 0x00, 0x00, 0x80, 0x3f}},
+		{&protoOuter{Tags: map[string]int32{"k": 2}}, []byte{0x22, 0x05, 0x0a, 0x01, 'k', 0x10, 0x02}},
+	}
+	for _, tt := range tests {
+		got, err := protoEncode(c, tt.in)
+		assertNoError(t, err)
+		assertEqualBytes(t, tt.want, got)
+	}
+}
+
+func TestProtoRoundTrip(t *testing.T) {
+	c := protoCodec()
+	enabled := false
+	in := protoOuter{
+		ID:      1 << 40,
+		Inner:   protoInner{Name: "inner"},
+		Items:   []protoInner{{Name: "x"}, {}, {Name: "z"}},
+		Tags:    map[string]int32{"a": -5, "b": 7},
+		Hash:    0xdeadbeef,
+		Offset:  -123456789,
+		Ratio:   3.5,
+		Score:   -0.25,
+		Raw:     []byte{0, 1, 2},
+		Enabled: &enabled,
+		Names:   []string{"", "n"},
+		Skip:    "not encoded",
+		Deltas:  map[int32]float64{-3: 1.5, 4: -2},
+	}
+	data, err := protoEncode(c, &in)
+	assertNoError(t, err)
+
+	var out protoOuter
+	assertNoError(t, c.Decode(data, &out))
+	in.Skip = ""
+	if !reflect.DeepEqual(in, out) {
+		t.Fatalf("round trip mismatch:\n in: %+v\nout: %+v", in, out)
+	}
+
+	// Map entries are sorted, so encoding is deterministic.
+	again, err := protoEncode(c, &out)
+	assertNoError(t, err)
+	assertEqualBytes(t, data, again)
+}
+
+func TestProtoPresence(t *testing.T) {
+	c := protoCodec()
+
+	data, err := protoEncode(c, &protoOuter{})
+	assertNoError(t, err)
+	assertEqual(t, 0, len(data))
+
+	// A set pointer to a zero value is written.
+	off := false
+	data, err = protoEncode(c, &protoOuter{Enabled: &off})
+	assertNoError(t, err)
+	assertEqualBytes(t, []byte{0x50, 0x00}, data)
+
+	var out protoOuter
+	assertNoError(t, c.Decode(data, &out))
+	if out.Enabled == nil || *out.Enabled {
+		t.Fatalf("Enabled = %v, want pointer to false", out.Enabled)
+	}
+}
+
+func TestProtoDecodeCompat(t *testing.T) {
+	c := protoCodec()
+
+	// Unpacked repeated ints, an unknown varint (field 15), an unknown
+	// length-delimited field (16) and an unknown fixed32 (17) are accepted.
+	data := []byte{
+		0x20, 0x03, 0x20, 0x8e, 0x02,
+		0x78, 0x05,
+		0x82, 0x01, 0x02, 'h', 'i',
+		0x8d, 0x01, 0x01, 0x02, 0x03, 0x04,
+		0x08, 0x2a,
+	}
+	var out protoScalars
+	assertNoError(t, c.Decode(data, &out))
+	assertEqual(t, int32(42), out.A)
+	if !reflect.DeepEqual(out.D, []int{3, 270}) {
+		t.Fatalf("D = %v, want [3 270]", out.D)
+	}
+
+	// Repeated occurrences of a message merge.
+	data = []byte{0x12, 0x03, 0x0a, 0x01, 'a', 0x08, 0x07}
+	var outer protoOuter
+	assertNoError(t, c.Decode(data, &outer))
+	assertEqual(t, "a", outer.Inner.Name)
+	assertEqual(t, uint64(7), outer.ID)
+}
+
+func TestProtoErrors(t *testing.T) {
+	c := protoCodec()
+
+	type noNumber struct {
+		A int
+	}
+	if _, err := protoEncode(c, &noNumber{A: 1}); err == nil {
+		t.Fatal("expected error for field without a number")
+	}
+
+	type dup struct {
+		A int `binary:"1"`
+		B int `binary:"1"`
+	}
+	if _, err := protoEncode(c, &dup{}); err == nil {
+		t.Fatal("expected error for duplicate field number")
+	}
+
+	var out protoScalars
+	for _, data := range [][]byte{
+		{0x08},                   // missing varint
+		{0x12, 0x05, 'a'},        // string longer than the message
+		{0x0d, 0x01, 0x02},       // fixed32 wire type for a varint field
+		{0x12, 0x01, 'a', 0x0b},  // wire type 3 is not supported
+		{0x08 | wireBytes, 0x00}, // string wire type for an int field
+	} {
+		if err := c.Decode(data, &out); err == nil {
+			t.Fatalf("Decode(% x): expected error", data)
+		}
+	}
+}
+
+func TestProtoStream(t *testing.T) {
+	c := protoCodec()
+	in := protoScalars{A: 1, B: "b", C: -2, D: []int{1, 2}}
+
+	var buf bytes.Buffer
+	assertNoError(t, c.Encode(&in, &buf))
+
+	var out protoScalars
+	assertNoError(t, c.Decode(&buf, &out))
+	if !reflect.DeepEqual(in, out) {
+		t.Fatalf("got %+v, want %+v", out, in)
+	}
+}
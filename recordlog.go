@@ -0,0 +1,543 @@
+package binary
+
+import (
+	"bytes"
+	"hash/crc32"
+	"io"
+	"os"
+
+	. "github.com/tinywasm/fmt"
+)
+
+// RecordLog file layout:
+//
+//	header:  "TWRL" | format version (1 byte)
+//	entries: kind (1 byte) | uvarint len(payload) | CRC32C(kind, payload), 4 bytes LE | payload
+//	trailer: footer offset, 8 bytes LE | "TWRL"    (only after Close)
+//
+// Record entries hold an encoded value. Every recordIndexInterval records an
+// index entry lists their offsets and links to the previous index entry. Close
+// writes a final index, a footer entry with the record count and the offset
+// of the last index, and the trailer, so reopening a cleanly closed log reads
+// only the index chain. Otherwise the log is scanned and truncated after the
+// last intact entry.
+const (
+	recordLogMagic      = "TWRL"
+	recordLogVersion    = 1
+	recordLogHeaderSize = len(recordLogMagic) + 1
+	recordTrailerSize   = 8 + len(recordLogMagic)
+	recordIndexInterval = 64
+
+	entryRecord byte = 1
+	entryIndex  byte = 2
+	entryFooter byte = 3
+)
+
+// RecordLog is an append-only file of encoded records with random access by
+// position. It is not safe for concurrent use.
+type RecordLog struct {
+	codec     *Codec
+	path      string
+	file      *os.File
+	size      int64   // end of the last entry
+	offsets   []int64 // entry offset of every record
+	indexed   int     // records covered by index entries
+	lastIndex int64   // offset of the last index entry, -1 if none
+}
+
+// OpenRecordLog opens the log at path, creating it if needed. Records are
+// encoded and decoded with a codec configured by opts. A log that was not
+// closed cleanly is recovered by dropping a torn tail; a corrupt entry in the
+// middle of the log is an error.
+func OpenRecordLog(path string, opts ...Option) (*RecordLog, error) {
+	return openRecordLog(path, newWithOptions(opts))
+}
+
+func openRecordLog(path string, codec *Codec) (*RecordLog, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	l := &RecordLog{codec: codec, path: path, file: f, lastIndex: -1}
+	if err = l.load(); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return l, nil
+}
+
+// Len returns the number of records.
+func (l *RecordLog) Len() int {
+	return len(l.offsets)
+}
+
+// Append encodes v as a new record and returns its position.
+func (l *RecordLog) Append(v any) (int, error) {
+	var body bytes.Buffer
+	if err := l.codec.tb.encodeTo(v, &body); err != nil {
+		return 0, err
+	}
+	return l.appendRecord(body.Bytes())
+}
+
+// appendRecord writes an encoded record, and an index entry when due.
+func (l *RecordLog) appendRecord(data []byte) (int, error) {
+	at, err := l.writeEntry(entryRecord, data)
+	if err != nil {
+		return 0, err
+	}
+	l.offsets = append(l.offsets, at)
+	if len(l.offsets)-l.indexed >= recordIndexInterval {
+		if err := l.writeIndex(); err != nil {
+			return 0, err
+		}
+	}
+	return len(l.offsets) - 1, nil
+}
+
+// Get decodes record i into v.
+func (l *RecordLog) Get(i int, v any) error {
+	data, err := l.record(i)
+	if err != nil {
+		return err
+	}
+	return l.codec.tb.decode(data, v)
+}
+
+// Sync commits the log to stable storage.
+func (l *RecordLog) Sync() error {
+	return l.file.Sync()
+}
+
+// Close indexes the remaining records, writes the footer and closes the file.
+func (l *RecordLog) Close() error {
+	err := l.writeFooter()
+	if err == nil {
+		err = l.file.Sync()
+	}
+	if cerr := l.file.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// Record is a stored record returned by iterators.
+type Record struct {
+	Index int    // position in the log
+	Data  []byte // encoded value, only valid until the iterator moves on
+	codec *Codec
+}
+
+// Decode decodes the record into v.
+func (r Record) Decode(v any) error {
+	return r.codec.tb.decode(r.Data, v)
+}
+
+// RecordIter walks the records of a log:
+//
+//	for it := log.Iter(); it.Next(); {
+//		it.Record().Decode(&ev)
+//	}
+//	err := it.Err()
+type RecordIter struct {
+	log  *RecordLog
+	next int
+	step int
+	rec  Record
+	err  error
+}
+
+// Iter returns an iterator over the records from first to last.
+func (l *RecordLog) Iter() *RecordIter {
+	return &RecordIter{log: l, next: 0, step: 1}
+}
+
+// Reverse returns an iterator over the records from last to first.
+func (l *RecordLog) Reverse() *RecordIter {
+	return &RecordIter{log: l, next: len(l.offsets) - 1, step: -1}
+}
+
+// Next reads the next record and reports whether there is one.
+func (it *RecordIter) Next() bool {
+	if it.err != nil || it.next < 0 || it.next >= len(it.log.offsets) {
+		return false
+	}
+	data, err := it.log.record(it.next)
+	if err != nil {
+		it.err = err
+		return false
+	}
+	it.rec = Record{Index: it.next, Data: data, codec: it.log.codec}
+	it.next += it.step
+	return true
+}
+
+// Record returns the record read by the last call to Next.
+func (it *RecordIter) Record() Record {
+	return it.rec
+}
+
+// Err returns the error that stopped the iteration, if any.
+func (it *RecordIter) Err() error {
+	return it.err
+}
+
+// Compact rewrites the log keeping only the records for which keep returns
+// true, in their original order, and renumbers them. The new file replaces
+// the old one atomically.
+func (l *RecordLog) Compact(keep func(Record) bool) error {
+	tmpPath := l.path + ".compact"
+	os.Remove(tmpPath)
+	tmp, err := openRecordLog(tmpPath, l.codec)
+	if err != nil {
+		return err
+	}
+
+	for it := l.Iter(); ; {
+		if !it.Next() {
+			err = it.Err()
+			break
+		}
+		if rec := it.Record(); keep(rec) {
+			if _, err = tmp.appendRecord(rec.Data); err != nil {
+				break
+			}
+		}
+	}
+	if err == nil {
+		err = tmp.Close()
+	} else {
+		tmp.file.Close()
+	}
+	if err == nil {
+		err = os.Rename(tmpPath, l.path)
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+
+	l.file.Close()
+	reopened, err := openRecordLog(l.path, l.codec)
+	if err != nil {
+		return err
+	}
+	*l = *reopened
+	return nil
+}
+
+// record reads and checks the entry of record i.
+func (l *RecordLog) record(i int) ([]byte, error) {
+	if i < 0 || i >= len(l.offsets) {
+		return nil, Err("RecordLog", "record", Convert(i).String(), D.Out, D.Of, D.Range)
+	}
+	kind, data, _, err := l.readEntry(l.offsets[i])
+	if err == nil && kind != entryRecord {
+		err = Err("RecordLog", "record", Convert(i).String(), D.Invalid)
+	}
+	return data, err
+}
+
+// entrySize returns the encoded size of an entry with n payload bytes.
+func entrySize(n int) int {
+	size := 1 + 4 + n
+	for x := uint64(n); ; x >>= 7 {
+		size++
+		if x < 0x80 {
+			return size
+		}
+	}
+}
+
+// writeEntry appends an entry and returns its offset. A failed write is
+// truncated away so the file never ends with a partial entry.
+func (l *RecordLog) writeEntry(kind byte, payload []byte) (int64, error) {
+	var buf bytes.Buffer
+	buf.Grow(entrySize(len(payload)))
+	buf.WriteByte(kind)
+	e := newEncoder(&buf)
+	e.writeUvarint(uint64(len(payload)))
+	e.writeUint32(entryChecksum(kind, payload))
+	buf.Write(payload)
+
+	at := l.size
+	if _, err := l.file.WriteAt(buf.Bytes(), at); err != nil {
+		l.file.Truncate(at)
+		return 0, err
+	}
+	l.size += int64(buf.Len())
+	return at, nil
+}
+
+func entryChecksum(kind byte, payload []byte) uint32 {
+	table := castagnoli()
+	return crc32.Update(crc32.Checksum([]byte{kind}, table), table, payload)
+}
+
+// readEntry reads and checks the entry at offset at. On ErrChecksum, end is
+// still the end of the entry.
+func (l *RecordLog) readEntry(at int64) (kind byte, payload []byte, end int64, err error) {
+	var head [1 + 10 + 4]byte
+	n, err := l.file.ReadAt(head[:], at)
+	if n == 0 {
+		return 0, nil, 0, unexpectedEOF(err)
+	}
+	r := newSliceReader(head[1:n])
+	size, err := r.ReadUvarint()
+	if err != nil {
+		return 0, nil, 0, unexpectedEOF(err)
+	}
+	if size > uint64(l.codec.tb.maxBody()) {
+		return 0, nil, 0, ErrTooLarge
+	}
+	sum, err := r.Slice(4)
+	if err != nil {
+		return 0, nil, 0, io.ErrUnexpectedEOF
+	}
+
+	start := at + 1 + r.offset
+	payload = make([]byte, size)
+	if _, err = l.file.ReadAt(payload, start); err != nil {
+		return 0, nil, 0, unexpectedEOF(err)
+	}
+	want := uint32(sum[0]) | uint32(sum[1])<<8 | uint32(sum[2])<<16 | uint32(sum[3])<<24
+	if entryChecksum(head[0], payload) != want {
+		return 0, nil, start + int64(size), ErrChecksum
+	}
+	return head[0], payload, start + int64(size), nil
+}
+
+// writeIndex writes an index entry for the records not indexed yet:
+// uvarint(previous index offset + 1) | uvarint count | uvarint offset deltas.
+func (l *RecordLog) writeIndex() error {
+	var buf bytes.Buffer
+	e := newEncoder(&buf)
+	e.writeUvarint(uint64(l.lastIndex + 1))
+	pending := l.offsets[l.indexed:]
+	e.writeUvarint(uint64(len(pending)))
+	prev := int64(0)
+	for _, off := range pending {
+		e.writeUvarint(uint64(off - prev))
+		prev = off
+	}
+	at, err := l.writeEntry(entryIndex, buf.Bytes())
+	if err != nil {
+		return err
+	}
+	l.lastIndex = at
+	l.indexed = len(l.offsets)
+	return nil
+}
+
+// writeFooter writes the final index, the footer and the trailer.
+func (l *RecordLog) writeFooter() error {
+	if l.indexed < len(l.offsets) {
+		if err := l.writeIndex(); err != nil {
+			return err
+		}
+	}
+	var buf bytes.Buffer
+	e := newEncoder(&buf)
+	e.writeUvarint(uint64(len(l.offsets)))
+	e.writeUvarint(uint64(l.lastIndex + 1))
+	at, err := l.writeEntry(entryFooter, buf.Bytes())
+	if err != nil {
+		return err
+	}
+
+	buf.Reset()
+	e.writeUint64(uint64(at))
+	buf.WriteString(recordLogMagic)
+	if _, err := l.file.WriteAt(buf.Bytes(), l.size); err != nil {
+		l.file.Truncate(l.size)
+		return err
+	}
+	l.size += int64(buf.Len())
+	return nil
+}
+
+// load reads the layout of an existing log, or initializes an empty one.
+func (l *RecordLog) load() error {
+	info, err := l.file.Stat()
+	if err != nil {
+		return err
+	}
+	if info.Size() == 0 {
+		header := append([]byte(recordLogMagic), recordLogVersion)
+		if _, err := l.file.WriteAt(header, 0); err != nil {
+			return err
+		}
+		l.size = int64(len(header))
+		return nil
+	}
+
+	var header [recordLogHeaderSize]byte
+	if _, err := l.file.ReadAt(header[:], 0); err != nil || string(header[:4]) != recordLogMagic {
+		return Err("RecordLog", l.path, "not a record log")
+	}
+	if header[4] != recordLogVersion {
+		return Err("RecordLog", l.path, "format version", Convert(int(header[4])).String(), D.Not, D.Supported)
+	}
+
+	if l.loadFooter(info.Size()) {
+		return nil
+	}
+	return l.scan()
+}
+
+// loadFooter rebuilds the record offsets from the index chain of a cleanly
+// closed log, then drops the footer so new records can be appended. It
+// returns false when the log has to be scanned instead.
+func (l *RecordLog) loadFooter(fileSize int64) bool {
+	if fileSize < int64(recordLogHeaderSize+recordTrailerSize) {
+		return false
+	}
+	var trailer [recordTrailerSize]byte
+	if _, err := l.file.ReadAt(trailer[:], fileSize-int64(recordTrailerSize)); err != nil || string(trailer[8:]) != recordLogMagic {
+		return false
+	}
+	footerAt := int64(readUint64LE(trailer[:8]))
+	kind, payload, end, err := l.readEntry(footerAt)
+	if err != nil || kind != entryFooter || end != fileSize-int64(recordTrailerSize) {
+		return false
+	}
+	r := newSliceReader(payload)
+	count, err1 := r.ReadUvarint()
+	last, err2 := r.ReadUvarint()
+	if err1 != nil || err2 != nil {
+		return false
+	}
+
+	// Walk the index chain backwards, then lay the blocks out in order.
+	var blocks [][]int64
+	total := uint64(0)
+	for at := int64(last) - 1; at >= 0; {
+		kind, payload, _, err := l.readEntry(at)
+		if err != nil || kind != entryIndex || len(blocks) > int(count) {
+			return false
+		}
+		r := newSliceReader(payload)
+		prev, err1 := r.ReadUvarint()
+		n, err2 := r.ReadUvarint()
+		if err1 != nil || err2 != nil || n > uint64(r.Len()) {
+			return false
+		}
+		block := make([]int64, n)
+		off := int64(0)
+		for i := range block {
+			delta, err := r.ReadUvarint()
+			if err != nil {
+				return false
+			}
+			off += int64(delta)
+			block[i] = off
+		}
+		blocks = append(blocks, block)
+		total += n
+		if int64(prev)-1 >= at {
+			return false
+		}
+		at = int64(prev) - 1
+	}
+	if total != count {
+		return false
+	}
+
+	l.offsets = make([]int64, 0, count)
+	for i := len(blocks) - 1; i >= 0; i-- {
+		l.offsets = append(l.offsets, blocks[i]...)
+	}
+	l.indexed = len(l.offsets)
+	l.lastIndex = int64(last) - 1
+	l.size = footerAt
+	return l.file.Truncate(footerAt) == nil
+}
+
+// scan reads every entry from the start and truncates the file after the
+// last intact one when the log ends with a torn entry: one that runs past the
+// end of the file, or the last entry when it fails its checksum, with no
+// intact entry after it. A corrupt entry followed by more data, including
+// data hidden by a corrupt length prefix, is an error, so records written
+// after it are never dropped.
+func (l *RecordLog) scan() error {
+	info, err := l.file.Stat()
+	if err != nil {
+		return err
+	}
+	l.offsets, l.indexed, l.lastIndex = nil, 0, -1
+	at := int64(recordLogHeaderSize)
+	for at < info.Size() {
+		kind, _, end, err := l.readEntry(at)
+		if (err == ErrChecksum && end >= info.Size()) || err == io.ErrUnexpectedEOF {
+			torn, terr := l.tornTail(at, info.Size())
+			if terr != nil {
+				return terr
+			}
+			if torn {
+				break
+			}
+		}
+		if err != nil {
+			return Err("RecordLog", l.path, "corrupt entry at offset", Convert(at).String(), err.Error())
+		}
+		if kind == entryFooter {
+			// A footer without its trailer means Close was interrupted.
+			break
+		}
+		switch kind {
+		case entryRecord:
+			l.offsets = append(l.offsets, at)
+		case entryIndex:
+			l.lastIndex = at
+			l.indexed = len(l.offsets)
+		default:
+			return Err("RecordLog", l.path, "corrupt entry at offset", Convert(at).String(), "kind", D.Invalid)
+		}
+		at = end
+	}
+	l.size = at
+	return l.file.Truncate(at)
+}
+
+// tornTail reports whether the bytes from at to the end of the file can be
+// what a crash left of one entry. A torn write leaves at most one entry and no
+// intact entry inside it; finding one means the length prefix at at, which
+// the checksum does not cover, was corrupted and hides the entries after it.
+func (l *RecordLog) tornTail(at, size int64) (bool, error) {
+	if size-at > int64(entrySize(l.codec.tb.maxBody())) {
+		return false, nil
+	}
+	tail := make([]byte, size-at)
+	if _, err := l.file.ReadAt(tail, at); err != nil {
+		return false, err
+	}
+	for i := 1; i < len(tail); i++ {
+		if kind := tail[i]; kind >= entryRecord && kind <= entryFooter && intactEntry(kind, tail[i+1:]) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// intactEntry reports whether b, following a kind byte, starts with a
+// complete entry of that kind whose checksum matches.
+func intactEntry(kind byte, b []byte) bool {
+	r := newSliceReader(b)
+	size, err := r.ReadUvarint()
+	if err != nil {
+		return false
+	}
+	sum, err := r.Slice(4)
+	if err != nil || size > uint64(r.Len()) {
+		return false
+	}
+	payload, _ := r.Slice(int(size))
+	return entryChecksum(kind, payload) == uint32(sum[0])|uint32(sum[1])<<8|uint32(sum[2])<<16|uint32(sum[3])<<24
+}
+
+// readUint64LE decodes 8 little-endian bytes.
+func readUint64LE(b []byte) uint64 {
+	d := decoder{reader: newSliceReader(b)}
+	v, _ := d.readUint64()
+	return v
+}
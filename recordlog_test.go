@@ -0,0 +1,222 @@
+package binary
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type logEvent struct {
+	Seq  int
+	Kind string
+}
+
+func openTestLog(t *testing.T, path string) *RecordLog {
+	t.Helper()
+	l, err := OpenRecordLog(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return l
+}
+
+func appendEvents(t *testing.T, l *RecordLog, from, to int) {
+	t.Helper()
+	for i := from; i < to; i++ {
+		n, err := l.Append(&logEvent{Seq: i, Kind: "evt"})
+		assertNoError(t, err)
+		assertEqual(t, i, n)
+	}
+}
+
+func checkEvents(t *testing.T, l *RecordLog, n int) {
+	t.Helper()
+	assertEqual(t, n, l.Len())
+	for _, i := range []int{0, n / 3, n - 1} {
+		var ev logEvent
+		assertNoError(t, l.Get(i, &ev))
+		assertEqual(t, i, ev.Seq)
+	}
+}
+
+func TestRecordLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.log")
+
+	l := openTestLog(t, path)
+	appendEvents(t, l, 0, 150)
+	checkEvents(t, l, 150)
+	assertNoError(t, l.Close())
+
+	// Reopening a closed log reads the index, and appends continue after it.
+	l = openTestLog(t, path)
+	checkEvents(t, l, 150)
+	appendEvents(t, l, 150, 200)
+	assertNoError(t, l.Close())
+
+	l = openTestLog(t, path)
+	defer l.Close()
+	checkEvents(t, l, 200)
+
+	if err := l.Get(200, &logEvent{}); err == nil {
+		t.Fatal("expected out of range error")
+	}
+
+	t.Run("Iterators", func(t *testing.T) {
+		i := 0
+		for it := l.Iter(); it.Next(); i++ {
+			var ev logEvent
+			assertNoError(t, it.Record().Decode(&ev))
+			assertEqual(t, i, ev.Seq)
+			assertEqual(t, i, it.Record().Index)
+		}
+		assertEqual(t, 200, i)
+
+		i = 199
+		it := l.Reverse()
+		for ; it.Next(); i-- {
+			var ev logEvent
+			assertNoError(t, it.Record().Decode(&ev))
+			assertEqual(t, i, ev.Seq)
+		}
+		assertNoError(t, it.Err())
+		assertEqual(t, -1, i)
+	})
+
+	t.Run("Compact", func(t *testing.T) {
+		assertNoError(t, l.Compact(func(r Record) bool {
+			var ev logEvent
+			r.Decode(&ev)
+			return ev.Seq%2 == 0
+		}))
+		assertEqual(t, 100, l.Len())
+		var ev logEvent
+		assertNoError(t, l.Get(99, &ev))
+		assertEqual(t, 198, ev.Seq)
+		if _, err := os.Stat(path + ".compact"); !os.IsNotExist(err) {
+			t.Fatal("temporary compaction file left behind")
+		}
+
+		_, err := l.Append(&logEvent{Seq: 1000})
+		assertNoError(t, err)
+		assertEqual(t, 101, l.Len())
+	})
+}
+
+func TestRecordLogRecovery(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.log")
+
+	// Simulate a crash: no Close, and the last record only half written.
+	l := openTestLog(t, path)
+	appendEvents(t, l, 0, 100)
+	assertNoError(t, l.Sync())
+	assertNoError(t, l.file.Close())
+	info, err := os.Stat(path)
+	assertNoError(t, err)
+	assertNoError(t, os.Truncate(path, info.Size()-3))
+
+	l = openTestLog(t, path)
+	checkEvents(t, l, 99)
+	appendEvents(t, l, 99, 120)
+	assertNoError(t, l.Close())
+
+	// A corrupt byte inside the last record also ends the log there.
+	l = openTestLog(t, path)
+	appendEvents(t, l, 120, 121)
+	last := l.offsets[120]
+	assertNoError(t, l.file.Close())
+	corruptLog(t, path, last+7)
+
+	l = openTestLog(t, path)
+	defer l.Close()
+	checkEvents(t, l, 120)
+}
+
+func TestRecordLogCorruptMiddle(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.log")
+	l := openTestLog(t, path)
+	appendEvents(t, l, 0, 10)
+	middle := l.offsets[4]
+	assertNoError(t, l.file.Close())
+	corruptLog(t, path, middle+7)
+	before, err := os.Stat(path)
+	assertNoError(t, err)
+
+	// The records after the damaged one must not be truncated away.
+	if _, err := OpenRecordLog(path); err == nil || !strings.Contains(err.Error(), "corrupt entry") {
+		t.Fatalf("expected corrupt entry error, got %v", err)
+	}
+	after, err := os.Stat(path)
+	assertNoError(t, err)
+	assertEqual(t, before.Size(), after.Size())
+}
+
+func TestRecordLogCorruptLength(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.log")
+	l := openTestLog(t, path)
+	appendEvents(t, l, 0, 10)
+	middle := l.offsets[4]
+	assertNoError(t, l.file.Close())
+
+	// A length prefix pointing past the end of the file looks like a torn
+	// write, but intact records follow it.
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	assertNoError(t, err)
+	_, err = f.WriteAt([]byte{0xff, 0x7f}, middle+1)
+	assertNoError(t, err)
+	f.Close()
+	before, err := os.Stat(path)
+	assertNoError(t, err)
+
+	if _, err := OpenRecordLog(path); err == nil || !strings.Contains(err.Error(), "corrupt entry") {
+		t.Fatalf("expected corrupt entry error, got %v", err)
+	}
+	after, err := os.Stat(path)
+	assertNoError(t, err)
+	assertEqual(t, before.Size(), after.Size())
+}
+
+// corruptLog flips the byte at offset at of the file.
+func corruptLog(t *testing.T, path string, at int64) {
+	t.Helper()
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	assertNoError(t, err)
+	defer f.Close()
+	var b [1]byte
+	_, err = f.ReadAt(b[:], at)
+	assertNoError(t, err)
+	_, err = f.WriteAt([]byte{b[0] ^ 0xff}, at)
+	assertNoError(t, err)
+}
+
+func TestRecordLogNotALog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "other")
+	assertNoError(t, os.WriteFile(path, []byte("hello world"), 0o644))
+	if _, err := OpenRecordLog(path); err == nil {
+		t.Fatal("expected error for a file that is not a record log")
+	}
+}
+
+func TestRecordLogReadsIndex(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.log")
+	l := openTestLog(t, path)
+	appendEvents(t, l, 0, 70)
+	at := l.offsets[5]
+	assertNoError(t, l.Close())
+
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	assertNoError(t, err)
+	_, err = f.WriteAt([]byte{0xee}, at+7)
+	assertNoError(t, err)
+	f.Close()
+
+	// A closed log is loaded from its index without reading every record, so
+	// the damaged record is only detected when it is read.
+	l = openTestLog(t, path)
+	defer l.Close()
+	assertEqual(t, 70, l.Len())
+	if err := l.Get(5, &logEvent{}); err != ErrChecksum {
+		t.Fatalf("expected ErrChecksum, got %v", err)
+	}
+	checkEvents(t, l, 70)
+}
@@ -0,0 +1,98 @@
+package binary
+
+import (
+	"reflect"
+
+	. "github.com/tinywasm/fmt"
+)
+
+// Register scans, validates and caches the schema of every given type so that
+// unsupported fields and HandlerName collisions are reported at startup instead
+// of on the first Encode. Pass pointers so HandlerName methods are visible:
+//
+//	func init() { binary.MustRegister(&User{}, &Order{}) }
+func Register(types ...any) error {
+	return defaultCodec().Register(types...)
+}
+
+// MustRegister is like Register but panics if any type is rejected.
+func MustRegister(types ...any) {
+	if err := Register(types...); err != nil {
+		panic(err)
+	}
+}
+
+// register validates and caches each type, collecting every problem found.
+func (tb *instance) register(types ...any) error {
+	var problems []string
+	for _, v := range types {
+		if v == nil {
+			problems = append(problems, "nil value")
+			continue
+		}
+
+		t := reflect.TypeOf(v)
+		if t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+
+		unsupported := unsupportedFields(t, t.String(), nil, nil)
+		if len(unsupported) > 0 {
+			problems = append(problems, unsupported...)
+			continue
+		}
+
+		var name string
+		if nh, ok := v.(namedHandler); ok {
+			name = nh.HandlerName()
+		}
+
+		if _, err := tb.scanToCache(t, name); err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+
+	if len(problems) > 0 {
+		return Err("register:", Convert(problems).Join("; ").String())
+	}
+	return nil
+}
+
+// unsupportedFields walks t the same way scanType does and returns the path of
+// every value that cannot be encoded. stack holds the struct types currently
+// being visited so recursive types are reported instead of looping forever.
+func unsupportedFields(t reflect.Type, path string, stack []reflect.Type, out []string) []string {
+	pt := reflect.PointerTo(t)
+	if (t.Implements(binaryMarshalerType) || pt.Implements(binaryMarshalerType)) && pt.Implements(binaryUnmarshalerType) {
+		return out
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		return unsupportedFields(t.Elem(), path, stack, out)
+	case reflect.Array, reflect.Slice:
+		return unsupportedFields(t.Elem(), path+"[]", stack, out)
+	case reflect.Map:
+		out = unsupportedFields(t.Key(), path+"[key]", stack, out)
+		return unsupportedFields(t.Elem(), path+"[]", stack, out)
+	case reflect.Struct:
+		for _, s := range stack {
+			if s == t {
+				return append(out, path+" ("+t.String()+": recursive type not supported)")
+			}
+		}
+		stack = append(stack, t)
+		for _, i := range scanStruct(t).fields {
+			field := t.Field(i)
+			out = unsupportedFields(field.Type, path+"."+field.Name, stack, out)
+		}
+		return out
+	case reflect.String, reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return out
+	}
+
+	return append(out, path+" ("+t.String()+" not supported)")
+}
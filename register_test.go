@@ -0,0 +1,115 @@
+package binary
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type registerOK struct {
+	Name  string
+	Items []registerItem
+}
+
+type registerItem struct {
+	ID   uint32
+	Tags map[string]int
+}
+
+type registerBad struct {
+	Name     string
+	Events   chan int
+	Handlers []registerHandler
+	Lookup   map[string]func()
+	hidden   func()
+}
+
+type registerHandler struct {
+	Fn func(string)
+}
+
+type registerNode struct {
+	Value int
+	Next  *registerNode
+}
+
+type registerNamedA struct{ A string }
+
+func (registerNamedA) HandlerName() string { return "register.shared" }
+
+type registerNamedB struct{ B int }
+
+func (registerNamedB) HandlerName() string { return "register.shared" }
+
+func TestRegister(t *testing.T) {
+	t.Run("CachesValidTypes", func(t *testing.T) {
+		inst := newInstance()
+		if err := inst.register(&registerOK{}); err != nil {
+			t.Fatalf("register failed: %v", err)
+		}
+		if _, found := inst.findSchema(reflect.TypeOf(registerOK{})); !found {
+			t.Error("expected registerOK schema to be cached")
+		}
+	})
+
+	t.Run("ReportsEveryUnsupportedField", func(t *testing.T) {
+		inst := newInstance()
+		err := inst.register(&registerBad{})
+		if err == nil {
+			t.Fatal("expected error for unsupported fields")
+		}
+		msg := err.Error()
+		for _, path := range []string{
+			"binary.registerBad.Events (chan int",
+			"binary.registerBad.Handlers[].Fn (func(string)",
+			"binary.registerBad.Lookup[] (func()",
+		} {
+			if !strings.Contains(msg, path) {
+				t.Errorf("expected %q in error, got %q", path, msg)
+			}
+		}
+		if strings.Contains(msg, "hidden") {
+			t.Errorf("unexported field should not be reported: %q", msg)
+		}
+		if _, found := inst.findSchema(reflect.TypeOf(registerBad{})); found {
+			t.Error("invalid type should not be cached")
+		}
+	})
+
+	t.Run("ReportsRecursiveTypes", func(t *testing.T) {
+		err := newInstance().register(registerNode{})
+		if err == nil || !strings.Contains(err.Error(), "binary.registerNode.Next (binary.registerNode: recursive type") {
+			t.Errorf("expected recursive type error, got %v", err)
+		}
+	})
+
+	t.Run("ReportsHandlerNameCollision", func(t *testing.T) {
+		err := newInstance().register(registerNamedA{}, registerNamedB{})
+		if err == nil || !strings.Contains(err.Error(), `HandlerName "register.shared" already used by binary.registerNamedA`) {
+			t.Errorf("expected collision error, got %v", err)
+		}
+	})
+
+	t.Run("NilValue", func(t *testing.T) {
+		if err := newInstance().register(nil); err == nil {
+			t.Error("expected error for nil value")
+		}
+	})
+
+	t.Run("MustRegisterPanics", func(t *testing.T) {
+		defer func() {
+			if recover() == nil {
+				t.Error("expected panic")
+			}
+		}()
+		MustRegister(&registerBad{})
+	})
+
+	t.Run("GlobalRegister", func(t *testing.T) {
+		MustRegister(&registerOK{})
+		var b []byte
+		if err := Encode(&registerOK{Name: "ok"}, &b); err != nil {
+			t.Fatalf("Encode failed: %v", err)
+		}
+	})
+}
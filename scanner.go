@@ -102,7 +102,16 @@ func scanType(t reflect.Type) (codec, error) {
 		v := make(reflectStructcodec, 0, len(s.fields))
 		for _, i := range s.fields {
 			field := t.Field(i)
-			codec, err := scanType(field.Type)
+			enc, err := fieldIntEncoding(field)
+			if err != nil {
+				return nil, err
+			}
+			var codec codec
+			if enc.isDefault() {
+				codec, err = scanType(field.Type)
+			} else {
+				codec, err = scanEncodedType(field.Type, enc)
+			}
 			if err != nil {
 				return nil, err
 			}
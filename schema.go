@@ -0,0 +1,352 @@
+package binary
+
+import (
+	"reflect"
+
+	. "github.com/tinywasm/fmt"
+)
+
+// NodeKind identifies how a schema node is laid out on the wire.
+type NodeKind uint8
+
+const (
+	KindInvalid   NodeKind = iota // type not supported by the encoder
+	KindBool                      // one byte, 0 or 1
+	KindInt                       // zigzag varint, unless Node.Encoding says otherwise
+	KindUint                      // varint, unless Node.Encoding says otherwise
+	KindFloat32                   // 4 bytes little-endian IEEE 754
+	KindFloat64                   // 8 bytes little-endian IEEE 754
+	KindString                    // uvarint length + UTF-8 bytes
+	KindBytes                     // uvarint length + raw bytes
+	KindMarshaler                 // uvarint length + encoding.BinaryMarshaler payload
+	KindPointer                   // bool isNil + Elem when not nil
+	KindSlice                     // uvarint length + Elem repeated
+	KindArray                     // Len times Elem
+	KindMap                       // uvarint length + (Key, Elem) repeated
+	KindStruct                    // Fields in declaration order
+)
+
+var kindNames = [...]string{"invalid", "bool", "int", "uint", "float32", "float64", "string", "bytes", "marshaler", "pointer", "slice", "array", "map", "struct"}
+
+// String returns the lower-case name of the kind.
+func (k NodeKind) String() string {
+	if int(k) < len(kindNames) {
+		return kindNames[k]
+	}
+	return "invalid"
+}
+
+// Schema is a serializable descriptor of an encoded type. Nodes are stored in
+// a flat list so the descriptor itself can be encoded with this package:
+// Nodes[0] is the root and Elem, Key and Field.Type are indexes into Nodes.
+type Schema struct {
+	Name      string // HandlerName of the root type, or its Go type name
+	Versioned bool   // payloads start with a uvarint BinaryVersion header
+	Version   uint   // BinaryVersion of the root type
+	Nodes     []Node
+}
+
+// Node describes a single type of the schema.
+type Node struct {
+	Kind   NodeKind
+	Type   string  // Go type name, informational only
+	Elem   int     // element node of pointers, slices, arrays and maps
+	Key    int     // key node of maps
+	Len    int     // length of arrays
+	Bits   int     // size of ints, uints and floats
+	Fields []Field // encoded fields of structs, in wire order
+
+	// Encoding is the wire form of ints and uints set by a binary tag:
+	// "fixed32" or "fixed64" (little-endian, also "fixed8" and "fixed16"),
+	// followed by ",be" when big-endian, or "uvarint" for signed varints
+	// without zigzag. Empty for the default varints.
+	Encoding string
+}
+
+// Field describes an encoded struct field.
+type Field struct {
+	Name string // Go field name
+	Tag  string // raw struct tag
+	Type int    // node index
+}
+
+// Value is a dynamically decoded value. Depending on the node kind it holds
+// nil (nil pointer), bool, int64, uint64, float32, float64, string, []byte
+// (bytes and marshaler payloads), []Value (slices and arrays),
+// map[string]Value (structs, keyed by Go field name) or map[Value]Value (maps).
+type Value = any
+
+// DescribeType returns the schema descriptor of v's type, following the same
+// rules scanType uses to build codecs. Unsupported types are described with
+// KindInvalid nodes.
+func DescribeType(v any) Schema {
+	var s Schema
+	if v == nil {
+		s.Nodes = append(s.Nodes, Node{Kind: KindInvalid})
+		return s
+	}
+
+	t := reflect.TypeOf(v)
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	s = describeType(t)
+	if nh, ok := v.(namedHandler); ok {
+		s.Name = nh.HandlerName()
+	}
+	s.Version, s.Versioned = typeVersion(t)
+	return s
+}
+
+// describeType returns the schema descriptor of t, named after its Go type.
+func describeType(t reflect.Type) Schema {
+	s := Schema{Name: t.String()}
+	s.describe(t, nil)
+	return s
+}
+
+// Root returns the root node of the schema.
+func (s Schema) Root() *Node {
+	if len(s.Nodes) == 0 {
+		return &Node{}
+	}
+	return &s.Nodes[0]
+}
+
+// describe appends the node for t (and its children) and returns its index.
+// stack holds the struct types currently being described: a recursive type
+// is described with a KindInvalid node where it refers to itself.
+func (s *Schema) describe(t reflect.Type, stack []reflect.Type) int {
+	idx := len(s.Nodes)
+	s.Nodes = append(s.Nodes, Node{})
+	n := Node{Type: t.String()}
+
+	pt := reflect.PointerTo(t)
+	if (t.Implements(binaryMarshalerType) || pt.Implements(binaryMarshalerType)) && pt.Implements(binaryUnmarshalerType) {
+		n.Kind = KindMarshaler
+		s.Nodes[idx] = n
+		return idx
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		n.Kind = KindPointer
+		n.Elem = s.describe(t.Elem(), stack)
+	case reflect.Array:
+		n.Kind = KindArray
+		n.Len = t.Len()
+		n.Elem = s.describe(t.Elem(), stack)
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			n.Kind = KindBytes
+		} else {
+			n.Kind = KindSlice
+			n.Elem = s.describe(t.Elem(), stack)
+		}
+	case reflect.Map:
+		n.Kind = KindMap
+		n.Key = s.describe(t.Key(), stack)
+		n.Elem = s.describe(t.Elem(), stack)
+	case reflect.Struct:
+		for _, st := range stack {
+			if st == t {
+				s.Nodes[idx] = n // KindInvalid
+				return idx
+			}
+		}
+		stack = append(stack, t)
+		n.Kind = KindStruct
+		for _, i := range scanStruct(t).fields {
+			field := t.Field(i)
+			typ := s.describe(field.Type, stack)
+			if enc, err := fieldIntEncoding(field); err == nil && !enc.isDefault() {
+				s.setIntEncoding(typ, field.Type, enc)
+			}
+			n.Fields = append(n.Fields, Field{
+				Name: field.Name,
+				Tag:  string(field.Tag),
+				Type: typ,
+			})
+		}
+	case reflect.String:
+		n.Kind = KindString
+	case reflect.Bool:
+		n.Kind = KindBool
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int, reflect.Int64:
+		n.Kind = KindInt
+		n.Bits = t.Bits()
+	case reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint, reflect.Uint64:
+		n.Kind = KindUint
+		n.Bits = t.Bits()
+	case reflect.Float32:
+		n.Kind = KindFloat32
+		n.Bits = 32
+	case reflect.Float64:
+		n.Kind = KindFloat64
+		n.Bits = 64
+	}
+
+	s.Nodes[idx] = n
+	return idx
+}
+
+// setIntEncoding records enc on the integers of node n, of type t, reached
+// the way scanEncodedType reaches them.
+func (s *Schema) setIntEncoding(n int, t reflect.Type, enc intEncoding) {
+	node := &s.Nodes[n]
+	switch node.Kind {
+	case KindPointer, KindSlice, KindArray, KindMap:
+		s.setIntEncoding(node.Elem, t.Elem(), enc)
+	case KindInt, KindUint:
+		node.Encoding = enc.forType(t).String()
+	}
+}
+
+// DecodeDynamic decodes data described by schema into a generic Value tree,
+// without needing the Go type that produced it. Versioned payloads must hold
+// the schema's version.
+func DecodeDynamic(data []byte, schema Schema) (Value, error) {
+	v, _, err := schema.decodeDynamicRoot(data)
+	return v, err
+}
+
+// Validate reports whether data decodes cleanly against the schema and holds
+// no bytes past the end of the encoded value.
+func (s Schema) Validate(data []byte) error {
+	_, rest, err := s.decodeDynamicRoot(data)
+	if err == nil && rest > 0 {
+		err = Err("Validate", Convert(rest).String(), "trailing bytes")
+	}
+	return err
+}
+
+// decodeDynamicRoot decodes a whole payload and returns the number of bytes
+// left unread.
+func (s *Schema) decodeDynamicRoot(data []byte) (Value, int, error) {
+	if len(s.Nodes) == 0 {
+		return nil, 0, Err("DecodeDynamic", "schema", D.Empty)
+	}
+	r := newSliceReader(data)
+	d := &decoder{reader: r}
+	if s.Versioned {
+		version, err := d.readUvarint()
+		if err != nil {
+			return nil, 0, err
+		}
+		if version != uint64(s.Version) {
+			return nil, 0, Err("DecodeDynamic", "payload version", Convert(version).String(), "does not match schema version", Convert(s.Version).String())
+		}
+	}
+	v, err := d.decodeDynamic(s, 0, 0)
+	return v, r.Len(), err
+}
+
+// decodeDynamic decodes the node at index n of the schema. depth guards
+// against cyclic descriptors: a path through an acyclic one visits each node
+// at most once.
+func (d *decoder) decodeDynamic(s *Schema, n, depth int) (Value, error) {
+	if n < 0 || n >= len(s.Nodes) {
+		return nil, Err("DecodeDynamic", "node", D.Out, D.Of, D.Range)
+	}
+	if depth > len(s.Nodes) {
+		return nil, Err("DecodeDynamic", "cyclic schema at node", Convert(n).String())
+	}
+	node := &s.Nodes[n]
+
+	switch node.Kind {
+	case KindBool:
+		return d.readBool()
+	case KindInt, KindUint:
+		enc, err := node.intEncoding()
+		if err != nil {
+			return nil, err
+		}
+		if node.Kind == KindInt {
+			return d.readIntAs(enc)
+		}
+		return d.readUintAs(enc)
+	case KindFloat32:
+		return d.readFloat32()
+	case KindFloat64:
+		return d.readFloat64()
+	case KindString:
+		return d.readString()
+	case KindBytes, KindMarshaler:
+		b, err := d.readSlice()
+		if err != nil {
+			return nil, err
+		}
+		out := make([]byte, len(b))
+		copy(out, b)
+		return out, nil
+	case KindPointer:
+		isNil, err := d.readBool()
+		if err != nil || isNil {
+			return nil, err
+		}
+		return d.decodeDynamic(s, node.Elem, depth+1)
+	case KindSlice, KindArray:
+		l := uint64(node.Len)
+		if node.Kind == KindSlice {
+			var err error
+			if l, err = d.readUvarint(); err != nil {
+				return nil, err
+			}
+		}
+		out := make([]Value, 0, d.capHint(l))
+		for i := uint64(0); i < l; i++ {
+			v, err := d.decodeDynamic(s, node.Elem, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, v)
+		}
+		return out, nil
+	case KindMap:
+		l, err := d.readUvarint()
+		if err != nil {
+			return nil, err
+		}
+		if k := s.kindOf(node.Key); k < KindBool || k > KindString {
+			return nil, Err("DecodeDynamic", "map key", k.String(), D.Not, D.Supported)
+		}
+		out := make(map[Value]Value, d.capHint(l))
+		for i := uint64(0); i < l; i++ {
+			k, err := d.decodeDynamic(s, node.Key, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			v, err := d.decodeDynamic(s, node.Elem, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			out[k] = v
+		}
+		return out, nil
+	case KindStruct:
+		out := make(map[string]Value, len(node.Fields))
+		for _, f := range node.Fields {
+			v, err := d.decodeDynamic(s, f.Type, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			out[f.Name] = v
+		}
+		return out, nil
+	}
+
+	return nil, Err("DecodeDynamic", node.Type, D.Type, D.Not, D.Supported)
+}
+
+// capHint bounds a length prefix read from the wire by the bytes left in a
+// slice reader, so a corrupt prefix cannot force a huge allocation.
+func (d *decoder) capHint(l uint64) int {
+	if sr, ok := d.reader.(*sliceReader); ok && l > uint64(sr.Len()) {
+		return sr.Len()
+	}
+	if l > 1024 {
+		return 1024
+	}
+	return int(l)
+}
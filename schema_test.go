@@ -0,0 +1,228 @@
+package binary
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type schemaUser struct {
+	Name    string `json:"name"`
+	Age     int32
+	Score   float64
+	Ratio   float32
+	Active  bool
+	Avatar  []byte
+	Tags    []string
+	Parent  *schemaUser2
+	Grid    [2]uint16
+	Attrs   map[string]int
+	Created time.Time
+	secret  string
+	Skipped string `binary:"-"`
+}
+
+type schemaUser2 struct {
+	ID uint64
+}
+
+func (*schemaUser) HandlerName() string { return "schema.user" }
+
+func TestDescribeType(t *testing.T) {
+	s := DescribeType(&schemaUser{})
+	if s.Name != "schema.user" {
+		t.Errorf("expected handler name, got %q", s.Name)
+	}
+
+	root := s.Root()
+	if root.Kind != KindStruct {
+		t.Fatalf("expected struct root, got %v", root.Kind)
+	}
+
+	want := []struct {
+		name string
+		kind NodeKind
+	}{
+		{"Name", KindString}, {"Age", KindInt}, {"Score", KindFloat64}, {"Ratio", KindFloat32},
+		{"Active", KindBool}, {"Avatar", KindBytes}, {"Tags", KindSlice}, {"Parent", KindPointer},
+		{"Grid", KindArray}, {"Attrs", KindMap}, {"Created", KindMarshaler},
+	}
+	if len(root.Fields) != len(want) {
+		t.Fatalf("expected %d fields, got %d", len(want), len(root.Fields))
+	}
+	for i, w := range want {
+		f := root.Fields[i]
+		if f.Name != w.name || s.Nodes[f.Type].Kind != w.kind {
+			t.Errorf("field %d: expected %s %v, got %s %v", i, w.name, w.kind, f.Name, s.Nodes[f.Type].Kind)
+		}
+	}
+	if root.Fields[0].Tag != `json:"name"` {
+		t.Errorf("expected tag to be kept, got %q", root.Fields[0].Tag)
+	}
+
+	grid := s.Nodes[root.Fields[8].Type]
+	if grid.Len != 2 || s.Nodes[grid.Elem].Kind != KindUint {
+		t.Errorf("unexpected array node %+v", grid)
+	}
+	parent := s.Nodes[s.Nodes[root.Fields[7].Type].Elem]
+	if parent.Kind != KindStruct || parent.Fields[0].Name != "ID" {
+		t.Errorf("unexpected pointer element %+v", parent)
+	}
+
+	if DescribeType(make(chan int)).Root().Kind != KindInvalid {
+		t.Error("expected chan to be described as invalid")
+	}
+	if DescribeType(nil).Root().Kind != KindInvalid {
+		t.Error("expected nil to be described as invalid")
+	}
+	if KindStruct.String() != "struct" || NodeKind(200).String() != "invalid" {
+		t.Error("unexpected kind names")
+	}
+}
+
+type schemaNode struct {
+	Value    int
+	Next     *schemaNode
+	Children []schemaNode
+}
+
+func TestDescribeRecursiveType(t *testing.T) {
+	s := DescribeType(&schemaNode{})
+	root := s.Root()
+	if root.Kind != KindStruct || len(root.Fields) != 3 {
+		t.Fatalf("unexpected root %+v", root)
+	}
+	next := s.Nodes[root.Fields[1].Type]
+	if next.Kind != KindPointer || s.Nodes[next.Elem].Kind != KindInvalid {
+		t.Errorf("expected the recursive pointer to be invalid, got %+v", next)
+	}
+	children := s.Nodes[root.Fields[2].Type]
+	if children.Kind != KindSlice || s.Nodes[children.Elem].Kind != KindInvalid {
+		t.Errorf("expected the recursive slice to be invalid, got %+v", children)
+	}
+}
+
+func TestSchemaIsSerializable(t *testing.T) {
+	s := DescribeType(&schemaUser{})
+
+	var b []byte
+	if err := Encode(&s, &b); err != nil {
+		t.Fatalf("Encode schema: %v", err)
+	}
+	var out Schema
+	if err := Decode(b, &out); err != nil {
+		t.Fatalf("Decode schema: %v", err)
+	}
+	if !reflect.DeepEqual(s, out) {
+		t.Errorf("schema round trip mismatch:\n%+v\n%+v", s, out)
+	}
+}
+
+func TestDecodeDynamic(t *testing.T) {
+	created := time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC)
+	in := &schemaUser{
+		Name:    "Alice",
+		Age:     -30,
+		Score:   9.5,
+		Ratio:   0.25,
+		Active:  true,
+		Avatar:  []byte{1, 2},
+		Tags:    []string{"a", "b"},
+		Parent:  &schemaUser2{ID: 7},
+		Grid:    [2]uint16{3, 4},
+		Attrs:   map[string]int{"x": 1},
+		Created: created,
+	}
+
+	var b []byte
+	if err := Encode(in, &b); err != nil {
+		t.Fatal(err)
+	}
+
+	v, err := DecodeDynamic(b, DescribeType(in))
+	if err != nil {
+		t.Fatalf("DecodeDynamic: %v", err)
+	}
+
+	m, ok := v.(map[string]Value)
+	if !ok {
+		t.Fatalf("expected struct map, got %T", v)
+	}
+	createdBin, _ := created.MarshalBinary()
+	want := map[string]Value{
+		"Name":    "Alice",
+		"Age":     int64(-30),
+		"Score":   9.5,
+		"Ratio":   float32(0.25),
+		"Active":  true,
+		"Avatar":  []byte{1, 2},
+		"Tags":    []Value{"a", "b"},
+		"Parent":  map[string]Value{"ID": uint64(7)},
+		"Grid":    []Value{uint64(3), uint64(4)},
+		"Attrs":   map[Value]Value{"x": int64(1)},
+		"Created": createdBin,
+	}
+	if !reflect.DeepEqual(want, m) {
+		t.Errorf("unexpected dynamic value:\nwant %#v\ngot  %#v", want, m)
+	}
+
+	t.Run("NilPointer", func(t *testing.T) {
+		var b []byte
+		if err := Encode(&schemaUser{}, &b); err != nil {
+			t.Fatal(err)
+		}
+		v, err := DecodeDynamic(b, DescribeType(&schemaUser{}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p := v.(map[string]Value)["Parent"]; p != nil {
+			t.Errorf("expected nil parent, got %#v", p)
+		}
+	})
+
+	t.Run("Errors", func(t *testing.T) {
+		if _, err := DecodeDynamic(b, Schema{}); err == nil {
+			t.Error("expected error for empty schema")
+		}
+		if _, err := DecodeDynamic(b[:len(b)/2], DescribeType(in)); err == nil {
+			t.Error("expected error for truncated data")
+		}
+		if _, err := DecodeDynamic(b, DescribeType(make(chan int))); err == nil {
+			t.Error("expected error for invalid node")
+		}
+		bad := Schema{Nodes: []Node{{Kind: KindPointer, Elem: 5}}}
+		if _, err := DecodeDynamic([]byte{0}, bad); err == nil {
+			t.Error("expected error for out of range node")
+		}
+		badKey := Schema{Nodes: []Node{{Kind: KindMap, Key: 5, Elem: 1}, {Kind: KindBool}}}
+		if _, err := DecodeDynamic([]byte{1, 0, 0}, badKey); err == nil {
+			t.Error("expected error for out of range map key")
+		}
+		cyclic := Schema{Nodes: []Node{{Kind: KindStruct, Fields: []Field{{Name: "Self", Type: 0}}}}}
+		if _, err := DecodeDynamic(nil, cyclic); err == nil || !strings.Contains(err.Error(), "cyclic") {
+			t.Errorf("expected cyclic schema error, got %v", err)
+		}
+		structKey := DescribeType(map[schemaUser2]int{})
+		if _, err := DecodeDynamic([]byte{1, 1, 1}, structKey); err == nil {
+			t.Error("expected error for struct map key")
+		}
+	})
+}
+
+func TestSchemaValidate(t *testing.T) {
+	var data []byte
+	if err := Encode(&schemaUser2{ID: 300}, &data); err != nil {
+		t.Fatal(err)
+	}
+	s := DescribeType(schemaUser2{})
+	if err := s.Validate(data); err != nil {
+		t.Fatalf("valid payload: %v", err)
+	}
+	if err := s.Validate(data[:1]); err == nil {
+		t.Fatal("expected error for truncated payload")
+	}
+	if err := s.Validate(append(data, 0)); err == nil {
+		t.Fatal("expected error for trailing bytes")
+	}
+}
@@ -0,0 +1,112 @@
+package binary
+
+import (
+	"errors"
+	"testing"
+)
+
+type testKeys struct {
+	current string
+	keys    []struct {
+		id  string
+		key []byte
+	}
+}
+
+func (k *testKeys) add(id string, key []byte) *testKeys {
+	k.keys = append(k.keys, struct {
+		id  string
+		key []byte
+	}{id, key})
+	k.current = id
+	return k
+}
+
+func (k *testKeys) CurrentKey() (string, []byte, error) {
+	key, err := k.Key(k.current)
+	return k.current, key, err
+}
+
+func (k *testKeys) Key(id string) ([]byte, error) {
+	for _, e := range k.keys {
+		if e.id == id {
+			return e.key, nil
+		}
+	}
+	return nil, errors.New("unknown key " + id)
+}
+
+type sealedNote struct {
+	Owner string
+	Body  string
+}
+
+func TestSealOpen(t *testing.T) {
+	keys := (&testKeys{}).add("k1", make([]byte, 32))
+	in := sealedNote{Owner: "alice", Body: "secret"}
+
+	sealed, err := Seal(&in, keys)
+	assertNoError(t, err)
+
+	t.Run("RoundTrip", func(t *testing.T) {
+		var out sealedNote
+		assertNoError(t, Open(sealed, &out, keys))
+		assertEqual(t, in, out)
+	})
+
+	t.Run("FreshNonce", func(t *testing.T) {
+		again, err := Seal(&in, keys)
+		assertNoError(t, err)
+		if string(again) == string(sealed) {
+			t.Fatal("two seals of the same value should differ")
+		}
+	})
+
+	t.Run("KeyRotation", func(t *testing.T) {
+		key2 := make([]byte, 16)
+		key2[0] = 1
+		keys.add("k2", key2)
+		defer func() { keys.current = "k1" }()
+
+		newer, err := Seal(&in, keys)
+		assertNoError(t, err)
+		var out sealedNote
+		assertNoError(t, Open(newer, &out, keys))
+		assertNoError(t, Open(sealed, &out, keys))
+	})
+
+	t.Run("Tampering", func(t *testing.T) {
+		for i := range sealed {
+			bad := append([]byte{}, sealed...)
+			bad[i] ^= 0x40
+			var out sealedNote
+			if err := Open(bad, &out, keys); err == nil {
+				t.Fatalf("flipped byte %d: expected error", i)
+			}
+			if out != (sealedNote{}) {
+				t.Fatalf("flipped byte %d: value decoded from a tampered envelope", i)
+			}
+		}
+		var out sealedNote
+		if err := Open(sealed[:len(sealed)-1], &out, keys); !errors.Is(err, ErrOpen) {
+			t.Fatalf("truncated: expected ErrOpen, got %v", err)
+		}
+	})
+
+	t.Run("WrongKey", func(t *testing.T) {
+		other := (&testKeys{}).add("k1", []byte("0123456789abcdef0123456789abcdef"))
+		var out sealedNote
+		if err := Open(sealed, &out, other); !errors.Is(err, ErrOpen) {
+			t.Fatalf("expected ErrOpen, got %v", err)
+		}
+	})
+
+	t.Run("CodecOptions", func(t *testing.T) {
+		c := New(WithCompression(0))
+		sealed, err := c.Seal(&in, keys)
+		assertNoError(t, err)
+		var out sealedNote
+		assertNoError(t, c.Open(sealed, &out, keys))
+		assertEqual(t, in, out)
+	})
+}
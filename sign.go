@@ -0,0 +1,161 @@
+package binary
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha256"
+
+	. "github.com/tinywasm/fmt"
+)
+
+// Signer signs messages for Sign.
+type Signer interface {
+	// KeyID identifies the key so verifiers can pick the matching one.
+	KeyID() string
+	Sign(msg []byte) ([]byte, error)
+}
+
+// Verifier checks signatures for Verify. Implementations return
+// ErrBadSignature when sig is not a valid signature of msg by keyID.
+type Verifier interface {
+	Verify(keyID string, msg, sig []byte) error
+}
+
+// Signed envelope layout:
+//
+//	version (1 byte) | len(keyID) (1 byte) | keyID | uvarint len(body) | body | signature
+//
+// The signature covers everything before it, key ID included.
+const signVersion byte = 1
+
+// ErrBadSignature is returned by Verify when the envelope is malformed or its
+// signature does not match.
+var ErrBadSignature error = Err(D.Binary, "bad signature")
+
+// Sign encodes v canonically (see WithCanonical) and wraps it in an envelope
+// signed by s.
+func Sign(v any, s Signer) ([]byte, error) {
+	return defaultCodec().Sign(v, s)
+}
+
+// Verify checks the signature of an envelope produced by Sign and only then
+// decodes its body into v.
+func Verify(data []byte, v any, ver Verifier) error {
+	return defaultCodec().Verify(data, v, ver)
+}
+
+// Sign is the package-level Sign using this codec's schema cache and headers.
+// The compression envelope is not applied to signed bodies.
+func (c *Codec) Sign(v any, s Signer) ([]byte, error) {
+	id := s.KeyID()
+	if len(id) > 255 {
+		return nil, Err("Sign", "key ID", "longer than 255 bytes")
+	}
+
+	var body bytes.Buffer
+	var err error
+	if l := c.tb.layoutOf(v); l != LayoutNone {
+		err = c.tb.encodeLayout(v, l, &body)
+	} else if c.tb.format != FormatBinary {
+		err = c.tb.encodeFormat(v, &body)
+	} else {
+		e := c.tb.encoders.Get().(*encoder)
+		e.reset(&body, c.tb)
+		e.canonical = true
+		err = e.encode(v)
+		c.tb.encoders.Put(e)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var out bytes.Buffer
+	out.Grow(2 + len(id) + 10 + body.Len() + ed25519.SignatureSize)
+	out.WriteByte(signVersion)
+	out.WriteByte(byte(len(id)))
+	out.WriteString(id)
+	hdr := newEncoder(&out)
+	hdr.writeUvarint(uint64(body.Len()))
+	out.Write(body.Bytes())
+
+	sig, err := s.Sign(out.Bytes())
+	if err != nil {
+		return nil, err
+	}
+	out.Write(sig)
+	return out.Bytes(), nil
+}
+
+// Verify is the package-level Verify using this codec's schema cache and headers.
+func (c *Codec) Verify(data []byte, v any, ver Verifier) error {
+	if len(data) < 2 || data[0] != signVersion {
+		return ErrBadSignature
+	}
+	r := newSliceReader(data)
+	r.offset = 2 + int64(data[1])
+	if len(data) < int(r.offset) {
+		return ErrBadSignature
+	}
+	id := string(data[2:r.offset])
+
+	l, err := r.ReadUvarint()
+	if err != nil || l > uint64(r.Len()) {
+		return ErrBadSignature
+	}
+	signed := int(r.offset) + int(l)
+	if err := ver.Verify(id, data[:signed], data[signed:]); err != nil {
+		return err
+	}
+	return c.tb.decodeBody(data[r.offset:signed], v)
+}
+
+// Ed25519Signer signs with an Ed25519 private key.
+type Ed25519Signer struct {
+	ID  string
+	Key ed25519.PrivateKey
+}
+
+func (s Ed25519Signer) KeyID() string { return s.ID }
+
+func (s Ed25519Signer) Sign(msg []byte) ([]byte, error) {
+	if len(s.Key) != ed25519.PrivateKeySize {
+		return nil, Err("Ed25519Signer", "key", D.Invalid)
+	}
+	return ed25519.Sign(s.Key, msg), nil
+}
+
+// Ed25519Verifier verifies signatures made with the private key of Key.
+type Ed25519Verifier struct {
+	ID  string
+	Key ed25519.PublicKey
+}
+
+func (v Ed25519Verifier) Verify(keyID string, msg, sig []byte) error {
+	if keyID != v.ID || len(v.Key) != ed25519.PublicKeySize || !ed25519.Verify(v.Key, msg, sig) {
+		return ErrBadSignature
+	}
+	return nil
+}
+
+// HMACKey signs and verifies with HMAC-SHA256 over a shared secret.
+type HMACKey struct {
+	ID     string
+	Secret []byte
+}
+
+func (k HMACKey) KeyID() string { return k.ID }
+
+func (k HMACKey) Sign(msg []byte) ([]byte, error) {
+	m := hmac.New(sha256.New, k.Secret)
+	m.Write(msg)
+	return m.Sum(nil), nil
+}
+
+func (k HMACKey) Verify(keyID string, msg, sig []byte) error {
+	want, _ := k.Sign(msg)
+	if keyID != k.ID || !hmac.Equal(want, sig) {
+		return ErrBadSignature
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+package binary
+
+import (
+	"crypto/ed25519"
+	"errors"
+	"testing"
+)
+
+type signedMsg struct {
+	From   string
+	Seq    int
+	Labels map[string]int
+}
+
+func TestCanonicalMaps(t *testing.T) {
+	c := New(WithCanonical())
+	in := signedMsg{Labels: map[string]int{"a": 1, "b": 2, "c": 3, "d": 4, "e": 5, "f": 6}}
+
+	var first []byte
+	assertNoError(t, c.Encode(&in, &first))
+	for i := 0; i < 20; i++ {
+		var again []byte
+		assertNoError(t, c.Encode(&in, &again))
+		assertEqualBytes(t, first, again)
+	}
+
+	var out signedMsg
+	assertNoError(t, c.Decode(first, &out))
+	assertEqual(t, in, out)
+}
+
+func TestSignVerify(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	assertNoError(t, err)
+	in := signedMsg{From: "peer-1", Seq: 7, Labels: map[string]int{"x": 1, "y": 2}}
+
+	cases := []struct {
+		name   string
+		signer Signer
+		ver    Verifier
+	}{
+		{"Ed25519", Ed25519Signer{ID: "ed1", Key: priv}, Ed25519Verifier{ID: "ed1", Key: pub}},
+		{"HMAC", HMACKey{ID: "h1", Secret: []byte("shared")}, HMACKey{ID: "h1", Secret: []byte("shared")}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			env, err := Sign(&in, tc.signer)
+			assertNoError(t, err)
+
+			var out signedMsg
+			assertNoError(t, Verify(env, &out, tc.ver))
+			assertEqual(t, in, out)
+
+			again, err := Sign(&in, tc.signer)
+			assertNoError(t, err)
+			assertEqualBytes(t, env, again)
+
+			for i := range env {
+				bad := append([]byte{}, env...)
+				bad[i] ^= 0x01
+				var out signedMsg
+				if err := Verify(bad, &out, tc.ver); !errors.Is(err, ErrBadSignature) {
+					t.Fatalf("flipped byte %d: expected ErrBadSignature, got %v", i, err)
+				}
+				if out.From != "" {
+					t.Fatalf("flipped byte %d: decoded before verifying", i)
+				}
+			}
+			if err := Verify(env[:len(env)-1], &out, tc.ver); !errors.Is(err, ErrBadSignature) {
+				t.Fatalf("truncated: expected ErrBadSignature, got %v", err)
+			}
+		})
+	}
+
+	t.Run("WrongKey", func(t *testing.T) {
+		env, err := Sign(&in, HMACKey{ID: "h1", Secret: []byte("shared")})
+		assertNoError(t, err)
+		var out signedMsg
+		if err := Verify(env, &out, HMACKey{ID: "h1", Secret: []byte("other")}); !errors.Is(err, ErrBadSignature) {
+			t.Fatalf("expected ErrBadSignature, got %v", err)
+		}
+		if err := Verify(env, &out, Ed25519Verifier{ID: "h1", Key: pub}); !errors.Is(err, ErrBadSignature) {
+			t.Fatalf("expected ErrBadSignature, got %v", err)
+		}
+	})
+}
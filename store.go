@@ -0,0 +1,149 @@
+package binary
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+
+	. "github.com/tinywasm/fmt"
+)
+
+// ErrNotFound is returned by Backend.Read and Store.Load when nothing has
+// been saved under the key yet.
+var ErrNotFound error = Err(D.Binary, "key not found")
+
+// Backend persists the encoded snapshots of a Store.
+type Backend interface {
+	// Read returns the data saved under key, or ErrNotFound.
+	Read(key string) ([]byte, error)
+	// Write replaces the data saved under key. Readers must see either the
+	// old or the new data, never a mix.
+	Write(key string, data []byte) error
+}
+
+// Store saves and loads a value of type T as a single snapshot. Payloads
+// carry the BinaryVersion header when T implements it, so older snapshots
+// are migrated on Load (see RegisterMigration), and the fingerprint header
+// when the store is created WithFingerprint.
+type Store[T any] struct {
+	backend Backend
+	key     string
+	codec   *Codec
+}
+
+// NewStore returns a store of the snapshot named key in backend, encoded with
+// a codec configured by opts.
+func NewStore[T any](backend Backend, key string, opts ...Option) *Store[T] {
+	return &Store[T]{backend: backend, key: key, codec: newWithOptions(opts)}
+}
+
+// Load decodes the saved snapshot. It returns the zero value and ErrNotFound
+// when nothing was saved yet.
+func (s *Store[T]) Load() (T, error) {
+	var v T
+	data, err := s.backend.Read(s.key)
+	if err != nil {
+		return v, err
+	}
+	if err = s.codec.Decode(data, &v); err != nil {
+		var zero T
+		return zero, err
+	}
+	return v, nil
+}
+
+// Save encodes v and atomically replaces the saved snapshot.
+func (s *Store[T]) Save(v T) error {
+	var data []byte
+	if err := s.codec.Encode(&v, &data); err != nil {
+		return err
+	}
+	return s.backend.Write(s.key, data)
+}
+
+// FileBackend stores each key as a file in Dir. Writes go to a temporary
+// file that is synced and renamed over the old one.
+type FileBackend struct {
+	Dir string
+}
+
+func (b FileBackend) path(key string) (string, error) {
+	if key == "" || key != filepath.Base(key) || key == "." || key == ".." {
+		return "", Err("FileBackend", "key", `"`+key+`"`, D.Invalid)
+	}
+	return filepath.Join(b.Dir, key), nil
+}
+
+func (b FileBackend) Read(key string) ([]byte, error) {
+	path, err := b.path(key)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+	return data, err
+}
+
+func (b FileBackend) Write(key string, data []byte) error {
+	path, err := b.path(key)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(b.Dir, key+".tmp*")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(data)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+	return err
+}
+
+// MemoryBackend keeps snapshots in memory, e.g. for tests. The zero value is
+// ready to use.
+type MemoryBackend struct {
+	mu      sync.Mutex
+	entries []memoryEntry // slice instead of map for TinyGo compatibility
+}
+
+type memoryEntry struct {
+	key  string
+	data []byte
+}
+
+func (b *MemoryBackend) Read(key string) ([]byte, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, e := range b.entries {
+		if e.key == key {
+			return append([]byte(nil), e.data...), nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (b *MemoryBackend) Write(key string, data []byte) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	data = append([]byte(nil), data...)
+	for i := range b.entries {
+		if b.entries[i].key == key {
+			b.entries[i].data = data
+			return nil
+		}
+	}
+	b.entries = append(b.entries, memoryEntry{key, data})
+	return nil
+}
@@ -0,0 +1,82 @@
+package binary
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+type appState struct {
+	Theme  string
+	Recent []string
+}
+
+func TestStoreMemory(t *testing.T) {
+	var backend MemoryBackend
+	s := NewStore[appState](&backend, "state")
+
+	got, err := s.Load()
+	if !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+	assertEqual(t, appState{}, got)
+
+	want := appState{Theme: "dark", Recent: []string{"a.txt"}}
+	assertNoError(t, s.Save(want))
+	got, err = s.Load()
+	assertNoError(t, err)
+	assertEqual(t, want, got)
+
+	want.Theme = "light"
+	assertNoError(t, s.Save(want))
+	got, err = s.Load()
+	assertNoError(t, err)
+	assertEqual(t, "light", got.Theme)
+
+	// Another key in the same backend is independent.
+	if _, err := NewStore[appState](&backend, "other").Load(); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestStoreFile(t *testing.T) {
+	dir := t.TempDir()
+	s := NewStore[appState](FileBackend{Dir: dir}, "state.bin", WithFingerprint(true))
+
+	want := appState{Theme: "dark"}
+	assertNoError(t, s.Save(want))
+	assertNoError(t, s.Save(want))
+	got, err := s.Load()
+	assertNoError(t, err)
+	assertEqual(t, want, got)
+
+	entries, err := os.ReadDir(dir)
+	assertNoError(t, err)
+	if len(entries) != 1 || entries[0].Name() != "state.bin" {
+		t.Fatalf("expected only the snapshot file, got %v", entries)
+	}
+
+	// A snapshot of another schema is rejected by the fingerprint header.
+	other := NewStore[frameMsg](FileBackend{Dir: dir}, "state.bin", WithFingerprint(true))
+	var mismatch *SchemaMismatchError
+	if _, err := other.Load(); !errors.As(err, &mismatch) {
+		t.Fatalf("expected *SchemaMismatchError, got %v", err)
+	}
+
+	if err := (FileBackend{Dir: dir}).Write("../escape", nil); err == nil {
+		t.Fatal("expected error for a key with a path")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "..", "escape")); !os.IsNotExist(err) {
+		t.Fatal("file written outside Dir")
+	}
+}
+
+func TestStoreMigratesOnLoad(t *testing.T) {
+	var backend MemoryBackend
+	assertNoError(t, NewStore[verUserV1](&backend, "user").Save(verUserV1{Name: "Ada Lovelace"}))
+
+	got, err := NewStore[verUser](&backend, "user").Load()
+	assertNoError(t, err)
+	assertEqual(t, verUser{First: "Ada", Last: "Lovelace", Age: -1}, got)
+}
@@ -0,0 +1,452 @@
+package binary
+
+import (
+	"bytes"
+	"math"
+	"reflect"
+
+	. "github.com/tinywasm/fmt"
+)
+
+// CBOR and MessagePack are produced by transcoding: values are encoded with
+// the native codec tree and the payload is rewritten item by item, walking
+// the cached Schema of the type. Decoding runs the same walk backwards, so
+// both formats share field skipping, marshalers and the schema cache with
+// the native format. Structs become maps keyed by field name (honouring
+// `json` tags), pointers are null when nil, and []byte and BinaryMarshaler
+// payloads are byte strings.
+
+// itemWriter appends self-describing items in CBOR or MessagePack.
+type itemWriter interface {
+	appendNil(b []byte) []byte
+	appendBool(b []byte, v bool) []byte
+	appendInt(b []byte, v int64) []byte
+	appendUint(b []byte, v uint64) []byte
+	appendFloat32(b []byte, v float32) []byte
+	appendFloat64(b []byte, v float64) []byte
+	appendString(b []byte, s string) []byte
+	appendBytes(b []byte, v []byte) []byte
+	appendArray(b []byte, n int) []byte
+	appendMap(b []byte, n int) []byte
+}
+
+// itemReader reads the head of the next item in CBOR or MessagePack. Strings
+// and byte strings are returned with their content, arrays and maps with
+// their number of elements or entries.
+type itemReader interface {
+	next(r *sliceReader) (item, error)
+}
+
+type itemKind uint8
+
+const (
+	itemNil itemKind = iota
+	itemBool
+	itemUint  // non-negative integer, in u
+	itemInt   // negative integer, in i
+	itemFloat // in f
+	itemString
+	itemBytes
+	itemArray
+	itemMap
+)
+
+var itemKindNames = [...]string{"null", "bool", "integer", "integer", "float", "string", "bytes", "array", "map"}
+
+type item struct {
+	kind itemKind
+	b    bool
+	u    uint64
+	i    int64
+	f    float64
+	data []byte // content of strings and byte strings
+	n    int    // elements of arrays, entries of maps
+}
+
+// maxItemDepth bounds the nesting of skipped items.
+const maxItemDepth = 100
+
+// formatName returns the name used in errors for f.
+func formatName(f Format) string {
+	switch f {
+	case FormatCBOR:
+		return "CBOR"
+	case FormatMsgPack:
+		return "MessagePack"
+	}
+	return "binary"
+}
+
+// schemaOf returns the cached schema descriptor of t, computing it on first
+// use.
+func (tb *instance) schemaOf(t reflect.Type) *Schema {
+	tb.mu.RLock()
+	for _, entry := range tb.schemas {
+		if entry.Type == t && entry.desc != nil {
+			tb.mu.RUnlock()
+			return entry.desc
+		}
+	}
+	tb.mu.RUnlock()
+
+	s := describeType(t)
+
+	tb.mu.Lock()
+	for i := range tb.schemas {
+		if tb.schemas[i].Type == t {
+			tb.schemas[i].desc = &s
+			break
+		}
+	}
+	tb.mu.Unlock()
+	return &s
+}
+
+// encodeItems encodes rv with its native codec and transcodes the result
+// with w.
+func (tb *instance) encodeItems(rv reflect.Value, name string, w itemWriter) ([]byte, error) {
+	c, err := tb.scanToCache(rv.Type(), name)
+	if err != nil {
+		return nil, err
+	}
+
+	var native bytes.Buffer
+	e := tb.encoders.Get().(*encoder)
+	e.reset(&native, tb)
+	if err = c.encodeTo(e, rv); err == nil {
+		err = e.err
+	}
+	tb.encoders.Put(e)
+	if err != nil {
+		return nil, err
+	}
+
+	t := transcoder{s: tb.schemaOf(rv.Type()), format: tb.format}
+	d := &decoder{reader: newSliceReader(native.Bytes())}
+	return t.appendItems(nil, w, d, 0)
+}
+
+// decodeItems transcodes data read with r into the native format and decodes
+// the result into rv.
+func (tb *instance) decodeItems(data []byte, rv reflect.Value, name string, r itemReader) error {
+	c, err := tb.scanToCache(rv.Type(), name)
+	if err != nil {
+		return err
+	}
+
+	t := transcoder{s: tb.schemaOf(rv.Type()), format: tb.format, r: r}
+	src := newSliceReader(data)
+	var native bytes.Buffer
+	e := newEncoder(&native)
+	if err = t.writeNative(e, src, 0); err != nil {
+		return err
+	}
+	if src.Len() > 0 {
+		return Err(formatName(tb.format), Convert(src.Len()).String(), "trailing bytes")
+	}
+
+	d := tb.decoders.Get().(*decoder)
+	d.reset(native.Bytes(), tb)
+	err = c.decodeTo(d, rv)
+	tb.decoders.Put(d)
+	return err
+}
+
+// transcoder converts between native payloads and items along a schema.
+type transcoder struct {
+	s      *Schema
+	format Format
+	r      itemReader
+}
+
+// appendItems reads node n from the native payload in d and appends it as
+// items.
+func (t *transcoder) appendItems(b []byte, w itemWriter, d *decoder, n int) ([]byte, error) {
+	node := &t.s.Nodes[n]
+	switch node.Kind {
+	case KindBool:
+		v, err := d.readBool()
+		return w.appendBool(b, v), err
+	case KindInt, KindUint:
+		enc, err := node.intEncoding()
+		if err != nil {
+			return nil, err
+		}
+		if node.Kind == KindInt {
+			v, err := d.readIntAs(enc)
+			return w.appendInt(b, v), err
+		}
+		v, err := d.readUintAs(enc)
+		return w.appendUint(b, v), err
+	case KindFloat32:
+		v, err := d.readFloat32()
+		return w.appendFloat32(b, v), err
+	case KindFloat64:
+		v, err := d.readFloat64()
+		return w.appendFloat64(b, v), err
+	case KindString:
+		v, err := d.readString()
+		return w.appendString(b, v), err
+	case KindBytes, KindMarshaler:
+		v, err := d.readSlice()
+		return w.appendBytes(b, v), err
+	case KindPointer:
+		isNil, err := d.readBool()
+		if err != nil || isNil {
+			return w.appendNil(b), err
+		}
+		return t.appendItems(b, w, d, node.Elem)
+	case KindSlice, KindArray, KindMap:
+		l := uint64(node.Len)
+		if node.Kind != KindArray {
+			var err error
+			if l, err = d.readUvarint(); err != nil {
+				return nil, err
+			}
+		}
+		if node.Kind == KindMap {
+			b = w.appendMap(b, int(l))
+		} else {
+			b = w.appendArray(b, int(l))
+		}
+		var err error
+		for i := uint64(0); i < l; i++ {
+			if node.Kind == KindMap {
+				if b, err = t.appendItems(b, w, d, node.Key); err != nil {
+					return nil, err
+				}
+			}
+			if b, err = t.appendItems(b, w, d, node.Elem); err != nil {
+				return nil, err
+			}
+		}
+		return b, nil
+	case KindStruct:
+		var err error
+		b = w.appendMap(b, len(node.Fields))
+		for _, f := range node.Fields {
+			b = w.appendString(b, f.jsonName())
+			if b, err = t.appendItems(b, w, d, f.Type); err != nil {
+				return nil, err
+			}
+		}
+		return b, nil
+	}
+	return nil, Err(formatName(t.format), node.Type, D.Type, D.Not, D.Supported)
+}
+
+// writeNative reads one item from src and writes it as node n in the native
+// format.
+func (t *transcoder) writeNative(e *encoder, src *sliceReader, n int) error {
+	node := &t.s.Nodes[n]
+	start := src.offset
+	it, err := t.r.next(src)
+	if err != nil {
+		return err
+	}
+
+	if it.kind == itemNil {
+		switch node.Kind {
+		case KindPointer:
+			e.writeBool(true)
+		case KindSlice, KindMap, KindBytes, KindMarshaler:
+			e.writeUvarint(0)
+		default:
+			return t.typeError(node, it)
+		}
+		return e.err
+	}
+
+	switch node.Kind {
+	case KindBool:
+		if it.kind != itemBool {
+			return t.typeError(node, it)
+		}
+		e.writeBool(it.b)
+	case KindInt:
+		var v int64
+		switch {
+		case it.kind == itemInt:
+			v = it.i
+		case it.kind == itemUint && it.u <= math.MaxInt64:
+			v = int64(it.u)
+		default:
+			return t.typeError(node, it)
+		}
+		if node.Bits < 64 && (v < -1<<(node.Bits-1) || v >= 1<<(node.Bits-1)) {
+			return t.rangeError(node)
+		}
+		enc, err := node.intEncoding()
+		if err != nil {
+			return err
+		}
+		return e.writeIntAs(enc, v)
+	case KindUint:
+		if it.kind != itemUint {
+			return t.typeError(node, it)
+		}
+		if node.Bits < 64 && it.u >= 1<<node.Bits {
+			return t.rangeError(node)
+		}
+		enc, err := node.intEncoding()
+		if err != nil {
+			return err
+		}
+		return e.writeUintAs(enc, it.u)
+	case KindFloat32, KindFloat64:
+		var v float64
+		switch it.kind {
+		case itemFloat:
+			v = it.f
+		case itemUint:
+			v = float64(it.u)
+		case itemInt:
+			v = float64(it.i)
+		default:
+			return t.typeError(node, it)
+		}
+		if node.Kind == KindFloat32 {
+			e.writeFloat32(float32(v))
+		} else {
+			e.writeFloat64(v)
+		}
+	case KindString:
+		if it.kind != itemString {
+			return t.typeError(node, it)
+		}
+		e.writeUvarint(uint64(len(it.data)))
+		e.write(it.data)
+	case KindBytes, KindMarshaler:
+		// Some MessagePack writers still send binary data as strings.
+		if it.kind != itemBytes && it.kind != itemString {
+			return t.typeError(node, it)
+		}
+		e.writeUvarint(uint64(len(it.data)))
+		e.write(it.data)
+	case KindPointer:
+		// Read the item again as the pointed-to node.
+		e.writeBool(false)
+		src.offset = start
+		return t.writeNative(e, src, node.Elem)
+	case KindSlice, KindArray:
+		if it.kind != itemArray {
+			return t.typeError(node, it)
+		}
+		if node.Kind == KindSlice {
+			e.writeUvarint(uint64(it.n))
+		} else if it.n != node.Len {
+			return Err(formatName(t.format), node.Type, "expects", Convert(node.Len).String(), "elements")
+		}
+		for i := 0; i < it.n; i++ {
+			if err := t.writeNative(e, src, node.Elem); err != nil {
+				return err
+			}
+		}
+	case KindMap:
+		if it.kind != itemMap {
+			return t.typeError(node, it)
+		}
+		e.writeUvarint(uint64(it.n))
+		for i := 0; i < it.n; i++ {
+			if err := t.writeNative(e, src, node.Key); err != nil {
+				return err
+			}
+			if err := t.writeNative(e, src, node.Elem); err != nil {
+				return err
+			}
+		}
+	case KindStruct:
+		if it.kind != itemMap {
+			return t.typeError(node, it)
+		}
+		return t.writeNativeStruct(e, src, node, it.n)
+	default:
+		return Err(formatName(t.format), node.Type, D.Type, D.Not, D.Supported)
+	}
+	return e.err
+}
+
+// writeNativeStruct writes the fields of a struct from a map of n entries.
+// Entries may come in any order, unknown keys are skipped and missing fields
+// are written as zero values.
+func (t *transcoder) writeNativeStruct(e *encoder, src *sliceReader, node *Node, n int) error {
+	offsets := make([]int64, len(node.Fields))
+	for i := 0; i < n; i++ {
+		key, err := t.r.next(src)
+		if err != nil {
+			return err
+		}
+		if key.kind != itemString {
+			return Err(formatName(t.format), node.Type, "field name", D.Invalid)
+		}
+		if f := fieldByJSONName(node.Fields, string(key.data)); f >= 0 {
+			offsets[f] = src.offset + 1 // 0 means missing
+		}
+		if err := t.skip(src, 0); err != nil {
+			return err
+		}
+	}
+
+	end := src.offset
+	for i, f := range node.Fields {
+		if offsets[i] == 0 {
+			if err := e.encodeJSONZero(t.s, f.Type, false, 0); err != nil {
+				return err
+			}
+			continue
+		}
+		src.offset = offsets[i] - 1
+		if err := t.writeNative(e, src, f.Type); err != nil {
+			return err
+		}
+	}
+	src.offset = end
+	return e.err
+}
+
+// skip reads past the next item, including the elements of arrays and maps.
+func (t *transcoder) skip(src *sliceReader, depth int) error {
+	if depth > maxItemDepth {
+		return Err(formatName(t.format), "items nested too deeply")
+	}
+	it, err := t.r.next(src)
+	if err != nil {
+		return err
+	}
+	count := it.n
+	switch it.kind {
+	case itemMap:
+		count *= 2
+	case itemArray:
+	default:
+		return nil
+	}
+	for i := 0; i < count; i++ {
+		if err := t.skip(src, depth+1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *transcoder) typeError(node *Node, it item) error {
+	return Err(formatName(t.format), "cannot use", itemKindNames[it.kind], "as", node.Kind.String(), "("+node.Type+")")
+}
+
+func (t *transcoder) rangeError(node *Node) error {
+	return Err(formatName(t.format), "value", D.Out, D.Of, D.Range, "for", node.Type)
+}
+
+// errItemTruncated is returned when an item ends past the end of the input.
+func errItemTruncated(f Format) error {
+	return Err(formatName(f), "truncated input")
+}
+
+// readItemLength checks that a length read from a head fits in the bytes
+// left in src, each element taking at least one byte.
+func readItemLength(src *sliceReader, l uint64, f Format) (int, error) {
+	if l > uint64(src.Len()) {
+		return 0, errItemTruncated(f)
+	}
+	return int(l), nil
+}
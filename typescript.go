@@ -0,0 +1,530 @@
+package binary
+
+import (
+	"bytes"
+	"strconv"
+
+	. "github.com/tinywasm/fmt"
+)
+
+// GenerateTypeScript returns a TypeScript module with a class for every
+// struct reachable from the given schemas, each with encode(): Uint8Array,
+// static decode(buf), and encodeTo/decodeFrom for nesting. The classes read
+// and write the native format through the Writer and Reader classes emitted
+// at the top of the module.
+//
+// Fields use their `json` tag name when it is a valid identifier. Ints and
+// uints up to 32 bits are numbers, 64-bit ones (including int and uint) are
+// bigints. Pointers are T | null, []byte is Uint8Array and maps are Map.
+// Roots with a BinaryVersion write and check the version header; the
+// WithFingerprint header and the compression envelope are not supported.
+func GenerateTypeScript(schemas ...Schema) ([]byte, error) {
+	return generateScript(schemas, true)
+}
+
+// GenerateJavaScript is GenerateTypeScript without type annotations, as a
+// plain ES module.
+func GenerateJavaScript(schemas ...Schema) ([]byte, error) {
+	return generateScript(schemas, false)
+}
+
+// scriptRuntime is the Writer and Reader pair shared by generated classes.
+// Type annotations are written as {{...}} and dropped for JavaScript.
+const scriptRuntime = `const textEncoder = new TextEncoder();
+const textDecoder = new TextDecoder();
+
+export class Writer {
+  buf{{: Uint8Array}} = new Uint8Array(64);
+  view{{: DataView}} = new DataView(this.buf.buffer);
+  len{{: number}} = 0;
+
+  finish(){{: Uint8Array}} {
+    return this.buf.slice(0, this.len);
+  }
+
+  grow(n{{: number}}){{: void}} {
+    if (this.len + n <= this.buf.length) return;
+    let size = this.buf.length * 2;
+    while (size < this.len + n) size *= 2;
+    const next = new Uint8Array(size);
+    next.set(this.buf.subarray(0, this.len));
+    this.buf = next;
+    this.view = new DataView(next.buffer);
+  }
+
+  byte(b{{: number}}){{: void}} {
+    this.grow(1);
+    this.buf[this.len++] = b;
+  }
+
+  bool(v{{: boolean}}){{: void}} {
+    this.byte(v ? 1 : 0);
+  }
+
+  uvarint(v{{: number}}){{: void}} {
+    if (!Number.isSafeInteger(v) || v < 0) throw new RangeError("binary: invalid unsigned integer " + v);
+    while (v >= 0x80) {
+      this.byte((v % 0x80) | 0x80);
+      v = Math.floor(v / 0x80);
+    }
+    this.byte(v);
+  }
+
+  varint(v{{: number}}){{: void}} {
+    if (!Number.isSafeInteger(v)) throw new RangeError("binary: invalid integer " + v);
+    this.uvarint(v >= 0 ? v * 2 : -v * 2 - 1);
+  }
+
+  uvarint64(v{{: bigint}}){{: void}} {
+    if (v < 0n || v >= 1n << 64n) throw new RangeError("binary: invalid uint64 " + v);
+    while (v >= 0x80n) {
+      this.byte(Number(v & 0x7fn) | 0x80);
+      v >>= 7n;
+    }
+    this.byte(Number(v));
+  }
+
+  varint64(v{{: bigint}}){{: void}} {
+    if (v < -(1n << 63n) || v >= 1n << 63n) throw new RangeError("binary: invalid int64 " + v);
+    this.uvarint64(v >= 0n ? v << 1n : (-v << 1n) - 1n);
+  }
+
+  fixed(v{{: number | bigint}}, size{{: number}}, signed{{: boolean}}, be{{: boolean}}){{: void}} {
+    const bits = BigInt(size * 8);
+    const min = signed ? -(1n << (bits - 1n)) : 0n;
+    let x = BigInt(v);
+    if (x < min || x >= min + (1n << bits)) throw new RangeError("binary: " + v + " overflows " + size * 8 + " bits");
+    x = BigInt.asUintN(size * 8, x);
+    this.grow(size);
+    for (let i = 0; i < size; i++) {
+      this.buf[this.len + (be ? size - 1 - i : i)] = Number(x & 0xffn);
+      x >>= 8n;
+    }
+    this.len += size;
+  }
+
+  float32(v{{: number}}){{: void}} {
+    this.grow(4);
+    this.view.setFloat32(this.len, v, true);
+    this.len += 4;
+  }
+
+  float64(v{{: number}}){{: void}} {
+    this.grow(8);
+    this.view.setFloat64(this.len, v, true);
+    this.len += 8;
+  }
+
+  bytes(v{{: Uint8Array}}){{: void}} {
+    this.uvarint(v.length);
+    this.grow(v.length);
+    this.buf.set(v, this.len);
+    this.len += v.length;
+  }
+
+  string(v{{: string}}){{: void}} {
+    this.bytes(textEncoder.encode(v));
+  }
+}
+
+export class Reader {
+  buf{{: Uint8Array}};
+  view{{: DataView}};
+  pos{{: number}} = 0;
+
+  constructor(buf{{: Uint8Array}}) {
+    this.buf = buf;
+    this.view = new DataView(buf.buffer, buf.byteOffset, buf.byteLength);
+  }
+
+  take(n{{: number}}){{: Uint8Array}} {
+    if (n > this.buf.length - this.pos) throw new RangeError("binary: unexpected end of data");
+    const out = this.buf.subarray(this.pos, this.pos + n);
+    this.pos += n;
+    return out;
+  }
+
+  byte(){{: number}} {
+    return this.take(1)[0];
+  }
+
+  bool(){{: boolean}} {
+    return this.byte() === 1;
+  }
+
+  uvarint(){{: number}} {
+    let x = 0;
+    let s = 1;
+    for (let i = 0; i < 8; i++) {
+      const b = this.byte();
+      x += (b & 0x7f) * s;
+      if (b < 0x80) {
+        if (!Number.isSafeInteger(x)) break;
+        return x;
+      }
+      s *= 0x80;
+    }
+    throw new RangeError("binary: varint overflows a number");
+  }
+
+  varint(){{: number}} {
+    const u = this.uvarint();
+    return u % 2 === 0 ? u / 2 : -(u + 1) / 2;
+  }
+
+  uvarint64(){{: bigint}} {
+    let x = 0n;
+    for (let i = 0; i < 10; i++) {
+      const b = this.byte();
+      if (b < 0x80) {
+        if (i === 9 && b > 1) break;
+        return x | (BigInt(b) << BigInt(7 * i));
+      }
+      x |= BigInt(b & 0x7f) << BigInt(7 * i);
+    }
+    throw new RangeError("binary: varint overflows a 64-bit integer");
+  }
+
+  varint64(){{: bigint}} {
+    const u = this.uvarint64();
+    return u & 1n ? -(u >> 1n) - 1n : u >> 1n;
+  }
+
+  fixed(size{{: number}}, signed{{: boolean}}, be{{: boolean}}){{: bigint}} {
+    const b = this.take(size);
+    let x = 0n;
+    for (let i = 0; i < size; i++) x = (x << 8n) | BigInt(b[be ? i : size - 1 - i]);
+    return signed ? BigInt.asIntN(size * 8, x) : x;
+  }
+
+  float32(){{: number}} {
+    const v = this.view.getFloat32(this.pos, true);
+    this.take(4);
+    return v;
+  }
+
+  float64(){{: number}} {
+    const v = this.view.getFloat64(this.pos, true);
+    this.take(8);
+    return v;
+  }
+
+  bytes(){{: Uint8Array}} {
+    return this.take(this.uvarint()).slice();
+  }
+
+  string(){{: string}} {
+    return textDecoder.decode(this.take(this.uvarint()));
+  }
+}
+`
+
+// scriptGen accumulates the classes of a generated module.
+type scriptGen struct {
+	genTypes
+	out bytes.Buffer
+	tmp int // counter for temporaries in decodeFrom
+}
+
+func generateScript(schemas []Schema, types bool) ([]byte, error) {
+	g := &scriptGen{genTypes: genTypes{op: "GenerateTypeScript", reserved: []string{"Writer", "Reader"}}}
+	if err := g.collectRoots(schemas); err != nil {
+		return nil, err
+	}
+
+	g.out.WriteString("// Code generated by github.com/tinywasm/binary. DO NOT EDIT.\n\n")
+	g.out.WriteString(scriptRuntime)
+	for i := range g.list {
+		if err := g.writeClass(&g.list[i]); err != nil {
+			return nil, err
+		}
+	}
+	return stripTypes(g.out.Bytes(), types), nil
+}
+
+// scriptFieldName returns the property name of f: its json name when that
+// is a valid identifier, else the Go field name.
+func scriptFieldName(f Field) string {
+	name := f.jsonName()
+	for i := 0; i < len(name); i++ {
+		if !isIdentByte(name[i], i == 0) {
+			return f.Name
+		}
+	}
+	return name
+}
+
+func (g *scriptGen) writeClass(c *genType) error {
+	node := &c.s.Nodes[c.node]
+	w := &g.out
+	w.WriteString("\nexport class " + c.name + " {\n")
+	for _, f := range node.Fields {
+		typ, err := g.typeOf(c.s, f.Type)
+		if err != nil {
+			return err
+		}
+		w.WriteString("  " + scriptFieldName(f) + "{{: " + typ + "}} = " + g.zeroOf(c.s, f.Type) + ";\n")
+	}
+
+	w.WriteString("\n  constructor(init{{?: Partial<" + c.name + ">}}) {\n    if (init) Object.assign(this, init);\n  }\n")
+
+	w.WriteString("\n  encode(){{: Uint8Array}} {\n    const w = new Writer();\n")
+	if c.versioned {
+		w.WriteString("    w.uvarint(" + strconv.FormatUint(uint64(c.version), 10) + ");\n")
+	}
+	w.WriteString("    this.encodeTo(w);\n    return w.finish();\n  }\n")
+
+	w.WriteString("\n  encodeTo(w{{: Writer}}){{: void}} {\n")
+	for _, f := range node.Fields {
+		g.encodeNode(c.s, f.Type, "this."+scriptFieldName(f), "    ", 0)
+	}
+	w.WriteString("  }\n")
+
+	w.WriteString("\n  static decode(buf{{: Uint8Array}}){{: " + c.name + "}} {\n    const r = new Reader(buf);\n")
+	if c.versioned {
+		version := strconv.FormatUint(uint64(c.version), 10)
+		w.WriteString("    const version = r.uvarint();\n")
+		w.WriteString("    if (version !== " + version + ") throw new Error(\"binary: " + c.name + " version \" + version + \", want " + version + "\");\n")
+	}
+	w.WriteString("    return " + c.name + ".decodeFrom(r);\n  }\n")
+
+	w.WriteString("\n  static decodeFrom(r{{: Reader}}){{: " + c.name + "}} {\n    const v = new " + c.name + "();\n")
+	g.tmp = 0
+	for _, f := range node.Fields {
+		expr := g.decodeNode(c.s, f.Type, "    ")
+		w.WriteString("    v." + scriptFieldName(f) + " = " + expr + ";\n")
+	}
+	w.WriteString("    return v;\n  }\n}\n")
+	return nil
+}
+
+// typeOf returns the TypeScript type of node n.
+func (g *scriptGen) typeOf(s *Schema, n int) (string, error) {
+	node := &s.Nodes[n]
+	switch node.Kind {
+	case KindBool:
+		return "boolean", nil
+	case KindInt, KindUint:
+		if node.Bits > 32 {
+			return "bigint", nil
+		}
+		return "number", nil
+	case KindFloat32, KindFloat64:
+		return "number", nil
+	case KindString:
+		return "string", nil
+	case KindBytes, KindMarshaler:
+		return "Uint8Array", nil
+	case KindPointer:
+		elem, err := g.typeOf(s, node.Elem)
+		return elem + " | null", err
+	case KindSlice, KindArray:
+		elem, err := g.typeOf(s, node.Elem)
+		if Contains(elem, " ") {
+			elem = "(" + elem + ")"
+		}
+		return elem + "[]", err
+	case KindMap:
+		switch s.Nodes[node.Key].Kind {
+		case KindBool, KindInt, KindUint, KindFloat32, KindFloat64, KindString:
+		default:
+			return "", Err("GenerateTypeScript", "map key", s.Nodes[node.Key].Type, D.Not, D.Supported)
+		}
+		key, err := g.typeOf(s, node.Key)
+		if err != nil {
+			return "", err
+		}
+		elem, err := g.typeOf(s, node.Elem)
+		return "Map<" + key + ", " + elem + ">", err
+	case KindStruct:
+		return g.byGoType(node.Type).name, nil
+	}
+	return "", Err("GenerateTypeScript", node.Type, D.Type, D.Not, D.Supported)
+}
+
+// zeroOf returns an expression for the zero value of node n.
+func (g *scriptGen) zeroOf(s *Schema, n int) string {
+	node := &s.Nodes[n]
+	switch node.Kind {
+	case KindBool:
+		return "false"
+	case KindInt, KindUint:
+		if node.Bits > 32 {
+			return "0n"
+		}
+		return "0"
+	case KindFloat32, KindFloat64:
+		return "0"
+	case KindString:
+		return `""`
+	case KindBytes, KindMarshaler:
+		return "new Uint8Array(0)"
+	case KindPointer:
+		return "null"
+	case KindSlice:
+		return "[]"
+	case KindArray:
+		return "Array.from({ length: " + strconv.Itoa(node.Len) + " }, () => " + g.zeroOf(s, node.Elem) + ")"
+	case KindMap:
+		return "new Map()"
+	case KindStruct:
+		return "new " + g.byGoType(node.Type).name + "()"
+	}
+	return "undefined"
+}
+
+// encodeNode writes the statements that encode expr as node n.
+func (g *scriptGen) encodeNode(s *Schema, n int, expr, indent string, depth int) {
+	node := &s.Nodes[n]
+	w := &g.out
+	d := strconv.Itoa(depth)
+	switch node.Kind {
+	case KindBool:
+		w.WriteString(indent + "w.bool(" + expr + ");\n")
+	case KindInt, KindUint:
+		enc, _ := node.intEncoding()
+		switch {
+		case enc.size > 0:
+			w.WriteString(indent + "w.fixed(" + expr + ", " + strconv.Itoa(enc.size) + ", " + strconv.FormatBool(node.Kind == KindInt) + ", " + strconv.FormatBool(enc.bigEndian) + ");\n")
+		case enc.plain && node.Bits > 32:
+			w.WriteString(indent + "w.uvarint64(BigInt.asUintN(64, " + expr + "));\n")
+		case enc.plain:
+			w.WriteString(indent + "w.uvarint64(BigInt.asUintN(64, BigInt(" + expr + ")));\n")
+		case node.Kind == KindInt:
+			w.WriteString(indent + "w." + scriptIntMethod("varint", node.Bits) + "(" + expr + ");\n")
+		default:
+			w.WriteString(indent + "w." + scriptIntMethod("uvarint", node.Bits) + "(" + expr + ");\n")
+		}
+	case KindFloat32:
+		w.WriteString(indent + "w.float32(" + expr + ");\n")
+	case KindFloat64:
+		w.WriteString(indent + "w.float64(" + expr + ");\n")
+	case KindString:
+		w.WriteString(indent + "w.string(" + expr + ");\n")
+	case KindBytes, KindMarshaler:
+		w.WriteString(indent + "w.bytes(" + expr + ");\n")
+	case KindPointer:
+		w.WriteString(indent + "if (" + expr + " === null) {\n" + indent + "  w.bool(true);\n" + indent + "} else {\n" + indent + "  w.bool(false);\n")
+		g.encodeNode(s, node.Elem, expr, indent+"  ", depth)
+		w.WriteString(indent + "}\n")
+	case KindSlice, KindArray:
+		if node.Kind == KindSlice {
+			w.WriteString(indent + "w.uvarint(" + expr + ".length);\n")
+		} else {
+			l := strconv.Itoa(node.Len)
+			w.WriteString(indent + "if (" + expr + ".length !== " + l + ") throw new RangeError(\"binary: " + node.Type + " needs " + l + " elements\");\n")
+		}
+		w.WriteString(indent + "for (const e" + d + " of " + expr + ") {\n")
+		g.encodeNode(s, node.Elem, "e"+d, indent+"  ", depth+1)
+		w.WriteString(indent + "}\n")
+	case KindMap:
+		w.WriteString(indent + "w.uvarint(" + expr + ".size);\n")
+		w.WriteString(indent + "for (const [k" + d + ", e" + d + "] of " + expr + ") {\n")
+		g.encodeNode(s, node.Key, "k"+d, indent+"  ", depth+1)
+		g.encodeNode(s, node.Elem, "e"+d, indent+"  ", depth+1)
+		w.WriteString(indent + "}\n")
+	case KindStruct:
+		w.WriteString(indent + expr + ".encodeTo(w);\n")
+	}
+}
+
+// decodeNode writes the statements needed to decode node n and returns the
+// expression holding the result.
+func (g *scriptGen) decodeNode(s *Schema, n int, indent string) string {
+	node := &s.Nodes[n]
+	w := &g.out
+	switch node.Kind {
+	case KindBool:
+		return "r.bool()"
+	case KindInt, KindUint:
+		enc, _ := node.intEncoding()
+		read := ""
+		switch {
+		case enc.size > 0:
+			read = "r.fixed(" + strconv.Itoa(enc.size) + ", " + strconv.FormatBool(node.Kind == KindInt) + ", " + strconv.FormatBool(enc.bigEndian) + ")"
+		case enc.plain:
+			read = "BigInt.asIntN(64, r.uvarint64())"
+		case node.Kind == KindInt:
+			return "r." + scriptIntMethod("varint", node.Bits) + "()"
+		default:
+			return "r." + scriptIntMethod("uvarint", node.Bits) + "()"
+		}
+		if node.Bits > 32 {
+			return read
+		}
+		return "Number(" + read + ")"
+	case KindFloat32:
+		return "r.float32()"
+	case KindFloat64:
+		return "r.float64()"
+	case KindString:
+		return "r.string()"
+	case KindBytes, KindMarshaler:
+		return "r.bytes()"
+	case KindPointer:
+		d := g.temp()
+		typ, _ := g.typeOf(s, n)
+		w.WriteString(indent + "let p" + d + "{{: " + typ + "}} = null;\n")
+		w.WriteString(indent + "if (!r.bool()) {\n")
+		elem := g.decodeNode(s, node.Elem, indent+"  ")
+		w.WriteString(indent + "  p" + d + " = " + elem + ";\n" + indent + "}\n")
+		return "p" + d
+	case KindSlice, KindArray:
+		d := g.temp()
+		typ, _ := g.typeOf(s, n)
+		count := "r.uvarint()"
+		if node.Kind == KindArray {
+			count = strconv.Itoa(node.Len)
+		}
+		w.WriteString(indent + "const a" + d + "{{: " + typ + "}} = [];\n")
+		w.WriteString(indent + "for (let i" + d + " = " + count + "; i" + d + " > 0; i" + d + "--) {\n")
+		elem := g.decodeNode(s, node.Elem, indent+"  ")
+		w.WriteString(indent + "  a" + d + ".push(" + elem + ");\n" + indent + "}\n")
+		return "a" + d
+	case KindMap:
+		d := g.temp()
+		typ, _ := g.typeOf(s, n)
+		w.WriteString(indent + "const m" + d + "{{: " + typ + "}} = new Map();\n")
+		w.WriteString(indent + "for (let i" + d + " = r.uvarint(); i" + d + " > 0; i" + d + "--) {\n")
+		key := g.decodeNode(s, node.Key, indent+"  ")
+		w.WriteString(indent + "  const k" + d + " = " + key + ";\n")
+		elem := g.decodeNode(s, node.Elem, indent+"  ")
+		w.WriteString(indent + "  m" + d + ".set(k" + d + ", " + elem + ");\n" + indent + "}\n")
+		return "m" + d
+	case KindStruct:
+		return g.byGoType(node.Type).name + ".decodeFrom(r)"
+	}
+	return "undefined"
+}
+
+// temp returns a new suffix for temporaries of the current decodeFrom.
+func (g *scriptGen) temp() string {
+	g.tmp++
+	return strconv.Itoa(g.tmp - 1)
+}
+
+// scriptIntMethod picks the number or bigint variant of a varint method.
+func scriptIntMethod(method string, bits int) string {
+	if bits > 32 {
+		return method + "64"
+	}
+	return method
+}
+
+// stripTypes resolves {{...}} annotations: kept without the braces for
+// TypeScript, removed for JavaScript.
+func stripTypes(src []byte, types bool) []byte {
+	out := make([]byte, 0, len(src))
+	for {
+		i := bytes.Index(src, []byte("{{"))
+		if i < 0 {
+			return append(out, src...)
+		}
+		j := bytes.Index(src[i:], []byte("}}"))
+		out = append(out, src[:i]...)
+		if types {
+			out = append(out, src[i+2:i+j]...)
+		}
+		src = src[i+j+2:]
+	}
+}
@@ -0,0 +1,156 @@
+package binary
+
+import (
+	"encoding/hex"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type tsAddress struct {
+	City string `json:"city"`
+	Zip  uint16
+}
+
+type tsUser struct {
+	ID     int64  `json:"id"`
+	Name   string `json:"name"`
+	Age    int32
+	Score  float64
+	Ratio  float32
+	Admin  bool
+	Tags   []string
+	Addr   *tsAddress
+	Home   tsAddress
+	Raw    []byte
+	Counts map[string]uint64
+	Grid   [2]int8
+	Nested []*tsAddress
+	Inline struct{ A uint8 }
+	Skip   string `binary:"-"`
+	Big    uint64
+	Odd    int     `json:"odd-name"`
+	Hash   uint32  `binary:"fixed32"`
+	Port   uint16  `binary:"be"`
+	Delta  int64   `binary:"uvarint"`
+	Seq    []int16 `binary:"fixed32,be"`
+}
+
+func (*tsUser) BinaryVersion() uint { return 3 }
+
+func TestGenerateTypeScript(t *testing.T) {
+	ts, err := GenerateTypeScript(DescribeType(&tsUser{}))
+	assertNoError(t, err)
+	src := string(ts)
+
+	for _, want := range []string{
+		"export class TsUser {",
+		"export class TsAddress {",
+		"export class TsUserInline {",
+		"  id: bigint = 0n;",
+		"  Age: number = 0;",
+		"  Addr: TsAddress | null = null;",
+		"  Nested: (TsAddress | null)[] = [];",
+		"  Counts: Map<string, bigint> = new Map();",
+		"  Grid: number[] = Array.from({ length: 2 }, () => 0);",
+		"  Odd: bigint = 0n;",
+		"  encode(): Uint8Array {",
+		"    w.uvarint(3);",
+		"  static decode(buf: Uint8Array): TsUser {",
+	} {
+		if !strings.Contains(src, want) {
+			t.Errorf("generated TypeScript lacks %q", want)
+		}
+	}
+	if strings.Contains(src, "Skip") || strings.Contains(src, "{{") {
+		t.Error("generated TypeScript has skipped fields or unresolved annotations")
+	}
+
+	js, err := GenerateJavaScript(DescribeType(&tsUser{}))
+	assertNoError(t, err)
+	if strings.Contains(string(js), ": bigint") || !strings.Contains(string(js), "  id = 0n;") {
+		t.Error("generated JavaScript has type annotations")
+	}
+
+	if _, err := GenerateTypeScript(DescribeType(0)); err == nil {
+		t.Error("expected error for a non-struct root")
+	}
+	type badKey struct{ M map[tsAddress]int }
+	if _, err := GenerateTypeScript(DescribeType(badKey{})); err == nil {
+		t.Error("expected error for a struct map key")
+	}
+}
+
+// TestGeneratedScriptGolden runs the generated JavaScript under node against
+// byte vectors produced by Encode.
+func TestGeneratedScriptGolden(t *testing.T) {
+	node, err := exec.LookPath("node")
+	if err != nil {
+		t.Skip("node not installed")
+	}
+
+	values := []tsUser{
+		{},
+		{
+			ID: -1 << 62, Name: "Zoë", Age: -2147483648, Score: -0.1, Ratio: 3.25,
+			Admin: true, Tags: []string{"a", ""}, Addr: &tsAddress{City: "Lima", Zip: 65535},
+			Home: tsAddress{City: "x"}, Raw: []byte{0, 255}, Counts: map[string]uint64{"k": 1<<64 - 1},
+			Grid: [2]int8{-128, 127}, Nested: []*tsAddress{nil, {Zip: 1}}, Big: 300,
+			Hash: 0xdeadbeef, Port: 8080, Delta: -5, Seq: []int16{-1, 2}, Odd: 1 << 53,
+		},
+	}
+	values[1].Inline.A = 200
+
+	var golden []string
+	for i := range values {
+		var data []byte
+		assertNoError(t, Encode(&values[i], &data))
+		golden = append(golden, hex.EncodeToString(data))
+	}
+	var built []byte
+	assertNoError(t, Encode(&tsUser{ID: 7, Name: "js", Tags: []string{"t"}, Addr: &tsAddress{City: "c"}}, &built))
+
+	js, err := GenerateJavaScript(DescribeType(&tsUser{}))
+	assertNoError(t, err)
+
+	dir := t.TempDir()
+	assertNoError(t, os.WriteFile(filepath.Join(dir, "gen.mjs"), js, 0o644))
+	script := `import { TsUser, TsAddress } from "./gen.mjs";
+const fromHex = (h) => Uint8Array.from(h.match(/../g) || [], (b) => parseInt(b, 16));
+const toHex = (b) => Array.from(b, (x) => x.toString(16).padStart(2, "0")).join("");
+for (const h of process.argv.slice(2)) {
+  console.log(toHex(TsUser.decode(fromHex(h)).encode()));
+}
+const u = new TsUser({ id: 7n, name: "js", Tags: ["t"], Addr: new TsAddress({ city: "c" }) });
+console.log(toHex(u.encode()));
+const d = TsUser.decode(fromHex(process.argv[3]));
+console.log(d.name, d.id, d.Counts.get("k"), d.Nested[0], d.Nested[1].Zip, d.Inline.A, d.Odd);
+try {
+  TsUser.decode(fromHex("01"));
+  console.log("no version error");
+} catch (e) {
+  console.log("version error");
+}
+`
+	assertNoError(t, os.WriteFile(filepath.Join(dir, "test.mjs"), []byte(script), 0o644))
+
+	cmd := exec.Command(node, append([]string{"test.mjs"}, golden...)...)
+	cmd.Dir = dir
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("node: %v\n%s", err, out)
+	}
+
+	lines := strings.Split(strings.TrimSpace(string(out)), "\n")
+	want := append(golden,
+		hex.EncodeToString(built),
+		"Zoë -4611686018427387904n 18446744073709551615n null 1 200 9007199254740992n",
+		"version error",
+	)
+	assertEqual(t, len(want), len(lines))
+	for i := range want {
+		assertEqual(t, want[i], lines[i])
+	}
+}
@@ -0,0 +1,148 @@
+package binary
+
+import (
+	"reflect"
+	"sync"
+
+	. "github.com/tinywasm/fmt"
+)
+
+// versionedHandler is implemented by types that carry a schema version. The
+// version is written as a uvarint header before the value, and Decode runs the
+// registered migrations when a payload holds an older version.
+type versionedHandler interface {
+	BinaryVersion() uint
+}
+
+var versionedHandlerType = reflect.TypeOf((*versionedHandler)(nil)).Elem()
+
+// typeVersion returns the BinaryVersion of t and whether t is versioned. It
+// checks the method set of *T, so a pointer receiver also versions values
+// passed by value.
+func typeVersion(t reflect.Type) (uint, bool) {
+	if t.Kind() == reflect.Interface || !reflect.PointerTo(t).Implements(versionedHandlerType) {
+		return 0, false
+	}
+	return reflect.New(t).Interface().(versionedHandler).BinaryVersion(), true
+}
+
+// migration converts a decoded value of version from into version to.
+type migration struct {
+	from, to uint
+	oldType  reflect.Type
+	newType  reflect.Type
+	apply    func(any) (any, error)
+}
+
+var (
+	migrations   []migration // slice-based registry for TinyGo compatibility
+	migrationsMu sync.RWMutex
+)
+
+// RegisterMigration registers fn to upgrade values written as version from,
+// with the Old layout, into version to, with the New layout. Decode chains
+// migrations until it reaches the BinaryVersion of the target type, following
+// only chains that end in that type; each source version can be registered
+// once per New type:
+//
+//	binary.RegisterMigration(1, 2, func(o *UserV1) (*User, error) {
+//		return &User{Name: o.Name}, nil
+//	})
+func RegisterMigration[Old, New any](from, to uint, fn func(*Old) (*New, error)) error {
+	if fn == nil {
+		return Err("RegisterMigration", "function", D.Nil)
+	}
+	if to <= from {
+		return Err("RegisterMigration", "target version must be greater than source version")
+	}
+
+	m := migration{
+		from:    from,
+		to:      to,
+		oldType: reflect.TypeOf((*Old)(nil)).Elem(),
+		newType: reflect.TypeOf((*New)(nil)).Elem(),
+		apply: func(v any) (any, error) {
+			out, err := fn(v.(*Old))
+			if err == nil && out == nil {
+				err = Err("migration", "returned", D.Nil)
+			}
+			return out, err
+		},
+	}
+
+	migrationsMu.Lock()
+	defer migrationsMu.Unlock()
+	for _, existing := range migrations {
+		if existing.from == from && existing.newType == m.newType {
+			return Err("RegisterMigration", "duplicate migration from version", Convert(from).String(), "to", m.newType.String())
+		}
+	}
+	migrations = append(migrations, m)
+	return nil
+}
+
+// migrationChain returns the migrations that upgrade values written as
+// version from into version to, ending with a value of type target, or nil
+// when no registered chain does. Chains are keyed on the target type, so
+// several types can migrate from the same version.
+func migrationChain(from, to uint, target reflect.Type) []migration {
+	migrationsMu.RLock()
+	defer migrationsMu.RUnlock()
+	return findChain(from, to, nil, target)
+}
+
+// findChain searches the registry for migrationChain. When old is not nil the
+// first migration must accept values of that type.
+func findChain(from, to uint, old, target reflect.Type) []migration {
+	for _, m := range migrations {
+		if m.from != from || m.to > to || (old != nil && m.oldType != old) {
+			continue
+		}
+		if m.to == to {
+			if m.newType == target {
+				return []migration{m}
+			}
+			continue
+		}
+		if rest := findChain(m.to, to, m.newType, target); rest != nil {
+			return append([]migration{m}, rest...)
+		}
+	}
+	return nil
+}
+
+// migrate decodes a payload written as version into the layout registered for
+// it and runs the migration chain up to version current, storing the result in rv.
+func (d *decoder) migrate(version, current uint, rv reflect.Value) error {
+	if version > current {
+		return Err(rv.Type().String(), "payload version", Convert(version).String(), "is newer than", Convert(current).String())
+	}
+
+	chain := migrationChain(version, current, rv.Type())
+	if chain == nil {
+		return Err(rv.Type().String(), "no migration from version", Convert(version).String())
+	}
+
+	oldType := chain[0].oldType
+	c, err := d.scanToCache(oldType, "")
+	if err != nil {
+		return err
+	}
+	if err = d.checkFingerprint(oldType); err != nil {
+		return err
+	}
+
+	old := reflect.New(oldType)
+	if err = c.decodeTo(d, old.Elem()); err != nil {
+		return err
+	}
+
+	value := old.Interface()
+	for _, m := range chain {
+		if value, err = m.apply(value); err != nil {
+			return err
+		}
+	}
+	rv.Set(reflect.ValueOf(value).Elem())
+	return nil
+}
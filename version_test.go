@@ -0,0 +1,227 @@
+package binary
+
+import (
+	"strings"
+	"testing"
+)
+
+type verUserV1 struct {
+	Name string
+}
+
+func (*verUserV1) BinaryVersion() uint { return 1 }
+
+type verUserV2 struct {
+	First string
+	Last  string
+}
+
+func (*verUserV2) BinaryVersion() uint { return 2 }
+
+type verUser struct {
+	First string
+	Last  string
+	Age   int
+}
+
+func (*verUser) BinaryVersion() uint { return 3 }
+
+type verOrderV1 struct {
+	ID    uint
+	Total float64
+}
+
+func (*verOrderV1) BinaryVersion() uint { return 1 }
+
+type verOrder struct {
+	ID    uint
+	Cents int64
+}
+
+func (*verOrder) BinaryVersion() uint { return 2 }
+
+type verOrphan struct{ V int }
+
+func (*verOrphan) BinaryVersion() uint { return 5 }
+
+func init() {
+	must := func(err error) {
+		if err != nil {
+			panic(err)
+		}
+	}
+	must(RegisterMigration(1, 2, func(o *verUserV1) (*verUserV2, error) {
+		first, last, _ := strings.Cut(o.Name, " ")
+		return &verUserV2{First: first, Last: last}, nil
+	}))
+	must(RegisterMigration(2, 3, func(o *verUserV2) (*verUser, error) {
+		return &verUser{First: o.First, Last: o.Last, Age: -1}, nil
+	}))
+	must(RegisterMigration(1, 2, func(o *verOrderV1) (*verOrder, error) {
+		return &verOrder{ID: o.ID, Cents: int64(o.Total * 100)}, nil
+	}))
+}
+
+func TestVersionHeader(t *testing.T) {
+	var b []byte
+	if err := Encode(&verUser{First: "Ada", Last: "Lovelace", Age: 36}, &b); err != nil {
+		t.Fatal(err)
+	}
+	if b[0] != 3 {
+		t.Fatalf("expected version header 3, got %d", b[0])
+	}
+
+	var out verUser
+	if err := Decode(b, &out); err != nil {
+		t.Fatal(err)
+	}
+	if out != (verUser{First: "Ada", Last: "Lovelace", Age: 36}) {
+		t.Errorf("unexpected value %+v", out)
+	}
+
+	s := DescribeType(&verUser{})
+	if !s.Versioned || s.Version != 3 {
+		t.Errorf("expected versioned schema, got %+v", s)
+	}
+	v, err := DecodeDynamic(b, s)
+	if err != nil || v.(map[string]Value)["First"] != "Ada" {
+		t.Errorf("unexpected dynamic decode %v %v", v, err)
+	}
+	s.Version = 2
+	if _, err := DecodeDynamic(b, s); err == nil {
+		t.Error("expected version mismatch in DecodeDynamic")
+	}
+}
+
+func TestVersionHeaderByValue(t *testing.T) {
+	// BinaryVersion has a pointer receiver: values passed by value are still
+	// versioned, since the version belongs to the type.
+	var b []byte
+	if err := Encode(verUser{First: "Ada", Age: 36}, &b); err != nil {
+		t.Fatal(err)
+	}
+	if b[0] != 3 {
+		t.Fatalf("expected version header 3, got %d", b[0])
+	}
+	var out verUser
+	if err := Decode(b, &out); err != nil {
+		t.Fatal(err)
+	}
+	if out != (verUser{First: "Ada", Age: 36}) {
+		t.Errorf("unexpected value %+v", out)
+	}
+
+	if s := DescribeType(verUser{}); !s.Versioned || s.Version != 3 {
+		t.Errorf("expected versioned schema, got %+v", s)
+	}
+}
+
+func TestMigrationChain(t *testing.T) {
+	var b []byte
+	if err := Encode(&verUserV1{Name: "Grace Hopper"}, &b); err != nil {
+		t.Fatal(err)
+	}
+
+	var out verUser
+	if err := Decode(b, &out); err != nil {
+		t.Fatalf("Decode with migrations failed: %v", err)
+	}
+	if out != (verUser{First: "Grace", Last: "Hopper", Age: -1}) {
+		t.Errorf("unexpected migrated value %+v", out)
+	}
+
+	// A single step is enough for version 2 data.
+	if err := Encode(&verUserV2{First: "Alan", Last: "Turing"}, &b); err != nil {
+		t.Fatal(err)
+	}
+	var v2 verUser
+	if err := Decode(b, &v2); err != nil {
+		t.Fatal(err)
+	}
+	if v2.First != "Alan" || v2.Age != -1 {
+		t.Errorf("unexpected migrated value %+v", v2)
+	}
+
+	// Intermediate versions can still be decoded directly.
+	if err := Encode(&verUserV1{Name: "Grace Hopper"}, &b); err != nil {
+		t.Fatal(err)
+	}
+	var mid verUserV2
+	if err := Decode(b, &mid); err != nil || mid.Last != "Hopper" {
+		t.Errorf("unexpected intermediate value %+v %v", mid, err)
+	}
+}
+
+func TestMigrationPerTargetType(t *testing.T) {
+	// verUserV1 and verOrderV1 both migrate from version 1.
+	var b []byte
+	if err := Encode(&verOrderV1{ID: 7, Total: 12.5}, &b); err != nil {
+		t.Fatal(err)
+	}
+	var order verOrder
+	if err := Decode(b, &order); err != nil {
+		t.Fatalf("Decode with migrations failed: %v", err)
+	}
+	if order != (verOrder{ID: 7, Cents: 1250}) {
+		t.Errorf("unexpected migrated value %+v", order)
+	}
+
+	if err := Encode(&verUserV1{Name: "Ada Lovelace"}, &b); err != nil {
+		t.Fatal(err)
+	}
+	var user verUser
+	if err := Decode(b, &user); err != nil || user.Last != "Lovelace" {
+		t.Errorf("unexpected migrated value %+v %v", user, err)
+	}
+}
+
+func TestMigrationWithFingerprint(t *testing.T) {
+	c := New(WithFingerprint(false))
+	var b []byte
+	if err := c.Encode(&verUserV1{Name: "Grace Hopper"}, &b); err != nil {
+		t.Fatal(err)
+	}
+	var out verUser
+	if err := c.Decode(b, &out); err != nil {
+		t.Fatalf("fingerprint of the old layout should be accepted: %v", err)
+	}
+	if out.First != "Grace" {
+		t.Errorf("unexpected value %+v", out)
+	}
+}
+
+func TestMigrationErrors(t *testing.T) {
+	var b []byte
+	if err := Encode(&verUser{First: "x"}, &b); err != nil {
+		t.Fatal(err)
+	}
+
+	var older verUserV2
+	if err := Decode(b, &older); err == nil || !strings.Contains(err.Error(), "newer") {
+		t.Errorf("expected newer version error, got %v", err)
+	}
+
+	var orphan verOrphan
+	if err := Decode([]byte{4, 2}, &orphan); err == nil || !strings.Contains(err.Error(), "no migration from version 4") {
+		t.Errorf("expected missing migration error, got %v", err)
+	}
+
+	if err := Decode([]byte{}, &orphan); err == nil {
+		t.Error("expected error for missing header")
+	}
+
+	type failOld struct{ A int }
+	type failNew struct{ A int }
+	if err := RegisterMigration(40, 41, func(*failOld) (*failNew, error) { return nil, nil }); err != nil {
+		t.Fatal(err)
+	}
+	if err := RegisterMigration(40, 42, func(*failOld) (*failNew, error) { return nil, nil }); err == nil {
+		t.Error("expected duplicate migration error")
+	}
+	if err := RegisterMigration(3, 3, func(*failOld) (*failNew, error) { return nil, nil }); err == nil {
+		t.Error("expected error for non increasing versions")
+	}
+	if err := RegisterMigration[failOld, failNew](7, 8, nil); err == nil {
+		t.Error("expected error for nil function")
+	}
+}